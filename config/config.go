@@ -2,8 +2,7 @@ package config
 
 import (
 	"io/ioutil"
-
-	jsoniter "github.com/json-iterator/go"
+	"sort"
 )
 
 // Config is configuration of connection
@@ -15,12 +14,35 @@ type Config interface {
 	GetCSOAddress() string
 }
 
+// EndpointsConfig is a Config which has many addresses of Proxy servers
+// Implementations of Config which do not implement it have only the address of GetCSOAddress
+type EndpointsConfig interface {
+	Config
+	GetCSOAddresses() []Endpoint
+}
+
+// GetEndpoints returns addresses of Proxy servers of conf sorted by priority
+func GetEndpoints(conf Config) []Endpoint {
+	if endpointsConf, isOk := conf.(EndpointsConfig); isOk {
+		return endpointsConf.GetCSOAddresses()
+	}
+	return []Endpoint{{Address: conf.GetCSOAddress()}}
+}
+
+// Endpoint is address of a Proxy server
+// Endpoints with lower priority value are preferred
+type Endpoint struct {
+	Address  string `json:"addr" yaml:"addr"`
+	Priority int32  `json:"priority" yaml:"priority"`
+}
+
 type configImpl struct {
-	ProjectID      string `json:"pid"`
-	ProjectToken   string `json:"ptoken"`
-	ConnectionName string `json:"cname"`
-	CSOPublicKey   string `json:"csopubkey"`
-	CSOAddress     string `json:"csoaddr"`
+	ProjectID      string     `json:"pid" yaml:"pid"`
+	ProjectToken   string     `json:"ptoken" yaml:"ptoken"`
+	ConnectionName string     `json:"cname" yaml:"cname"`
+	CSOPublicKey   string     `json:"csopubkey" yaml:"csopubkey"`
+	CSOAddress     string     `json:"csoaddr" yaml:"csoaddr"`
+	CSOAddresses   []Endpoint `json:"csoaddrs" yaml:"csoaddrs"`
 }
 
 // NewConfig inits a new instance of Config
@@ -34,7 +56,21 @@ func NewConfig(projectID, projectToken, connName, csoPublicKey, csoAddress strin
 	}
 }
 
-// NewConfigFromFile inits a new instance of Config by read cso_key.json file
+// NewConfigWithEndpoints inits a new instance of Config with many addresses of Proxy servers
+func NewConfigWithEndpoints(projectID, projectToken, connName, csoPublicKey string, endpoints []Endpoint) Config {
+	conf := &configImpl{
+		ProjectID:      projectID,
+		ProjectToken:   projectToken,
+		ConnectionName: connName,
+		CSOPublicKey:   csoPublicKey,
+		CSOAddresses:   endpoints,
+	}
+	conf.CSOAddress = conf.GetCSOAddresses()[0].Address
+	return conf
+}
+
+// NewConfigFromFile inits a new instance of Config by read cso_key.json file (or a YAML file with extension .yaml/.yml)
+// The file is stored in plaintext, see NewConfigFromEncryptedFile for an encrypted alternative
 func NewConfigFromFile(filePath string) (Config, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -42,7 +78,7 @@ func NewConfigFromFile(filePath string) (Config, error) {
 	}
 
 	conf := new(configImpl)
-	err = jsoniter.ConfigFastest.Unmarshal(bytes, conf)
+	err = unmarshalFile(filePath, bytes, conf)
 	if err != nil {
 		return nil, err
 	}
@@ -66,5 +102,43 @@ func (conf *configImpl) GetCSOPublicKey() string {
 }
 
 func (conf *configImpl) GetCSOAddress() string {
+	if conf.CSOAddress == "" && len(conf.CSOAddresses) > 0 {
+		return conf.GetCSOAddresses()[0].Address
+	}
 	return conf.CSOAddress
 }
+
+// GetCSOAddresses returns addresses of Proxy servers sorted by priority
+// The result contains only CSOAddress when no endpoint is configured
+func (conf *configImpl) GetCSOAddresses() []Endpoint {
+	if len(conf.CSOAddresses) == 0 {
+		return []Endpoint{{Address: conf.CSOAddress}}
+	}
+	endpoints := make([]Endpoint, len(conf.CSOAddresses))
+	copy(endpoints, conf.CSOAddresses)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	return endpoints
+}
+
+type renamedConfig struct {
+	Config
+	connName string
+}
+
+func (conf *renamedConfig) GetConnectionName() string {
+	return conf.connName
+}
+
+func (conf *renamedConfig) GetCSOAddresses() []Endpoint {
+	return GetEndpoints(conf.Config)
+}
+
+// WithConnectionName returns conf with another connection name, other values are read from conf
+func WithConnectionName(conf Config, connName string) Config {
+	if renamed, ok := conf.(*renamedConfig); ok {
+		conf = renamed.Config
+	}
+	return &renamedConfig{Config: conf, connName: connName}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gecosys/cso-client-golang/utils"
+	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "keyfile"
+
+	// Parameters of scrypt (recommended values for interactive logins)
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// Limits of scrypt parameters which are read from a file, so a file cannot exhaust memory or CPU
+	maxScryptN      = 1 << 20
+	maxScryptRP     = 32      // r * p
+	maxScryptMemory = 1 << 30 // 128 * N * r bytes
+
+	lenKey  = 32
+	lenSalt = 16
+)
+
+// encryptedFile is format of an encrypted config file, the config is encrypted by AES-GCM
+type encryptedFile struct {
+	Version   int    `json:"version"`
+	KDF       string `json:"kdf"`
+	Salt      string `json:"salt,omitempty"`
+	N         int    `json:"n,omitempty"`
+	R         int    `json:"r,omitempty"`
+	P         int    `json:"p,omitempty"`
+	IV        string `json:"iv"`
+	AuthenTag string `json:"authen_tag"`
+	Data      string `json:"data"`
+}
+
+// EncryptConfig encrypts conf by a key derived from passphrase (scrypt)
+func EncryptConfig(conf Config, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, lenSalt)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, lenKey)
+	if err != nil {
+		return nil, err
+	}
+	return encryptConfig(conf, key, &encryptedFile{
+		KDF:  kdfScrypt,
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+	})
+}
+
+// EncryptConfigWithKey encrypts conf by a 32-byte key (see GenerateKeyFile)
+func EncryptConfigWithKey(conf Config, key []byte) ([]byte, error) {
+	if len(key) != lenKey {
+		return nil, errors.New("Invalid key")
+	}
+	return encryptConfig(conf, key, &encryptedFile{KDF: kdfKeyFile})
+}
+
+// NewConfigFromEncryptedFile inits a new instance of Config by reading a file encrypted with a passphrase
+func NewConfigFromEncryptedFile(filePath string, passphrase []byte) (Config, error) {
+	file, err := readEncryptedFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if file.KDF != kdfScrypt {
+		return nil, errors.New("Config file is not encrypted by a passphrase")
+	}
+	err = file.validateScrypt()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, salt, file.N, file.R, file.P, lenKey)
+	if err != nil {
+		return nil, err
+	}
+	return decryptConfig(file, key)
+}
+
+// NewConfigFromEncryptedFileWithKeyFile inits a new instance of Config by reading a file encrypted with the key in keyFilePath
+func NewConfigFromEncryptedFileWithKeyFile(filePath, keyFilePath string) (Config, error) {
+	file, err := readEncryptedFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if file.KDF != kdfKeyFile {
+		return nil, errors.New("Config file is not encrypted by a key file")
+	}
+	key, err := ReadKeyFile(keyFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return decryptConfig(file, key)
+}
+
+// GenerateKeyFile writes a random 32-byte key (base64) into filePath which is readable by the owner only
+func GenerateKeyFile(filePath string) ([]byte, error) {
+	key := make([]byte, lenKey)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	err := ioutil.WriteFile(filePath, []byte(base64.StdEncoding.EncodeToString(key)), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a key written by GenerateKeyFile
+func ReadKeyFile(filePath string) ([]byte, error) {
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(bytes)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != lenKey {
+		return nil, errors.New("Invalid key file")
+	}
+	return key, nil
+}
+
+func encryptConfig(conf Config, key []byte, file *encryptedFile) ([]byte, error) {
+	plain, err := jsoniter.ConfigFastest.Marshal(&configImpl{
+		ProjectID:      conf.GetProjectID(),
+		ProjectToken:   conf.GetProjectToken(),
+		ConnectionName: conf.GetConnectionName(),
+		CSOPublicKey:   conf.GetCSOPublicKey(),
+		CSOAddress:     conf.GetCSOAddress(),
+		CSOAddresses:   GetEndpoints(conf),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file.Version = 1
+	iv, authenTag, data, err := utils.EncryptAES(key, plain, file.aad())
+	if err != nil {
+		return nil, err
+	}
+	file.IV = base64.StdEncoding.EncodeToString(iv)
+	file.AuthenTag = base64.StdEncoding.EncodeToString(authenTag)
+	file.Data = base64.StdEncoding.EncodeToString(data)
+	return jsoniter.ConfigFastest.Marshal(file)
+}
+
+func decryptConfig(file *encryptedFile, key []byte) (Config, error) {
+	iv, err := base64.StdEncoding.DecodeString(file.IV)
+	if err != nil {
+		return nil, err
+	}
+	authenTag, err := base64.StdEncoding.DecodeString(file.AuthenTag)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := utils.DecryptAES(key, iv, authenTag, data, file.aad())
+	if err != nil {
+		return nil, errors.New("Cannot decrypt config file (wrong passphrase or key)")
+	}
+
+	conf := new(configImpl)
+	err = jsoniter.ConfigFastest.Unmarshal(plain, conf)
+	if err != nil {
+		return nil, err
+	}
+	err = Validate(conf)
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func readEncryptedFile(filePath string) (*encryptedFile, error) {
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file := new(encryptedFile)
+	err = jsoniter.ConfigFastest.Unmarshal(bytes, file)
+	if err != nil {
+		return nil, err
+	}
+	if file.Version != 1 {
+		return nil, errors.New("Unsupported version of config file")
+	}
+	return file, nil
+}
+
+// validateScrypt checks that parameters of scrypt are within the limits
+func (file *encryptedFile) validateScrypt() error {
+	if file.N <= 1 || file.N > maxScryptN || file.N&(file.N-1) != 0 {
+		return errors.New("Invalid scrypt parameter N")
+	}
+	// r and p are checked separately first so that r * p cannot overflow on 32-bit platforms
+	if file.R <= 0 || file.P <= 0 || file.R > maxScryptRP || file.P > maxScryptRP || file.R*file.P > maxScryptRP {
+		return errors.New("Invalid scrypt parameters r and p")
+	}
+	// 128 * N * r is compared by division because it overflows int on 32-bit platforms
+	if uint64(file.R) > maxScryptMemory/(128*uint64(file.N)) {
+		return errors.New("Invalid scrypt parameters N and r")
+	}
+	return nil
+}
+
+// aad binds parameters of key derivation to the encrypted data
+func (file *encryptedFile) aad() []byte {
+	return []byte(file.KDF + file.Salt)
+}
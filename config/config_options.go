@@ -0,0 +1,361 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is time.Duration which is written as a string (e.g. "3s", "100ms") in config files
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := jsoniter.ConfigFastest.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	return d.set(value)
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return jsoniter.ConfigFastest.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalYAML parses a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value interface{}
+	err := node.Decode(&value)
+	if err != nil {
+		return err
+	}
+	return d.set(value)
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) set(value interface{}) error {
+	switch val := value.(type) {
+	case string:
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	case float64:
+		*d = Duration(val)
+	case int:
+		*d = Duration(val)
+	default:
+		return errors.New("Invalid duration")
+	}
+	return nil
+}
+
+// Key exchanges with the Proxy server
+const (
+	// KeyExchangeDH is the legacy finite-field Diffie-Hellman
+	KeyExchangeDH = "dh"
+	// KeyExchangeX25519 prefers X25519, servers without support fall back to KeyExchangeDH
+	KeyExchangeX25519 = "x25519"
+	// KeyExchangeX25519Only rejects servers without support of X25519
+	KeyExchangeX25519Only = "x25519-only"
+)
+
+// Options are tunables of the library, zero values are replaced by defaults
+type Options struct {
+	// Capacity of the retry queue
+	QueueSize int32 `json:"queue_size" yaml:"queue_size"`
+	// Capacities of priority classes of the retry queue (0 means QueueSize)
+	QueueSizeLow    int32 `json:"queue_size_low" yaml:"queue_size_low"`
+	QueueSizeNormal int32 `json:"queue_size_normal" yaml:"queue_size_normal"`
+	QueueSizeHigh   int32 `json:"queue_size_high" yaml:"queue_size_high"`
+	// Number of times a due message is skipped for higher priorities before it is sent
+	StarvationLimit int `json:"starvation_limit" yaml:"starvation_limit"`
+	// Capacity of the channel of received messages
+	BufferSize int32 `json:"buffer_size" yaml:"buffer_size"`
+	// Interval of resending an unacknowledged message
+	ResendInterval Duration `json:"resend_interval" yaml:"resend_interval"`
+	// Interval of taking the next message from the retry queue
+	TickInterval Duration `json:"tick_interval" yaml:"tick_interval"`
+	// Delay before reconnecting to the Cloud Socket system
+	ReconnectDelay Duration `json:"reconnect_delay" yaml:"reconnect_delay"`
+	// Interval of resending the activation message
+	ActivationInterval Duration `json:"activation_interval" yaml:"activation_interval"`
+	// Timeout of dialing the Hub server (0 means no timeout)
+	DialTimeout Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	// Number of message indices tracked by the replay-protection window
+	ReplayWindow uint32 `json:"replay_window" yaml:"replay_window"`
+
+	// Timeout of a HTTP request to the Proxy server
+	HTTPTimeout Duration `json:"http_timeout" yaml:"http_timeout"`
+	// Number of retries of a HTTP request on transient errors
+	HTTPRetry int `json:"http_retry" yaml:"http_retry"`
+	// Delay before the first retry of a HTTP request, it doubles after each retry
+	HTTPRetryDelay Duration `json:"http_retry_delay" yaml:"http_retry_delay"`
+	// Value of User-Agent header of HTTP requests
+	UserAgent string `json:"user_agent" yaml:"user_agent"`
+	// Key exchange with the Proxy server (KeyExchangeDH, KeyExchangeX25519 or KeyExchangeX25519Only)
+	KeyExchange string `json:"key_exchange" yaml:"key_exchange"`
+	// Duration which an unhealthy Proxy server is skipped
+	FailoverCooldown Duration `json:"failover_cooldown" yaml:"failover_cooldown"`
+
+	// Number of messages buffered while the connector is not activated (0 disables the offline buffer)
+	OfflineBufferSize int `json:"offline_buffer_size" yaml:"offline_buffer_size"`
+	// Total bytes of contents in the offline buffer (0 means no limit)
+	OfflineBufferBytes int `json:"offline_buffer_bytes" yaml:"offline_buffer_bytes"`
+	// Age after which a buffered message is dropped (0 means no limit)
+	OfflineBufferAge Duration `json:"offline_buffer_age" yaml:"offline_buffer_age"`
+
+	// Lifetime of a ticket for session resumption (0 disables session resumption)
+	TicketLifetime Duration `json:"ticket_lifetime" yaml:"ticket_lifetime"`
+	// Age of the session key after which it is rotated (0 disables rotation by time)
+	KeyRotationInterval Duration `json:"key_rotation_interval" yaml:"key_rotation_interval"`
+	// Bytes sent and received by the session key after which it is rotated (0 disables rotation by bytes)
+	KeyRotationBytes int64 `json:"key_rotation_bytes" yaml:"key_rotation_bytes"`
+	// Messages sent and received by the session key after which it is rotated (0 disables rotation by messages)
+	KeyRotationMessages int64 `json:"key_rotation_messages" yaml:"key_rotation_messages"`
+	// Compression algorithm ("", "gzip", "zstd", "snappy")
+	Compression string `json:"compression" yaml:"compression"`
+	// Content smaller than the threshold (bytes) is not compressed
+	CompressionThreshold int `json:"compression_threshold" yaml:"compression_threshold"`
+
+	// Disable logging of errors
+	DisableLogging bool `json:"disable_logging" yaml:"disable_logging"`
+
+	keys map[string]bool // keys of fields which are set explicitly, so their zero values are merged
+}
+
+// DefaultOptions returns options matching the default behavior of the library
+func DefaultOptions() *Options {
+	return &Options{
+		QueueSize:            1024,
+		QueueSizeLow:         0,
+		QueueSizeNormal:      0,
+		QueueSizeHigh:        0,
+		StarvationLimit:      8,
+		BufferSize:           1024,
+		ResendInterval:       Duration(3 * time.Second),
+		TickInterval:         Duration(100 * time.Millisecond),
+		ReconnectDelay:       Duration(3 * time.Second),
+		ActivationInterval:   Duration(3 * time.Second),
+		DialTimeout:          0,
+		ReplayWindow:         1024,
+		HTTPTimeout:          Duration(30 * time.Second),
+		HTTPRetry:            0,
+		HTTPRetryDelay:       Duration(time.Second),
+		UserAgent:            "cso-client-golang",
+		KeyExchange:          KeyExchangeDH,
+		FailoverCooldown:     Duration(time.Minute),
+		OfflineBufferSize:    0,
+		OfflineBufferBytes:   0,
+		OfflineBufferAge:     0,
+		TicketLifetime:       0,
+		KeyRotationInterval:  0,
+		KeyRotationBytes:     0,
+		KeyRotationMessages:  0,
+		Compression:          "",
+		CompressionThreshold: 0,
+		DisableLogging:       false,
+	}
+}
+
+// Merge replaces fields of opts by non-zero fields of other and fields which are set explicitly in other
+// (e.g. a zero value in a config file), the replaced fields are marked as set explicitly in opts
+// opts is unchanged if other or the result is invalid
+func (opts *Options) Merge(other *Options) error {
+	if other == nil {
+		return nil
+	}
+	err := ValidateOptions(other)
+	if err != nil {
+		return err
+	}
+
+	merged := *opts
+	keys := make(map[string]bool, len(opts.keys))
+	for key := range opts.keys {
+		keys[key] = true
+	}
+	set := func(key string, isNonZero bool) bool {
+		if !other.isSet(key, isNonZero) {
+			return false
+		}
+		keys[key] = true
+		return true
+	}
+	if set("queue_size", other.QueueSize != 0) {
+		merged.QueueSize = other.QueueSize
+	}
+	if set("queue_size_low", other.QueueSizeLow != 0) {
+		merged.QueueSizeLow = other.QueueSizeLow
+	}
+	if set("queue_size_normal", other.QueueSizeNormal != 0) {
+		merged.QueueSizeNormal = other.QueueSizeNormal
+	}
+	if set("queue_size_high", other.QueueSizeHigh != 0) {
+		merged.QueueSizeHigh = other.QueueSizeHigh
+	}
+	if set("starvation_limit", other.StarvationLimit != 0) {
+		merged.StarvationLimit = other.StarvationLimit
+	}
+	if set("buffer_size", other.BufferSize != 0) {
+		merged.BufferSize = other.BufferSize
+	}
+	if set("resend_interval", other.ResendInterval != 0) {
+		merged.ResendInterval = other.ResendInterval
+	}
+	if set("tick_interval", other.TickInterval != 0) {
+		merged.TickInterval = other.TickInterval
+	}
+	if set("reconnect_delay", other.ReconnectDelay != 0) {
+		merged.ReconnectDelay = other.ReconnectDelay
+	}
+	if set("activation_interval", other.ActivationInterval != 0) {
+		merged.ActivationInterval = other.ActivationInterval
+	}
+	if set("dial_timeout", other.DialTimeout != 0) {
+		merged.DialTimeout = other.DialTimeout
+	}
+	if set("replay_window", other.ReplayWindow != 0) {
+		merged.ReplayWindow = other.ReplayWindow
+	}
+	if set("http_timeout", other.HTTPTimeout != 0) {
+		merged.HTTPTimeout = other.HTTPTimeout
+	}
+	if set("http_retry", other.HTTPRetry != 0) {
+		merged.HTTPRetry = other.HTTPRetry
+	}
+	if set("http_retry_delay", other.HTTPRetryDelay != 0) {
+		merged.HTTPRetryDelay = other.HTTPRetryDelay
+	}
+	if set("user_agent", other.UserAgent != "") {
+		merged.UserAgent = other.UserAgent
+	}
+	if set("key_exchange", other.KeyExchange != "") {
+		merged.KeyExchange = other.KeyExchange
+	}
+	if set("failover_cooldown", other.FailoverCooldown != 0) {
+		merged.FailoverCooldown = other.FailoverCooldown
+	}
+	if set("offline_buffer_size", other.OfflineBufferSize != 0) {
+		merged.OfflineBufferSize = other.OfflineBufferSize
+	}
+	if set("offline_buffer_bytes", other.OfflineBufferBytes != 0) {
+		merged.OfflineBufferBytes = other.OfflineBufferBytes
+	}
+	if set("offline_buffer_age", other.OfflineBufferAge != 0) {
+		merged.OfflineBufferAge = other.OfflineBufferAge
+	}
+	if set("ticket_lifetime", other.TicketLifetime != 0) {
+		merged.TicketLifetime = other.TicketLifetime
+	}
+	if set("key_rotation_interval", other.KeyRotationInterval != 0) {
+		merged.KeyRotationInterval = other.KeyRotationInterval
+	}
+	if set("key_rotation_bytes", other.KeyRotationBytes != 0) {
+		merged.KeyRotationBytes = other.KeyRotationBytes
+	}
+	if set("key_rotation_messages", other.KeyRotationMessages != 0) {
+		merged.KeyRotationMessages = other.KeyRotationMessages
+	}
+	if set("compression", other.Compression != "") {
+		merged.Compression = other.Compression
+	}
+	if set("compression_threshold", other.CompressionThreshold != 0) {
+		merged.CompressionThreshold = other.CompressionThreshold
+	}
+	if set("disable_logging", other.DisableLogging) {
+		merged.DisableLogging = other.DisableLogging
+	}
+	if len(keys) > 0 {
+		merged.keys = keys
+	}
+
+	err = merged.Validate()
+	if err != nil {
+		return err
+	}
+	*opts = merged
+	return nil
+}
+
+// SetKeys marks fields of keys (e.g. "disable_logging") as set explicitly, so their zero values override other options when merged
+func (opts *Options) SetKeys(keys ...string) {
+	if opts.keys == nil {
+		opts.keys = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		opts.keys[key] = true
+	}
+}
+
+// IsSet checks if the field of key is set explicitly, by a config file, SetKeys or a merge of a non-zero value
+func (opts *Options) IsSet(key string) bool {
+	return opts.keys[key]
+}
+
+func (opts *Options) isSet(key string, isNonZero bool) bool {
+	return isNonZero || opts.keys[key]
+}
+
+// NewOptionsFromFile reads section "options" of a config file (JSON or YAML by extension)
+// Fields which are not in the file are zero, so they do not override other values when merged
+// Options with unsupported or negative values (e.g. an unknown key exchange) are rejected
+func NewOptionsFromFile(filePath string) (*Options, error) {
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		Options *Options `json:"options" yaml:"options"`
+	}{}
+	err = unmarshalFile(filePath, bytes, &file)
+	if err != nil {
+		return nil, err
+	}
+	if file.Options == nil {
+		return new(Options), nil
+	}
+
+	// Keys in the file override other values even if they are zero
+	keys := struct {
+		Options map[string]interface{} `json:"options" yaml:"options"`
+	}{}
+	err = unmarshalFile(filePath, bytes, &keys)
+	if err != nil {
+		return nil, err
+	}
+	for key := range keys.Options {
+		file.Options.SetKeys(key)
+	}
+
+	err = ValidateOptions(file.Options)
+	if err != nil {
+		return nil, err
+	}
+	return file.Options, nil
+}
+
+func isYAMLFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func unmarshalFile(filePath string, bytes []byte, value interface{}) error {
+	if isYAMLFile(filePath) {
+		return yaml.Unmarshal(bytes, value)
+	}
+	return jsoniter.ConfigFastest.Unmarshal(bytes, value)
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		name     string
+		json     string
+		yaml     string
+		isValid  bool
+		duration time.Duration
+	}{
+		{"seconds", `"3s"`, `3s`, true, 3 * time.Second},
+		{"milliseconds", `"100ms"`, `100ms`, true, 100 * time.Millisecond},
+		{"compound", `"1m30s"`, `1m30s`, true, 90 * time.Second},
+		{"nanoseconds", `1500`, `1500`, true, 1500},
+		{"zero", `0`, `0`, true, 0},
+		{"negative", `"-1s"`, `-1s`, true, -time.Second},
+		{"missing unit", `"3"`, `"3"`, false, 0},
+		{"invalid string", `"three seconds"`, `three seconds`, false, 0},
+		{"boolean", `true`, `true`, false, 0},
+		{"list", `[1]`, `[1]`, false, 0},
+	}
+	for _, c := range cases {
+		var fromJSON, fromYAML Duration
+		errJSON := jsoniter.ConfigFastest.Unmarshal([]byte(c.json), &fromJSON)
+		errYAML := yaml.Unmarshal([]byte(c.yaml), &fromYAML)
+		if (errJSON == nil) != c.isValid || (errYAML == nil) != c.isValid {
+			t.Errorf("[TestDuration] invalid result of %s", c.name)
+			continue
+		}
+		if c.isValid && (time.Duration(fromJSON) != c.duration || time.Duration(fromYAML) != c.duration) {
+			t.Errorf("[TestDuration] invalid duration of %s", c.name)
+		}
+	}
+
+	// Durations are written as strings
+	opts := &Options{ResendInterval: Duration(1500 * time.Millisecond)}
+	data, err := jsoniter.ConfigFastest.Marshal(opts)
+	if err != nil {
+		t.Fatal("[TestDuration] marshal JSON failed")
+	}
+	decoded := new(Options)
+	if jsoniter.ConfigFastest.Unmarshal(data, decoded) != nil || decoded.ResendInterval != opts.ResendInterval {
+		t.Error("[TestDuration] invalid JSON round trip")
+	}
+	data, err = yaml.Marshal(opts)
+	if err != nil {
+		t.Fatal("[TestDuration] marshal YAML failed")
+	}
+	decoded = new(Options)
+	if yaml.Unmarshal(data, decoded) != nil || decoded.ResendInterval != opts.ResendInterval {
+		t.Error("[TestDuration] invalid YAML round trip")
+	}
+}
+
+func copyOptions(opts *Options) *Options {
+	result := *opts
+	return &result
+}
+
+func TestMergeOptions(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Fatalf("[TestMergeOptions] default options are invalid: %s", err.Error())
+	}
+
+	explicit := &Options{DisableLogging: false, HTTPRetry: 0, OfflineBufferSize: 0}
+	explicit.SetKeys("disable_logging", "http_retry")
+	modified := DefaultOptions()
+	modified.HTTPRetry = 3
+	modified.OfflineBufferSize = 16
+	modified.DisableLogging = true
+	cases := []struct {
+		name    string
+		base    *Options
+		other   *Options
+		isValid bool
+		check   func(opts *Options) bool
+	}{
+		{
+			"nil", DefaultOptions(), nil, true,
+			func(opts *Options) bool { return reflect.DeepEqual(opts, DefaultOptions()) },
+		},
+		{
+			"non-zero fields", DefaultOptions(),
+			&Options{QueueSize: 8, TickInterval: Duration(time.Millisecond), UserAgent: "agent", DisableLogging: true}, true,
+			func(opts *Options) bool {
+				return opts.QueueSize == 8 && opts.TickInterval == Duration(time.Millisecond) && opts.UserAgent == "agent" &&
+					opts.DisableLogging && opts.BufferSize == 1024
+			},
+		},
+		{
+			"zero fields", copyOptions(modified), &Options{}, true,
+			func(opts *Options) bool { return reflect.DeepEqual(opts, modified) },
+		},
+		{
+			"explicit zero fields", copyOptions(modified), explicit, true,
+			func(opts *Options) bool {
+				return opts.HTTPRetry == 0 && !opts.DisableLogging && opts.OfflineBufferSize == 16
+			},
+		},
+		{
+			"negative field", DefaultOptions(), &Options{HTTPRetry: -1}, false, nil,
+		},
+		{
+			"negative duration", DefaultOptions(), &Options{ReconnectDelay: Duration(-time.Second)}, false, nil,
+		},
+		{
+			"unsupported compression", DefaultOptions(), &Options{Compression: "lz4"}, false, nil,
+		},
+	}
+	for _, c := range cases {
+		opts := c.base
+		before := *opts
+		err := opts.Merge(c.other)
+		if (err == nil) != c.isValid {
+			t.Errorf("[TestMergeOptions] invalid result of %s", c.name)
+			continue
+		}
+		if !c.isValid && !reflect.DeepEqual(*opts, before) {
+			t.Errorf("[TestMergeOptions] invalid options of %s are merged", c.name)
+		}
+		if c.isValid && !c.check(opts) {
+			t.Errorf("[TestMergeOptions] invalid options after merging %s", c.name)
+		}
+	}
+
+	// Sizes and intervals without defaults can not be zero
+	zero := &Options{}
+	zero.SetKeys("tick_interval")
+	opts := DefaultOptions()
+	err := opts.Merge(zero)
+	if fieldErr, isOk := err.(*FieldError); !isOk || fieldErr.Field != "tick_interval" || opts.TickInterval == 0 {
+		t.Error("[TestMergeOptions] zero tick interval is merged")
+	}
+
+	// Merged fields are marked as set explicitly
+	opts = DefaultOptions()
+	if opts.IsSet("http_timeout") {
+		t.Error("[TestMergeOptions] default field is set explicitly")
+	}
+	if opts.Merge(&Options{HTTPTimeout: Duration(time.Second)}) != nil || !opts.IsSet("http_timeout") || opts.IsSet("http_retry") {
+		t.Error("[TestMergeOptions] invalid explicit fields after merging")
+	}
+}
+
+func TestOptionsFromFile(t *testing.T) {
+	yamlFile := writeFile(t, "options.yaml", `
+pid: project
+options:
+  queue_size: 64
+  resend_interval: 500ms
+  http_timeout: 10s
+  http_retry: 0
+  compression: snappy
+  compression_threshold: 128
+  disable_logging: false
+`)
+	opts, err := NewOptionsFromFile(yamlFile)
+	if err != nil {
+		t.Fatalf("[TestOptionsFromFile] load YAML failed: %s", err.Error())
+	}
+	if opts.QueueSize != 64 || opts.ResendInterval != Duration(500*time.Millisecond) || opts.HTTPTimeout != Duration(10*time.Second) ||
+		opts.Compression != "snappy" || opts.CompressionThreshold != 128 || opts.BufferSize != 0 {
+		t.Error("[TestOptionsFromFile] invalid YAML options")
+	}
+
+	// Keys in the file override other values even if they are zero
+	merged := DefaultOptions()
+	merged.HTTPRetry = 5
+	merged.DisableLogging = true
+	if merged.Merge(opts) != nil || merged.HTTPRetry != 0 || merged.DisableLogging || merged.QueueSize != 64 || merged.BufferSize != 1024 {
+		t.Error("[TestOptionsFromFile] invalid merged options")
+	}
+
+	jsonFile := writeFile(t, "options.json", `{"pid": "project", "options": {"tick_interval": "20ms", "replay_window": 256, "dial_timeout": 2000000000}}`)
+	opts, err = NewOptionsFromFile(jsonFile)
+	if err != nil || opts.TickInterval != Duration(20*time.Millisecond) || opts.ReplayWindow != 256 || opts.DialTimeout != Duration(2*time.Second) {
+		t.Error("[TestOptionsFromFile] invalid JSON options")
+	}
+
+	opts, err = NewOptionsFromFile(writeFile(t, "empty.yml", "pid: project\n"))
+	if err != nil || !reflect.DeepEqual(opts, new(Options)) {
+		t.Error("[TestOptionsFromFile] invalid options of a file without options")
+	}
+
+	invalids := map[string]string{
+		"negative.yaml": "options:\n  queue_size: -1\n",
+		"duration.yaml": "options:\n  tick_interval: fast\n",
+		"type.json":     `{"options": {"queue_size": "large"}}`,
+	}
+	for name, content := range invalids {
+		if _, err = NewOptionsFromFile(writeFile(t, name, content)); err == nil {
+			t.Errorf("[TestOptionsFromFile] invalid options of %s are loaded", name)
+		}
+	}
+	if _, err = NewOptionsFromFile(yamlFile + ".missing"); err == nil {
+		t.Error("[TestOptionsFromFile] missing file is loaded")
+	}
+}
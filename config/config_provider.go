@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Names of secrets which are loaded from SecretProvider
+const (
+	SecretProjectID      = "pid"
+	SecretProjectToken   = "ptoken"
+	SecretConnectionName = "cname"
+	SecretCSOPublicKey   = "csopubkey"
+	SecretCSOAddress     = "csoaddr"
+	SecretCSOAddresses   = "csoaddrs" // comma-separated, sorted by priority
+)
+
+// ErrSecretNotFound is returned by SecretProvider when a secret does not exist
+var ErrSecretNotFound = errors.New("Secret not found")
+
+// SecretProvider provides values of config (e.g. from a vault or a secret manager)
+type SecretProvider interface {
+	GetSecret(name string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to SecretProvider interface
+type SecretProviderFunc func(name string) (string, error)
+
+// GetSecret invokes the function
+func (fn SecretProviderFunc) GetSecret(name string) (string, error) {
+	return fn(name)
+}
+
+// NewConfigFromProvider inits a new instance of Config by secrets of provider
+func NewConfigFromProvider(provider SecretProvider) (Config, error) {
+	var (
+		err  error
+		conf = new(configImpl)
+	)
+	required := []struct {
+		name  string
+		value *string
+	}{
+		{SecretProjectID, &conf.ProjectID},
+		{SecretProjectToken, &conf.ProjectToken},
+		{SecretConnectionName, &conf.ConnectionName},
+		{SecretCSOPublicKey, &conf.CSOPublicKey},
+	}
+	for _, secret := range required {
+		*secret.value, err = provider.GetSecret(secret.name)
+		if err == ErrSecretNotFound {
+			return nil, &FieldError{Field: secret.name, Message: "is required"}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conf.CSOAddress, err = provider.GetSecret(SecretCSOAddress)
+	if err != nil && err != ErrSecretNotFound {
+		return nil, err
+	}
+	addresses, err := provider.GetSecret(SecretCSOAddresses)
+	if err != nil && err != ErrSecretNotFound {
+		return nil, err
+	}
+	for idx, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			conf.CSOAddresses = append(conf.CSOAddresses, Endpoint{Address: addr, Priority: int32(idx)})
+		}
+	}
+	if conf.CSOAddress == "" && len(conf.CSOAddresses) == 0 {
+		return nil, &FieldError{Field: SecretCSOAddress, Message: "is required"}
+	}
+
+	err = Validate(conf)
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// NewEnvProvider inits a new instance of SecretProvider which reads environment variables
+// Secrets are read from PREFIX_PROJECT_ID, PREFIX_PROJECT_TOKEN, PREFIX_CONNECTION_NAME,
+// PREFIX_PUBLIC_KEY, PREFIX_ADDRESS and PREFIX_ADDRESSES (default prefix is "CSO")
+// Each variable can be replaced by a variable with suffix _FILE which contains path of a file holding the value
+func NewEnvProvider(prefix string) SecretProvider {
+	if prefix == "" {
+		prefix = "CSO"
+	}
+	names := map[string]string{
+		SecretProjectID:      "PROJECT_ID",
+		SecretProjectToken:   "PROJECT_TOKEN",
+		SecretConnectionName: "CONNECTION_NAME",
+		SecretCSOPublicKey:   "PUBLIC_KEY",
+		SecretCSOAddress:     "ADDRESS",
+		SecretCSOAddresses:   "ADDRESSES",
+	}
+	return SecretProviderFunc(func(name string) (string, error) {
+		envName, isExisted := names[name]
+		if !isExisted {
+			return "", ErrSecretNotFound
+		}
+		envName = prefix + "_" + envName
+		if value, isExisted := os.LookupEnv(envName); isExisted {
+			// PEM keys in environment variables often have escaped line breaks
+			return strings.ReplaceAll(value, `\n`, "\n"), nil
+		}
+		if filePath, isExisted := os.LookupEnv(envName + "_FILE"); isExisted {
+			bytes, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(bytes), "\r\n"), nil
+		}
+		return "", ErrSecretNotFound
+	})
+}
+
+// NewConfigFromEnv inits a new instance of Config by environment variables (see NewEnvProvider)
+func NewConfigFromEnv(prefix string) (Config, error) {
+	return NewConfigFromProvider(NewEnvProvider(prefix))
+}
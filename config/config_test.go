@@ -0,0 +1,256 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	testKeyOnce   sync.Once
+	testPublicKey string
+)
+
+// newTestConfig returns a valid config with a generated RSA public key
+func newTestConfig(t *testing.T) Config {
+	testKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			return
+		}
+		pubKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return
+		}
+		testPublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKey}))
+	})
+	if testPublicKey == "" {
+		t.Fatal("[newTestConfig] generate key failed")
+	}
+	return NewConfig("project", "dG9rZW4=", "connection", testPublicKey, "https://proxy.example.com")
+}
+
+func isSameConfig(a, b Config) bool {
+	return a.GetProjectID() == b.GetProjectID() &&
+		a.GetProjectToken() == b.GetProjectToken() &&
+		a.GetConnectionName() == b.GetConnectionName() &&
+		a.GetCSOPublicKey() == b.GetCSOPublicKey() &&
+		a.GetCSOAddress() == b.GetCSOAddress()
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	filePath := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(filePath, []byte(content), 0600)
+	if err != nil {
+		t.Fatal("[writeFile] write file failed")
+	}
+	return filePath
+}
+
+func TestKeyExchangeOption(t *testing.T) {
+	for _, value := range []string{"", KeyExchangeDH, KeyExchangeX25519, KeyExchangeX25519Only} {
+		if ValidateOptions(&Options{KeyExchange: value}) != nil {
+			t.Errorf("[TestKeyExchangeOption] %q is rejected", value)
+		}
+	}
+
+	err := ValidateOptions(&Options{KeyExchange: "x25519only"})
+	if fieldErr, isOk := err.(*FieldError); !isOk || fieldErr.Field != "key_exchange" {
+		t.Error("[TestKeyExchangeOption] unknown key exchange is accepted")
+	}
+
+	_, err = NewOptionsFromFile(writeFile(t, "options.yaml", "options:\n  key_exchange: ecdh\n"))
+	if err == nil {
+		t.Error("[TestKeyExchangeOption] unknown key exchange is loaded")
+	}
+	opts, err := NewOptionsFromFile(writeFile(t, "options.json", `{"options": {"key_exchange": "x25519-only"}}`))
+	if err != nil || opts.KeyExchange != KeyExchangeX25519Only {
+		t.Error("[TestKeyExchangeOption] key exchange is not loaded")
+	}
+}
+
+func TestEncryptedConfig(t *testing.T) {
+	conf := newTestConfig(t)
+	data, err := EncryptConfig(conf, []byte("passphrase"))
+	if err != nil {
+		t.Fatal("[TestEncryptedConfig] encrypt failed")
+	}
+	filePath := writeFile(t, "cso_key.enc", string(data))
+
+	decrypted, err := NewConfigFromEncryptedFile(filePath, []byte("passphrase"))
+	if err != nil || !isSameConfig(conf, decrypted) {
+		t.Error("[TestEncryptedConfig] invalid decrypted config")
+	}
+	_, err = NewConfigFromEncryptedFile(filePath, []byte("wrong"))
+	if err == nil {
+		t.Error("[TestEncryptedConfig] wrong passphrase is accepted")
+	}
+	_, err = NewConfigFromEncryptedFileWithKeyFile(filePath, filePath)
+	if err == nil {
+		t.Error("[TestEncryptedConfig] file encrypted by a passphrase is decrypted by a key file")
+	}
+
+	// Key file
+	keyFilePath := filepath.Join(t.TempDir(), "cso.key")
+	key, err := GenerateKeyFile(keyFilePath)
+	if err != nil {
+		t.Fatal("[TestEncryptedConfig] generate key file failed")
+	}
+	data, err = EncryptConfigWithKey(conf, key)
+	if err != nil {
+		t.Fatal("[TestEncryptedConfig] encrypt by key failed")
+	}
+	filePath = writeFile(t, "cso_key.enc", string(data))
+	decrypted, err = NewConfigFromEncryptedFileWithKeyFile(filePath, keyFilePath)
+	if err != nil || !isSameConfig(conf, decrypted) {
+		t.Error("[TestEncryptedConfig] invalid config decrypted by key file")
+	}
+	otherKeyFilePath := filepath.Join(t.TempDir(), "other.key")
+	GenerateKeyFile(otherKeyFilePath)
+	_, err = NewConfigFromEncryptedFileWithKeyFile(filePath, otherKeyFilePath)
+	if err == nil {
+		t.Error("[TestEncryptedConfig] wrong key file is accepted")
+	}
+}
+
+func TestEncryptedConfigScrypt(t *testing.T) {
+	data, err := EncryptConfig(newTestConfig(t), []byte("passphrase"))
+	if err != nil {
+		t.Fatal("[TestEncryptedConfigScrypt] encrypt failed")
+	}
+	cases := []struct{ n, r, p int }{
+		{1 << 21, 8, 1},
+		{1000, 8, 1},
+		{0, 8, 1},
+		{1 << 15, 0, 1},
+		{1 << 15, 8, 8},
+		{1 << 20, 16, 1},
+		{1 << 20, 32, 1},
+		{1 << 15, 1 << 16, 1 << 16},
+	}
+	for _, c := range cases {
+		file := new(encryptedFile)
+		jsoniter.ConfigFastest.Unmarshal(data, file)
+		file.N, file.R, file.P = c.n, c.r, c.p
+		tampered, _ := jsoniter.ConfigFastest.Marshal(file)
+		_, err = NewConfigFromEncryptedFile(writeFile(t, "cso_key.enc", string(tampered)), []byte("passphrase"))
+		if err == nil || !strings.Contains(err.Error(), "scrypt") {
+			t.Errorf("[TestEncryptedConfigScrypt] parameters N=%d r=%d p=%d are accepted", c.n, c.r, c.p)
+		}
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	conf := newTestConfig(t)
+	t.Setenv("TEST_PROJECT_ID", conf.GetProjectID())
+	t.Setenv("TEST_PROJECT_TOKEN", conf.GetProjectToken())
+	t.Setenv("TEST_CONNECTION_NAME", conf.GetConnectionName())
+	t.Setenv("TEST_PUBLIC_KEY_FILE", writeFile(t, "public.pem", conf.GetCSOPublicKey()+"\n"))
+	t.Setenv("TEST_ADDRESSES", "https://a.example.com, https://b.example.com")
+
+	loaded, err := NewConfigFromEnv("TEST")
+	if err != nil {
+		t.Fatalf("[TestEnvProvider] load failed: %s", err.Error())
+	}
+	if loaded.GetProjectID() != conf.GetProjectID() || loaded.GetCSOPublicKey() != strings.TrimRight(conf.GetCSOPublicKey(), "\n") {
+		t.Error("[TestEnvProvider] invalid config")
+	}
+	addresses := GetEndpoints(loaded)
+	if len(addresses) != 2 || addresses[0].Address != "https://a.example.com" || loaded.GetCSOAddress() != "https://a.example.com" {
+		t.Error("[TestEnvProvider] invalid addresses")
+	}
+
+	// Escaped line breaks of PEM keys
+	t.Setenv("TEST_PUBLIC_KEY", strings.ReplaceAll(conf.GetCSOPublicKey(), "\n", `\n`))
+	loaded, err = NewConfigFromEnv("TEST")
+	if err != nil || loaded.GetCSOPublicKey() != conf.GetCSOPublicKey() {
+		t.Error("[TestEnvProvider] escaped public key is not loaded")
+	}
+
+	_, err = NewConfigFromEnv("MISSING")
+	if fieldErr, isOk := err.(*FieldError); !isOk || fieldErr.Field != SecretProjectID {
+		t.Error("[TestEnvProvider] missing variable is accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	conf := newTestConfig(t)
+	if Validate(conf) != nil {
+		t.Fatal("[TestValidate] valid config is rejected")
+	}
+	cases := []struct {
+		field string
+		conf  Config
+	}{
+		{"config", nil},
+		{"pid", NewConfig("", "dG9rZW4=", "connection", testPublicKey, "https://proxy")},
+		{"ptoken", NewConfig("project", "not base64!", "connection", testPublicKey, "https://proxy")},
+		{"cname", NewConfig("project", "dG9rZW4=", strings.Repeat("c", 37), testPublicKey, "https://proxy")},
+		{"csopubkey", NewConfig("project", "dG9rZW4=", "connection", "key", "https://proxy")},
+		{"csoaddr", NewConfig("project", "dG9rZW4=", "connection", testPublicKey, "ftp://proxy")},
+	}
+	for _, c := range cases {
+		fieldErr, isOk := Validate(c.conf).(*FieldError)
+		if !isOk || fieldErr.Field != c.field {
+			t.Errorf("[TestValidate] invalid field %s is accepted", c.field)
+		}
+	}
+
+	// Files are not validated when they are loaded
+	filePath := writeFile(t, "cso_key.json", `{"pid": "project", "cname": "connection"}`)
+	loaded, err := NewConfigFromFile(filePath)
+	if err != nil || loaded.GetProjectID() != "project" {
+		t.Error("[TestValidate] config file is validated")
+	}
+}
+
+// customConfig implements only Config
+type customConfig struct {
+	address string
+}
+
+func (conf *customConfig) GetProjectID() string      { return "project" }
+func (conf *customConfig) GetProjectToken() string   { return "token" }
+func (conf *customConfig) GetConnectionName() string { return "connection" }
+func (conf *customConfig) GetCSOPublicKey() string   { return "" }
+func (conf *customConfig) GetCSOAddress() string     { return conf.address }
+
+func TestGetEndpoints(t *testing.T) {
+	endpoints := []Endpoint{
+		{Address: "https://c.example.com", Priority: 3},
+		{Address: "https://a.example.com", Priority: 1},
+		{Address: "https://b.example.com", Priority: 2},
+	}
+	cases := []struct {
+		name      string
+		conf      Config
+		addresses []string
+	}{
+		{"custom config", &customConfig{address: "https://a.example.com"}, []string{"https://a.example.com"}},
+		{"single address", NewConfig("pid", "token", "name", "", "https://a.example.com"), []string{"https://a.example.com"}},
+		{"endpoints", NewConfigWithEndpoints("pid", "token", "name", "", endpoints), []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}},
+		{"renamed custom config", WithConnectionName(&customConfig{address: "https://a.example.com"}, "other"), []string{"https://a.example.com"}},
+		{"renamed endpoints", WithConnectionName(NewConfigWithEndpoints("pid", "token", "name", "", endpoints), "other"), []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}},
+	}
+	for _, c := range cases {
+		result := GetEndpoints(c.conf)
+		if len(result) != len(c.addresses) {
+			t.Errorf("[TestGetEndpoints] invalid number of endpoints of %s", c.name)
+			continue
+		}
+		for idx, addr := range c.addresses {
+			if result[idx].Address != addr {
+				t.Errorf("[TestGetEndpoints] invalid endpoints of %s", c.name)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/utils"
+)
+
+// FieldError describes an invalid field of Config
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (err *FieldError) Error() string {
+	return fmt.Sprintf("Invalid config field %q: %s", err.Field, err.Message)
+}
+
+// Validate checks required fields, the project token, the connection name,
+// the PEM public key and addresses of Proxy servers
+func Validate(conf Config) error {
+	if conf == nil {
+		return &FieldError{Field: "config", Message: "is nil"}
+	}
+	if conf.GetProjectID() == "" {
+		return &FieldError{Field: "pid", Message: "is required"}
+	}
+	if conf.GetProjectToken() == "" {
+		return &FieldError{Field: "ptoken", Message: "is required"}
+	}
+	if _, err := base64.StdEncoding.DecodeString(conf.GetProjectToken()); err != nil {
+		return &FieldError{Field: "ptoken", Message: "is not base64 encoded"}
+	}
+	lenName := len(conf.GetConnectionName())
+	if lenName == 0 {
+		return &FieldError{Field: "cname", Message: "is required"}
+	}
+	if lenName > cipher.MaxConnectionNameLength {
+		return &FieldError{Field: "cname", Message: fmt.Sprintf("is longer than %d bytes", cipher.MaxConnectionNameLength)}
+	}
+	if conf.GetCSOPublicKey() == "" {
+		return &FieldError{Field: "csopubkey", Message: "is required"}
+	}
+	if err := utils.ValidateRSAPublicKey(conf.GetCSOPublicKey()); err != nil {
+		return &FieldError{Field: "csopubkey", Message: err.Error()}
+	}
+	for _, endpoint := range GetEndpoints(conf) {
+		if endpoint.Address == "" {
+			return &FieldError{Field: "csoaddr", Message: "is required"}
+		}
+		addr, err := url.Parse(endpoint.Address)
+		if err != nil || (addr.Scheme != "http" && addr.Scheme != "https") || addr.Host == "" {
+			return &FieldError{Field: "csoaddr", Message: fmt.Sprintf("%q is not a HTTP(S) URL", endpoint.Address)}
+		}
+	}
+	return nil
+}
+
+// ValidateOptions checks fields of opts which have a fixed set of values and rejects negative values
+// Zero values are accepted since they mean defaults (e.g. options loaded by NewOptionsFromFile)
+func ValidateOptions(opts *Options) error {
+	switch opts.KeyExchange {
+	case "", KeyExchangeDH, KeyExchangeX25519, KeyExchangeX25519Only:
+	default:
+		return &FieldError{Field: "key_exchange", Message: fmt.Sprintf("%q is not supported", opts.KeyExchange)}
+	}
+	if !utils.IsSupportedCompression(opts.Compression) {
+		return &FieldError{Field: "compression", Message: fmt.Sprintf("%q is not supported", opts.Compression)}
+	}
+
+	values := []struct {
+		field string
+		value int64
+	}{
+		{"queue_size", int64(opts.QueueSize)},
+		{"queue_size_low", int64(opts.QueueSizeLow)},
+		{"queue_size_normal", int64(opts.QueueSizeNormal)},
+		{"queue_size_high", int64(opts.QueueSizeHigh)},
+		{"starvation_limit", int64(opts.StarvationLimit)},
+		{"buffer_size", int64(opts.BufferSize)},
+		{"resend_interval", int64(opts.ResendInterval)},
+		{"tick_interval", int64(opts.TickInterval)},
+		{"reconnect_delay", int64(opts.ReconnectDelay)},
+		{"activation_interval", int64(opts.ActivationInterval)},
+		{"dial_timeout", int64(opts.DialTimeout)},
+		{"http_timeout", int64(opts.HTTPTimeout)},
+		{"http_retry", int64(opts.HTTPRetry)},
+		{"http_retry_delay", int64(opts.HTTPRetryDelay)},
+		{"failover_cooldown", int64(opts.FailoverCooldown)},
+		{"offline_buffer_size", int64(opts.OfflineBufferSize)},
+		{"offline_buffer_bytes", int64(opts.OfflineBufferBytes)},
+		{"offline_buffer_age", int64(opts.OfflineBufferAge)},
+		{"ticket_lifetime", int64(opts.TicketLifetime)},
+		{"key_rotation_interval", int64(opts.KeyRotationInterval)},
+		{"key_rotation_bytes", opts.KeyRotationBytes},
+		{"key_rotation_messages", opts.KeyRotationMessages},
+		{"compression_threshold", int64(opts.CompressionThreshold)},
+	}
+	for _, val := range values {
+		if val.value < 0 {
+			return &FieldError{Field: val.field, Message: "is negative"}
+		}
+	}
+	return nil
+}
+
+// Validate checks options in use (e.g. DefaultOptions after Merge), sizes and intervals which have no default must be positive
+func (opts *Options) Validate() error {
+	err := ValidateOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	values := []struct {
+		field string
+		value int64
+	}{
+		{"queue_size", int64(opts.QueueSize)},
+		{"buffer_size", int64(opts.BufferSize)},
+		{"resend_interval", int64(opts.ResendInterval)},
+		{"tick_interval", int64(opts.TickInterval)},
+		{"reconnect_delay", int64(opts.ReconnectDelay)},
+		{"activation_interval", int64(opts.ActivationInterval)},
+		{"replay_window", int64(opts.ReplayWindow)},
+		{"http_timeout", int64(opts.HTTPTimeout)},
+		{"http_retry_delay", int64(opts.HTTPRetryDelay)},
+		{"failover_cooldown", int64(opts.FailoverCooldown)},
+	}
+	for _, val := range values {
+		if val.value == 0 {
+			return &FieldError{Field: val.field, Message: "must be positive"}
+		}
+	}
+	if opts.KeyExchange == "" {
+		return &FieldError{Field: "key_exchange", Message: "is required"}
+	}
+	return nil
+}
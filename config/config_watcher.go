@@ -0,0 +1,128 @@
+package config
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher notifies new configs when the source of config changes
+type Watcher interface {
+	// Updates is closed after Close, so readers ranging over it stop
+	Updates() <-chan Config
+	Close()
+}
+
+type watcherImpl struct {
+	load      func() (Config, error)
+	interval  time.Duration
+	logger    *log.Logger
+	chUpdates chan Config
+	chClose   chan struct{}
+	onceClose sync.Once
+}
+
+// NewWatcher inits a new instance of Watcher interface which invokes load every interval
+// The first loaded config is the baseline, a config is notified when it differs from the previous one
+// Errors of load are logged by logger (nil disables logging) and skipped
+func NewWatcher(load func() (Config, error), interval time.Duration, logger *log.Logger) Watcher {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	watcher := &watcherImpl{
+		load:      load,
+		interval:  interval,
+		logger:    logger,
+		chUpdates: make(chan Config, 1),
+		chClose:   make(chan struct{}),
+	}
+	go watcher.loop()
+	return watcher
+}
+
+// NewFileWatcher inits a new instance of Watcher interface which reloads filePath (by NewConfigFromFile) when it is modified
+func NewFileWatcher(filePath string, interval time.Duration, logger *log.Logger) Watcher {
+	var modTime time.Time
+	var last Config
+	return NewWatcher(func() (Config, error) {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && info.ModTime().Equal(modTime) {
+			return last, nil
+		}
+		conf, err := NewConfigFromFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		modTime = info.ModTime()
+		last = conf
+		return conf, nil
+	}, interval, logger)
+}
+
+func (watcher *watcherImpl) Updates() <-chan Config {
+	return watcher.chUpdates
+}
+
+func (watcher *watcherImpl) Close() {
+	watcher.onceClose.Do(func() {
+		close(watcher.chClose)
+	})
+}
+
+func (watcher *watcherImpl) loop() {
+	var (
+		current Config
+		ticker  = time.NewTicker(watcher.interval)
+	)
+	defer close(watcher.chUpdates)
+	defer ticker.Stop()
+
+	for {
+		conf, err := watcher.load()
+		if err != nil {
+			watcher.logger.Printf("Error reload config: %s", err.Error())
+		} else if current == nil {
+			current = conf // the initial config is in use already
+		} else if !Equal(current, conf) {
+			current = conf
+			select {
+			case watcher.chUpdates <- conf:
+			case <-watcher.chClose:
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-watcher.chClose:
+			return
+		}
+	}
+}
+
+// Equal checks if two configs have the same values
+func Equal(a, b Config) bool {
+	if a.GetProjectID() != b.GetProjectID() ||
+		a.GetProjectToken() != b.GetProjectToken() ||
+		a.GetConnectionName() != b.GetConnectionName() ||
+		a.GetCSOPublicKey() != b.GetCSOPublicKey() ||
+		a.GetCSOAddress() != b.GetCSOAddress() {
+		return false
+	}
+	endpointsA := GetEndpoints(a)
+	endpointsB := GetEndpoints(b)
+	if len(endpointsA) != len(endpointsB) {
+		return false
+	}
+	for idx := range endpointsA {
+		if endpointsA[idx] != endpointsB[idx] {
+			return false
+		}
+	}
+	return true
+}
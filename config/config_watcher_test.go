@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer which is safe for a logger and a test
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buf *syncBuffer) Write(data []byte) (int, error) {
+	buf.mutex.Lock()
+	defer buf.mutex.Unlock()
+	return buf.buffer.Write(data)
+}
+
+func (buf *syncBuffer) String() string {
+	buf.mutex.Lock()
+	defer buf.mutex.Unlock()
+	return buf.buffer.String()
+}
+
+func nextUpdate(t *testing.T, watcher Watcher) Config {
+	select {
+	case conf := <-watcher.Updates():
+		return conf
+	case <-time.After(2 * time.Second):
+		t.Fatal("[nextUpdate] timeout")
+	}
+	return nil
+}
+
+func noUpdate(t *testing.T, watcher Watcher, duration time.Duration) {
+	select {
+	case <-watcher.Updates():
+		t.Fatal("[noUpdate] unexpected update")
+	case <-time.After(duration):
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	errLoad := errors.New("load failed")
+	confA := NewConfig("project", "token", "a", "key", "http://proxy")
+	confB := NewConfig("project", "token", "b", "key", "http://proxy")
+	results := []struct {
+		conf Config
+		err  error
+	}{
+		{confA, nil}, // the initial config
+		{NewConfig("project", "token", "a", "key", "http://proxy"), nil}, // equal to the initial config
+		{nil, errLoad},
+		{confB, nil},
+	}
+
+	var (
+		mutex  sync.Mutex
+		number int
+		logs   syncBuffer
+	)
+	watcher := NewWatcher(func() (Config, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		idx := number
+		if idx >= len(results) {
+			idx = len(results) - 1
+		}
+		number++
+		return results[idx].conf, results[idx].err
+	}, 5*time.Millisecond, log.New(&logs, "", 0))
+
+	if nextUpdate(t, watcher) != confB {
+		t.Error("[TestWatcher] invalid update")
+	}
+	if !strings.Contains(logs.String(), errLoad.Error()) {
+		t.Error("[TestWatcher] error is not logged by the logger")
+	}
+	noUpdate(t, watcher, 30*time.Millisecond)
+
+	// Config is not loaded and updates are closed after closing
+	watcher.Close()
+	watcher.Close()
+	select {
+	case _, isOk := <-watcher.Updates():
+		if isOk {
+			t.Error("[TestWatcher] config is notified after closing")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("[TestWatcher] updates are not closed")
+	}
+	mutex.Lock()
+	numberLoad := number
+	mutex.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if number != numberLoad {
+		t.Error("[TestWatcher] config is loaded after closing")
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	conf := newTestConfig(t)
+	filePath := filepath.Join(t.TempDir(), "cso_key.yaml")
+	writeConfig := func(name string, modTime time.Time) {
+		data := "pid: " + conf.GetProjectID() + "\nptoken: " + conf.GetProjectToken() + "\ncname: " + name + "\ncsoaddr: http://proxy\n"
+		if err := ioutil.WriteFile(filePath, []byte(data), 0600); err != nil {
+			t.Fatal("[TestFileWatcher] write file failed")
+		}
+		os.Chtimes(filePath, modTime, modTime)
+	}
+	modTime := time.Now().Add(-time.Hour)
+	writeConfig("a", modTime)
+
+	var logs syncBuffer
+	watcher := NewFileWatcher(filePath, 5*time.Millisecond, log.New(&logs, "", 0))
+	defer watcher.Close()
+	noUpdate(t, watcher, 30*time.Millisecond)
+
+	modTime = modTime.Add(time.Second)
+	writeConfig("b", modTime)
+	if updated := nextUpdate(t, watcher); updated.GetConnectionName() != "b" {
+		t.Error("[TestFileWatcher] invalid update")
+	}
+
+	// Invalid files are logged and skipped
+	modTime = modTime.Add(time.Second)
+	ioutil.WriteFile(filePath, []byte("pid: [invalid"), 0600)
+	os.Chtimes(filePath, modTime, modTime)
+	noUpdate(t, watcher, 30*time.Millisecond)
+	if !strings.Contains(logs.String(), "Error reload config") {
+		t.Error("[TestFileWatcher] error is not logged by the logger")
+	}
+
+	// A nil logger disables logging
+	silent := NewFileWatcher(filepath.Join(t.TempDir(), "missing.json"), 5*time.Millisecond, nil)
+	noUpdate(t, silent, 20*time.Millisecond)
+	silent.Close()
+}
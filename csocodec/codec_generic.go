@@ -0,0 +1,89 @@
+package csocodec
+
+import (
+	"context"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Schemer is implemented by values which declare their schema name
+type Schemer interface {
+	Schema() string
+}
+
+// SchemaOf returns schema name of value
+// The name is taken from Schemer, then the full name of a proto.Message, then the Go type name with its package path
+// Pointers are dereferenced, so T and *T have the same schema name
+func SchemaOf(value interface{}) string {
+	switch val := value.(type) {
+	case Schemer:
+		return val.Schema()
+	case proto.Message:
+		return string(val.ProtoReflect().Descriptor().FullName())
+	case nil:
+		return ""
+	}
+	typ := reflect.TypeOf(value)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Name() == "" || typ.PkgPath() == "" {
+		// Unnamed and predeclared types have no package path
+		return typ.String()
+	}
+	return typ.PkgPath() + "." + typ.Name()
+}
+
+// Send sends value to a connection with schema name of T
+func Send[T any](ctx context.Context, client Client, recvName string, value T, isEncrypted, isCached bool) error {
+	return client.Send(ctx, recvName, schemaOfType[T](), value, isEncrypted, isCached)
+}
+
+// SendGroup sends value to a group with schema name of T
+func SendGroup[T any](ctx context.Context, client Client, groupName string, value T, isEncrypted, isCached bool) error {
+	return client.SendGroup(ctx, groupName, schemaOfType[T](), value, isEncrypted, isCached)
+}
+
+// SendAndRetry sends value to a connection with schema name of T, the message is resent until receiving a response
+func SendAndRetry[T any](ctx context.Context, client Client, recvName string, value T, isEncrypted bool, numberRetry int32) error {
+	return client.SendAndRetry(ctx, recvName, schemaOfType[T](), value, isEncrypted, numberRetry)
+}
+
+// SendGroupAndRetry sends value to a group with schema name of T, the message is resent until receiving a response
+func SendGroupAndRetry[T any](ctx context.Context, client Client, groupName string, value T, isEncrypted bool, numberRetry int32) error {
+	return client.SendGroupAndRetry(ctx, groupName, schemaOfType[T](), value, isEncrypted, numberRetry)
+}
+
+// Handle registers handler for messages with schema name of T
+func Handle[T any](client Client, handler func(ctx context.Context, sender string, value T) error) {
+	client.Handle(schemaOfType[T](), func(ctx context.Context, sender string, msg *Message) error {
+		value, err := decode[T](msg)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, sender, value)
+	})
+}
+
+func schemaOfType[T any]() string {
+	return SchemaOf(newValue[T]())
+}
+
+// newValue returns zero value of T, pointer types are allocated so they can be decoded into
+func newValue[T any]() T {
+	var value T
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Ptr {
+		value = reflect.New(typ.Elem()).Interface().(T)
+	}
+	return value
+}
+
+func decode[T any](msg *Message) (T, error) {
+	value := newValue[T]()
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() == reflect.Ptr {
+		return value, msg.Decode(value)
+	}
+	return value, msg.Decode(&value)
+}
@@ -0,0 +1,172 @@
+package csocodec
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gecosys/cso-client-golang/csoconnector"
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+var (
+	// ErrUnsupportedContentType is reported by Dispatch when no codec is registered for content type of a message
+	ErrUnsupportedContentType = errors.New("Unsupported content type")
+	// ErrNoHandler is reported by Dispatch when no handler is registered for schema of a message
+	ErrNoHandler = errors.New("No handler for schema")
+)
+
+type clientImpl struct {
+	connector      csoconnector.Connector
+	codec          Codec
+	mutex          sync.RWMutex
+	codecs         map[string]Codec
+	handlers       map[string]Handler
+	defaultHandler Handler
+	errorHandler   ErrorHandler
+}
+
+// NewClient inits a new instance of Client interface
+// Values are sent by codec, received values are decoded by the codec of their content type
+// JSON, Protobuf and MessagePack codecs are registered by default
+func NewClient(connector csoconnector.Connector, codec Codec) Client {
+	return NewClientWithErrorHandler(connector, codec, nil)
+}
+
+// NewClientWithErrorHandler inits a new instance of Client interface which notifies errorHandler
+// of received messages which are acknowledged without handling (ErrUnsupportedContentType, ErrNoHandler)
+func NewClientWithErrorHandler(connector csoconnector.Connector, codec Codec, errorHandler ErrorHandler) Client {
+	if codec == nil {
+		codec = NewJSONCodec()
+	}
+	client := &clientImpl{
+		connector:    connector,
+		codec:        codec,
+		codecs:       make(map[string]Codec),
+		handlers:     make(map[string]Handler),
+		errorHandler: errorHandler,
+	}
+	client.RegisterCodec(NewJSONCodec())
+	client.RegisterCodec(NewProtobufCodec())
+	client.RegisterCodec(NewMsgPackCodec())
+	client.RegisterCodec(codec)
+	return client
+}
+
+func (client *clientImpl) GetConnector() csoconnector.Connector {
+	return client.connector
+}
+
+func (client *clientImpl) RegisterCodec(codec Codec) {
+	client.mutex.Lock()
+	client.codecs[codec.ContentType()] = codec
+	client.mutex.Unlock()
+}
+
+func (client *clientImpl) Listen() error {
+	return client.connector.ListenWithContext(client.Dispatch)
+}
+
+// Dispatch decodes envelope of data and invokes the handler of its schema
+// Messages without envelope are decoded by the default codec and go to the default handler
+// Messages which can not be decoded or handled are acknowledged and reported to the error handler,
+// because resending never changes the result
+// An error returned by the handler leaves the message unacknowledged, so it is resent by the sender
+func (client *clientImpl) Dispatch(ctx context.Context, sender string, data []byte) error {
+	env, err := envelope.Unwrap(data)
+	if err != nil {
+		env = &envelope.Envelope{Data: data}
+	}
+
+	client.mutex.RLock()
+	codec := client.codec
+	if env.ContentType != "" {
+		codec = client.codecs[env.ContentType]
+	}
+	handler, isExisted := client.handlers[env.Schema]
+	if !isExisted {
+		handler = client.defaultHandler
+	}
+	client.mutex.RUnlock()
+
+	if codec == nil {
+		client.reportError(ctx, sender, ErrUnsupportedContentType)
+		return nil
+	}
+	if handler == nil {
+		client.reportError(ctx, sender, ErrNoHandler)
+		return nil
+	}
+	return handler(ctx, sender, &Message{
+		ContentType: codec.ContentType(),
+		Schema:      env.Schema,
+		Data:        env.Data,
+		codec:       codec,
+	})
+}
+
+func (client *clientImpl) reportError(ctx context.Context, sender string, err error) {
+	if client.errorHandler != nil {
+		client.errorHandler(ctx, sender, err)
+	}
+}
+
+func (client *clientImpl) Handle(schema string, handler Handler) {
+	client.mutex.Lock()
+	client.handlers[schema] = handler
+	client.mutex.Unlock()
+}
+
+func (client *clientImpl) HandleDefault(handler Handler) {
+	client.mutex.Lock()
+	client.defaultHandler = handler
+	client.mutex.Unlock()
+}
+
+func (client *clientImpl) Send(ctx context.Context, recvName, schema string, value interface{}, isEncrypted, isCached bool) error {
+	content, err := client.encode(schema, value)
+	if err != nil {
+		return err
+	}
+	return client.connector.SendMessageCtx(ctx, recvName, content, isEncrypted, isCached)
+}
+
+func (client *clientImpl) SendGroup(ctx context.Context, groupName, schema string, value interface{}, isEncrypted, isCached bool) error {
+	content, err := client.encode(schema, value)
+	if err != nil {
+		return err
+	}
+	return client.connector.SendGroupMessageCtx(ctx, groupName, content, isEncrypted, isCached)
+}
+
+func (client *clientImpl) SendAndRetry(ctx context.Context, recvName, schema string, value interface{}, isEncrypted bool, numberRetry int32) error {
+	content, err := client.encode(schema, value)
+	if err != nil {
+		return err
+	}
+	return client.connector.SendMessageAndRetryCtx(ctx, recvName, content, isEncrypted, numberRetry)
+}
+
+func (client *clientImpl) SendGroupAndRetry(ctx context.Context, groupName, schema string, value interface{}, isEncrypted bool, numberRetry int32) error {
+	content, err := client.encode(schema, value)
+	if err != nil {
+		return err
+	}
+	return client.connector.SendGroupMessageAndRetryCtx(ctx, groupName, content, isEncrypted, numberRetry)
+}
+
+func (client *clientImpl) encode(schema string, value interface{}) ([]byte, error) {
+	if schema == "" {
+		return nil, errors.New("Schema is empty")
+	}
+	data, err := client.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	env := &envelope.Envelope{
+		ContentType: client.codec.ContentType(),
+		Schema:      schema,
+		Data:        data,
+	}
+	return env.IntoBytes()
+}
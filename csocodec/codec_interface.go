@@ -0,0 +1,37 @@
+package csocodec
+
+import (
+	"context"
+
+	"github.com/gecosys/cso-client-golang/csoconnector"
+)
+
+// Codec marshals/unmarshals values of messages
+type Codec interface {
+	ContentType() string
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, value interface{}) error
+}
+
+// Client sends/receives typed values over a Connector
+type Client interface {
+	GetConnector() csoconnector.Connector
+	RegisterCodec(codec Codec)
+
+	// Listen opens the connection and dispatches received messages to handlers
+	Listen() error
+	Dispatch(ctx context.Context, sender string, data []byte) error
+	Handle(schema string, handler Handler)
+	HandleDefault(handler Handler)
+
+	Send(ctx context.Context, recvName, schema string, value interface{}, isEncrypted, isCached bool) error
+	SendGroup(ctx context.Context, groupName, schema string, value interface{}, isEncrypted, isCached bool) error
+	SendAndRetry(ctx context.Context, recvName, schema string, value interface{}, isEncrypted bool, numberRetry int32) error
+	SendGroupAndRetry(ctx context.Context, groupName, schema string, value interface{}, isEncrypted bool, numberRetry int32) error
+}
+
+// Handler processes a received message
+type Handler func(ctx context.Context, sender string, msg *Message) error
+
+// ErrorHandler is notified of a received message which is acknowledged without handling
+type ErrorHandler func(ctx context.Context, sender string, err error)
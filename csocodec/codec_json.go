@@ -0,0 +1,25 @@
+package csocodec
+
+import jsoniter "github.com/json-iterator/go"
+
+// ContentTypeJSON is content type of JSON codec
+const ContentTypeJSON = "application/json"
+
+type jsonCodec struct{}
+
+// NewJSONCodec inits a new instance of Codec interface using JSON
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return jsoniter.ConfigFastest.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, value interface{}) error {
+	return jsoniter.ConfigFastest.Unmarshal(data, value)
+}
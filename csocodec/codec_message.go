@@ -0,0 +1,14 @@
+package csocodec
+
+// Message is a received message with information of its encoding
+type Message struct {
+	ContentType string
+	Schema      string
+	Data        []byte
+	codec       Codec
+}
+
+// Decode unmarshals data of the message into value
+func (msg *Message) Decode(value interface{}) error {
+	return msg.codec.Unmarshal(msg.Data, value)
+}
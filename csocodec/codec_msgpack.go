@@ -0,0 +1,25 @@
+package csocodec
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// ContentTypeMsgPack is content type of MessagePack codec
+const ContentTypeMsgPack = "application/msgpack"
+
+type msgpackCodec struct{}
+
+// NewMsgPackCodec inits a new instance of Codec interface using MessagePack
+func NewMsgPackCodec() Codec {
+	return msgpackCodec{}
+}
+
+func (msgpackCodec) ContentType() string {
+	return ContentTypeMsgPack
+}
+
+func (msgpackCodec) Marshal(value interface{}) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, value interface{}) error {
+	return msgpack.Unmarshal(data, value)
+}
@@ -0,0 +1,38 @@
+package csocodec
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeProtobuf is content type of Protobuf codec
+const ContentTypeProtobuf = "application/x-protobuf"
+
+type protobufCodec struct{}
+
+// NewProtobufCodec inits a new instance of Codec interface using Protobuf
+// Values must implement proto.Message
+func NewProtobufCodec() Codec {
+	return protobufCodec{}
+}
+
+func (protobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protobufCodec) Marshal(value interface{}) ([]byte, error) {
+	msg, isOk := value.(proto.Message)
+	if !isOk {
+		return nil, errors.New("Value is not a proto.Message")
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, value interface{}) error {
+	msg, isOk := value.(proto.Message)
+	if !isOk {
+		return errors.New("Value is not a proto.Message")
+	}
+	return proto.Unmarshal(data, msg)
+}
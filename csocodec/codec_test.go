@@ -0,0 +1,115 @@
+package csocodec
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/csoconnector"
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+var errTestHandler = errors.New("handler failed")
+
+type command struct {
+	Name  string `json:"name" msgpack:"name"`
+	Value int    `json:"value" msgpack:"value"`
+}
+
+// fakeConnector keeps content of the last sent message
+type fakeConnector struct {
+	csoconnector.Connector
+	recvName string
+	content  []byte
+}
+
+func (connector *fakeConnector) SendMessageCtx(ctx context.Context, recvName string, content []byte, isEncrypted, isCached bool) error {
+	connector.recvName = recvName
+	connector.content = content
+	return nil
+}
+
+func TestSchemaOf(t *testing.T) {
+	const schema = "github.com/gecosys/cso-client-golang/csocodec.command"
+	if SchemaOf(command{}) != schema {
+		t.Error("[TestSchemaOf] invalid schema of struct")
+	}
+	if SchemaOf(&command{}) != schema {
+		t.Error("[TestSchemaOf] invalid schema of pointer")
+	}
+	if schemaOfType[command]() != schema || schemaOfType[*command]() != schema {
+		t.Error("[TestSchemaOf] invalid schema of type")
+	}
+	if SchemaOf(1) != "int" || SchemaOf([]command{}) != "[]csocodec.command" {
+		t.Error("[TestSchemaOf] invalid schema of unnamed type")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	codecs := []Codec{NewJSONCodec(), NewMsgPackCodec()}
+	for _, codec := range codecs {
+		connector := &fakeConnector{}
+		sender := NewClient(connector, codec)
+		receiver := NewClient(nil, NewJSONCodec())
+
+		var received *command
+		Handle(receiver, func(ctx context.Context, sender string, value *command) error {
+			received = value
+			return nil
+		})
+
+		err := Send(context.Background(), sender, "receiver", command{Name: "open", Value: 1}, false, false)
+		if err != nil || connector.recvName != "receiver" {
+			t.Fatal("[TestRoundTrip] send failed")
+		}
+		err = receiver.Dispatch(context.Background(), "sender", connector.content)
+		if err != nil {
+			t.Errorf("[TestRoundTrip] dispatch failed by %s", codec.ContentType())
+		}
+		if received == nil || received.Name != "open" || received.Value != 1 {
+			t.Errorf("[TestRoundTrip] invalid value decoded by %s", codec.ContentType())
+		}
+	}
+}
+
+func TestDispatchError(t *testing.T) {
+	var reported error
+	client := NewClientWithErrorHandler(nil, NewJSONCodec(), func(ctx context.Context, sender string, err error) {
+		reported = err
+	})
+	Handle(client, func(ctx context.Context, sender string, value *command) error {
+		return nil
+	})
+
+	content, _ := (&envelope.Envelope{
+		ContentType: "application/unknown",
+		Schema:      SchemaOf(command{}),
+		Data:        []byte("{}"),
+	}).IntoBytes()
+	if client.Dispatch(context.Background(), "sender", content) != nil || reported != ErrUnsupportedContentType {
+		t.Error("[TestDispatchError] unknown content type is not acknowledged and reported")
+	}
+
+	content, _ = (&envelope.Envelope{
+		ContentType: ContentTypeJSON,
+		Schema:      "unknown",
+		Data:        []byte("{}"),
+	}).IntoBytes()
+	if client.Dispatch(context.Background(), "sender", content) != nil || reported != ErrNoHandler {
+		t.Error("[TestDispatchError] missing handler is not acknowledged and reported")
+	}
+
+	// Errors of handlers leave messages unacknowledged
+	reported = nil
+	client.HandleDefault(func(ctx context.Context, sender string, msg *Message) error {
+		return errTestHandler
+	})
+	if client.Dispatch(context.Background(), "sender", content) != errTestHandler || reported != nil {
+		t.Error("[TestDispatchError] default handler is not invoked")
+	}
+
+	// Messages are acknowledged without an error handler
+	if NewClient(nil, NewJSONCodec()).Dispatch(context.Background(), "sender", content) != nil {
+		t.Error("[TestDispatchError] message without handler is not acknowledged")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"math"
 	"net"
+	"sync/atomic"
+	"time"
 )
 
 // HeaderSize is size of header
@@ -16,14 +18,22 @@ const BufferSize = 1204
 type connectionImpl struct {
 	status        Status
 	socket        net.Conn
+	dialTimeout   time.Duration
 	chNextMessage chan []byte // receive from server
+	isWriteClosed int32       // 1 after CloseWrite until the next Connect
 }
 
 // NewConnection inits a new instance of Connection interface
 func NewConnection(bufferSize int32) Connection {
+	return NewConnectionWithTimeout(bufferSize, 0)
+}
+
+// NewConnectionWithTimeout inits a new instance of Connection interface which gives up dialing after dialTimeout
+func NewConnectionWithTimeout(bufferSize int32, dialTimeout time.Duration) Connection {
 	return &connectionImpl{
 		status:        StatusPrepare,
 		socket:        nil,
+		dialTimeout:   dialTimeout,
 		chNextMessage: make(chan []byte, bufferSize),
 	}
 }
@@ -35,12 +45,13 @@ func (conn *connectionImpl) Connect(address string) error {
 	}
 
 	conn.status = StatusConnecting
-	socket, err := net.Dial("tcp", address)
+	socket, err := net.DialTimeout("tcp", address, conn.dialTimeout)
 	if err != nil {
 		conn.status = StatusPrepare
 		return err
 	}
 	conn.socket = socket
+	atomic.StoreInt32(&conn.isWriteClosed, 0)
 	conn.status = StatusConnected
 	return nil
 }
@@ -112,6 +123,9 @@ func (conn *connectionImpl) SendMessage(data []byte) error {
 	if conn.status != StatusConnected {
 		return errors.New("The conenction closed")
 	}
+	if atomic.LoadInt32(&conn.isWriteClosed) == 1 {
+		return errors.New("The connection is closed for sending")
+	}
 
 	// Build formated data
 	lenBytes := len(data)
@@ -144,3 +158,28 @@ func (conn *connectionImpl) SendMessage(data []byte) error {
 func (conn *connectionImpl) GetReadChannel() (<-chan []byte, error) {
 	return conn.chNextMessage, nil
 }
+
+func (conn *connectionImpl) GetStatus() Status {
+	return conn.status
+}
+
+// Close closes the socket, LoopListen returns after that
+func (conn *connectionImpl) Close() error {
+	if conn.socket == nil {
+		return nil
+	}
+	return conn.socket.Close()
+}
+
+// CloseWrite stops sending, LoopListen returns after the server closes the connection
+func (conn *connectionImpl) CloseWrite() error {
+	if conn.socket == nil {
+		return nil
+	}
+	atomic.StoreInt32(&conn.isWriteClosed, 1)
+	socket, isOk := conn.socket.(*net.TCPConn)
+	if !isOk {
+		return conn.socket.Close()
+	}
+	return socket.CloseWrite()
+}
@@ -6,4 +6,15 @@ type Connection interface {
 	LoopListen() error
 	SendMessage(data []byte) error
 	GetReadChannel() (<-chan []byte, error)
+	Close() error
+}
+
+// StatusConnection is implemented by connections which report their status, the connector exports it as a metric
+type StatusConnection interface {
+	GetStatus() Status
+}
+
+// HalfCloseConnection is implemented by connections which stop sending and keep receiving until the server closes them
+type HalfCloseConnection interface {
+	CloseWrite() error
 }
@@ -0,0 +1,184 @@
+package csoconnector
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+	"github.com/gecosys/cso-client-golang/csoproxy"
+)
+
+var (
+	testPublicKeyOnce sync.Once
+	testPublicKey     string
+)
+
+// newValidConfig returns a config which passes config.Validate
+func newValidConfig(t *testing.T, name string, addresses ...string) config.Config {
+	testPublicKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			return
+		}
+		pubKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		testPublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKey}))
+	})
+	if testPublicKey == "" {
+		t.Fatal("[newValidConfig] generate key failed")
+	}
+	if len(addresses) == 1 {
+		return config.NewConfig("project", "dG9rZW4=", name, testPublicKey, addresses[0])
+	}
+	endpoints := make([]config.Endpoint, len(addresses))
+	for idx, addr := range addresses {
+		endpoints[idx] = config.Endpoint{Address: addr, Priority: int32(idx)}
+	}
+	return config.NewConfigWithEndpoints("project", "dG9rZW4=", name, testPublicKey, endpoints)
+}
+
+// fakeWatcher notifies configs which are pushed by tests
+type fakeWatcher struct {
+	chUpdates chan config.Config
+}
+
+func (watcher *fakeWatcher) Updates() <-chan config.Config {
+	return watcher.chUpdates
+}
+
+func (watcher *fakeWatcher) Close() {
+	close(watcher.chUpdates)
+}
+
+func waitConnectionName(t *testing.T, connector Connector, name string) {
+	deadline := time.Now().Add(testTimeout)
+	for connector.GetConnectionName() != name {
+		if time.Now().After(deadline) {
+			t.Fatal("[waitConnectionName] timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver")
+	go connector.Listen(func(sender string, data []byte) error { return nil })
+	hub.activate()
+	waitActivated(t, connector)
+
+	// Invalid configs are rejected
+	if connector.UpdateConfig(config.NewConfig("project", "dG9rZW4=", "other", "", "http://proxy"), true) == nil {
+		t.Error("[TestUpdateConfig] invalid config is accepted")
+	}
+
+	// A config is applied at the next reconnect
+	err := connector.UpdateConfig(newValidConfig(t, "other", "http://proxy"), false)
+	if err != nil {
+		t.Fatalf("[TestUpdateConfig] update config failed: %s", err.Error())
+	}
+	hub.noMessage(50 * time.Millisecond)
+	if connector.GetConnectionName() != "receiver" || hub.numberConnect() != 1 {
+		t.Error("[TestUpdateConfig] config is applied before reconnecting")
+	}
+
+	err = connector.UpdateConfig(newValidConfig(t, "renamed", "http://proxy"), true)
+	if err != nil {
+		t.Fatalf("[TestUpdateConfig] update config failed: %s", err.Error())
+	}
+	hub.activate()
+	waitActivated(t, connector)
+	waitConnectionName(t, connector, "renamed")
+	if hub.numberConnect() != 2 || connector.proxy.(*fakeProxy).numberRegister() != 2 {
+		t.Error("[TestUpdateConfig] connection is not registered again")
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	watcher := &fakeWatcher{chUpdates: make(chan config.Config, 1)}
+	defer watcher.Close()
+	connector, hub := newTestConnector(t, "receiver", WithConfigWatcher(watcher, true))
+	go connector.Listen(func(sender string, data []byte) error { return nil })
+	hub.activate()
+	waitActivated(t, connector)
+
+	// Invalid configs are skipped
+	watcher.chUpdates <- config.NewConfig("project", "", "invalid", "", "http://proxy")
+	watcher.chUpdates <- newValidConfig(t, "renamed", "http://proxy")
+	hub.activate()
+	waitConnectionName(t, connector, "renamed")
+	if hub.numberConnect() != 2 {
+		t.Error("[TestConfigWatcher] invalid number of connections")
+	}
+}
+
+func TestUpdateConfigProxy(t *testing.T) {
+	connector := DefaultConnector(16, newValidConfig(t, "receiver", "http://a"), WithLogger(nil)).(*connectorImpl)
+	if _, isFailover := connector.proxy.(csoproxy.FailoverProxy); isFailover {
+		t.Error("[TestUpdateConfigProxy] failover proxy of a single Proxy server")
+	}
+
+	// One to many Proxy servers
+	connector.UpdateConfig(newValidConfig(t, "receiver", "http://a", "http://b"), false)
+	connector.applyPendingConfig()
+	proxy, isFailover := connector.proxy.(csoproxy.FailoverProxy)
+	if !isFailover || len(proxy.GetEndpoints()) != 2 {
+		t.Fatal("[TestUpdateConfigProxy] proxy does not fail over after config changes")
+	}
+
+	// Many Proxy servers are kept by the same proxy
+	connector.UpdateConfig(newValidConfig(t, "receiver", "http://a", "http://b", "http://c"), false)
+	connector.applyPendingConfig()
+	if connector.proxy != proxy || len(proxy.GetEndpoints()) != 3 {
+		t.Error("[TestUpdateConfigProxy] failover proxy is not updated")
+	}
+
+	// Many to one Proxy server
+	connector.UpdateConfig(newValidConfig(t, "receiver", "http://c"), false)
+	connector.applyPendingConfig()
+	if _, isFailover = connector.proxy.(csoproxy.FailoverProxy); isFailover {
+		t.Error("[TestUpdateConfigProxy] failover proxy is kept for a single Proxy server")
+	}
+
+	// A proxy of the caller is never replaced
+	custom, _ := newTestConnector(t, "receiver")
+	custom.UpdateConfig(newValidConfig(t, "receiver", "http://a", "http://b"), false)
+	custom.applyPendingConfig()
+	if _, isFake := custom.proxy.(*fakeProxy); !isFake {
+		t.Error("[TestUpdateConfigProxy] proxy of the caller is replaced")
+	}
+}
+
+func TestProxyHTTPTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer server.Close()
+	conf := newValidConfig(t, "connection", server.URL)
+
+	explicit := config.DefaultOptions()
+	explicit.SetKeys("http_timeout")
+	explicit.HTTPTimeout = config.Duration(testTimeout)
+	cases := []struct {
+		name      string
+		client    *http.Client
+		options   *config.Options
+		isTimeout bool
+	}{
+		{"injected client", &http.Client{Timeout: 50 * time.Millisecond}, config.DefaultOptions(), true},
+		{"explicit timeout", &http.Client{Timeout: 50 * time.Millisecond}, explicit, false},
+		{"default client", nil, config.DefaultOptions(), false},
+	}
+	for _, c := range cases {
+		begin := time.Now()
+		newProxy(conf, c.options, c.client).ExchangeKey()
+		if isTimeout := time.Since(begin) < 250*time.Millisecond; isTimeout != c.isTimeout {
+			t.Errorf("[TestProxyHTTPTimeout] invalid timeout of %s", c.name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package csoconnector
+
+import (
+	"github.com/gecosys/cso-client-golang/csocounter"
+	"github.com/gecosys/cso-client-golang/message/readyticket"
+)
+
+// getCounter returns the counter, nil before the first activation
+// The counter is published before the connector is activated, so senders which waited for activation always see it
+func (connector *connectorImpl) getCounter() csocounter.Counter {
+	counter, _ := connector.counter.Load().(csocounter.Counter)
+	return counter
+}
+
+// syncCounter creates the counter on the first activation
+// A persistent counter is reconciled with the Hub server on every activation
+func (connector *connectorImpl) syncCounter(ticket *readyticket.ReadyTicket) error {
+	current := connector.getCounter()
+	if current == nil {
+		var counter csocounter.Counter
+		if connector.counterStore == nil {
+			counter = csocounter.NewCounterWithWindow(
+				ticket.IdxWrite,
+				ticket.IdxRead,
+				ticket.MaskRead,
+				connector.options.ReplayWindow,
+			)
+		} else {
+			persistent, err := csocounter.NewPersistentCounter(connector.counterStore, ticket, connector.options.ReplayWindow)
+			if err != nil {
+				return err
+			}
+			counter = persistent
+		}
+		connector.counter.Store(counter)
+		return nil
+	}
+
+	if counter, ok := current.(csocounter.PersistentCounter); ok {
+		return counter.Reconcile(ticket)
+	}
+	return nil
+}
+
+// commitCounter saves the tag of a handled message if the counter is persistent
+// The message is still acknowledged on failure because it was handled, it is only unprotected against a restart
+func (connector *connectorImpl) commitCounter(msgTag uint64) {
+	counter, ok := connector.getCounter().(csocounter.PersistentCounter)
+	if !ok {
+		return
+	}
+	err := counter.Commit(msgTag)
+	if err != nil {
+		connector.logger.Printf("Error counter: %s", err.Error())
+	}
+}
@@ -0,0 +1,51 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+type e2eKey struct{}
+
+// ContextWithE2E returns ctx which encrypts messages end-to-end by the Encryptor set by WithE2E
+func ContextWithE2E(ctx context.Context) context.Context {
+	return context.WithValue(ctx, e2eKey{}, true)
+}
+
+func isE2EContext(ctx context.Context) bool {
+	isE2E, _ := ctx.Value(e2eKey{}).(bool)
+	return isE2E
+}
+
+// sealContent encrypts content for the receiver if ctx requires end-to-end encryption
+func (connector *connectorImpl) sealContent(ctx context.Context, name string, isGroup bool, content []byte) ([]byte, error) {
+	if !isE2EContext(ctx) {
+		return content, nil
+	}
+	if connector.e2e == nil {
+		return nil, errors.New("End-to-end encryption is not configured")
+	}
+	return connector.e2e.Seal(ctx, name, isGroup, content)
+}
+
+// openContent decrypts content which is encrypted end-to-end, other contents are returned as is
+func (connector *connectorImpl) openContent(ctx context.Context, info *MessageInfo, content []byte) ([]byte, error) {
+	if !envelope.IsEnvelope(content) {
+		return content, nil
+	}
+	env, err := envelope.ParseBytes(content)
+	if err != nil || len(env.Encryption) == 0 {
+		return content, nil
+	}
+	if connector.e2e == nil {
+		return nil, errors.New("End-to-end encryption is not configured")
+	}
+	content, err = connector.e2e.Open(ctx, info.Sender, env.Encryption, env.Data)
+	if err != nil {
+		return nil, err
+	}
+	info.IsE2E = true
+	return content, nil
+}
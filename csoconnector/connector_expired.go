@@ -0,0 +1,76 @@
+package csoconnector
+
+import (
+	"errors"
+
+	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/message/cipher"
+)
+
+var (
+	// ErrDeadlineExceeded is reported when a message is not acknowledged within its TTL
+	ErrDeadlineExceeded = errors.New("Message deadline exceeded")
+	// ErrRetryExhausted is reported when a message is not acknowledged after all retries
+	ErrRetryExhausted = errors.New("Message retries exhausted")
+)
+
+// ResponseHandler is notified of the first response of a message which is sent by a retry method
+// data is the response returned by the handler of the receiver (see ListenWithResponse), it is empty if there is none
+type ResponseHandler func(msgID uint64, recvName string, isGroup bool, data []byte)
+
+// ExpiredHandler is notified of a message which is removed from the retry queue without response
+// err is ErrDeadlineExceeded or ErrRetryExhausted
+type ExpiredHandler func(msgID uint64, recvName string, isGroup bool, err error)
+
+// pushPending pushes item into the retry queue and keeps it until it is answered or expired
+func (connector *connectorImpl) pushPending(item *csoqueue.ItemQueue) {
+	connector.queueMessages.PushMessage(item)
+	connector.pending[item.MsgID] = item
+}
+
+// clearPending removes the item answered by msg from the retry queue and notifies the response handler
+// Responses of items which are already answered or expired are ignored
+func (connector *connectorImpl) clearPending(msg *cipher.Cipher) {
+	connector.queueMessages.ClearMessage(msg.MessageID)
+	item, isPending := connector.pending[msg.MessageID]
+	if !isPending {
+		return
+	}
+	delete(connector.pending, msg.MessageID)
+	if connector.responseHandler != nil {
+		connector.responseHandler(item.MsgID, item.RecvName, item.IsGroup, msg.Data)
+	}
+}
+
+// hasSentItems checks if any item of the retry queue was sent and waits for its response
+func (connector *connectorImpl) hasSentItems() bool {
+	for _, item := range connector.pending {
+		if item.NumberSent > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reportExpiredMessages counts messages removed from the retry queue and notifies the expired handler
+// It returns true if any message was removed, queues which do not implement csoqueue.ExpiringQueue remove nothing
+func (connector *connectorImpl) reportExpiredMessages() bool {
+	queue, isOk := connector.queueMessages.(csoqueue.ExpiringQueue)
+	if !isOk {
+		return false
+	}
+	items := queue.ExpiredMessages()
+	for _, item := range items {
+		delete(connector.pending, item.MsgID)
+		connector.metrics.MessageExpired()
+		if connector.expiredHandler == nil {
+			continue
+		}
+		err := ErrRetryExhausted
+		if item.IsDeadlineExceeded {
+			err = ErrDeadlineExceeded
+		}
+		connector.expiredHandler(item.MsgID, item.RecvName, item.IsGroup, err)
+	}
+	return len(items) > 0
+}
@@ -0,0 +1,130 @@
+package csoconnector
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/message/groupnotice"
+)
+
+// GroupNoticeHandler is notified of membership changes of groups which the connection belongs to
+// The handler is invoked on the listening goroutine, so it must not block
+type GroupNoticeHandler func(notice *groupnotice.GroupNotice)
+
+// groupCache is the client-side cache of groups of the connection
+type groupCache struct {
+	mutex    sync.RWMutex
+	groups   map[string]struct{}
+	isLoaded bool // groups were loaded from the Proxy server
+}
+
+func newGroupCache() *groupCache {
+	return &groupCache{groups: make(map[string]struct{})}
+}
+
+func (cache *groupCache) set(groups []string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.groups = make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		cache.groups[group] = struct{}{}
+	}
+	cache.isLoaded = true
+}
+
+func (cache *groupCache) update(groupName string, isMember bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if isMember {
+		cache.groups[groupName] = struct{}{}
+	} else {
+		delete(cache.groups, groupName)
+	}
+}
+
+// contains checks if the connection is a member of groupName, isLoaded is false if groups are unknown
+func (cache *groupCache) contains(groupName string) (isMember bool, isLoaded bool) {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	_, isMember = cache.groups[groupName]
+	return isMember, cache.isLoaded
+}
+
+func (cache *groupCache) list() ([]string, bool) {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	if !cache.isLoaded {
+		return nil, false
+	}
+	groups := make([]string, 0, len(cache.groups))
+	for group := range cache.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, true
+}
+
+func (cache *groupCache) reset() {
+	cache.mutex.Lock()
+	cache.groups = make(map[string]struct{})
+	cache.isLoaded = false
+	cache.mutex.Unlock()
+}
+
+func (connector *connectorImpl) JoinGroup(ctx context.Context, groupName string) error {
+	connector.mutexProxy.Lock()
+	groups, err := connector.proxy.JoinGroupContext(ctx, groupName)
+	connector.mutexProxy.Unlock()
+	if err != nil {
+		return err
+	}
+	connector.groups.set(groups)
+	return nil
+}
+
+func (connector *connectorImpl) LeaveGroup(ctx context.Context, groupName string) error {
+	connector.mutexProxy.Lock()
+	groups, err := connector.proxy.LeaveGroupContext(ctx, groupName)
+	connector.mutexProxy.Unlock()
+	if err != nil {
+		return err
+	}
+	connector.groups.set(groups)
+	return nil
+}
+
+// GetGroups returns groups of the connection from the cache
+// Groups are loaded from the Proxy server at the first call and after the config is changed
+func (connector *connectorImpl) GetGroups(ctx context.Context) ([]string, error) {
+	groups, isLoaded := connector.groups.list()
+	if isLoaded {
+		return groups, nil
+	}
+
+	connector.mutexProxy.Lock()
+	groups, err := connector.proxy.GetGroupsContext(ctx)
+	connector.mutexProxy.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	connector.groups.set(groups)
+	groups, _ = connector.groups.list()
+	return groups, nil
+}
+
+// handleGroupNotice updates the cache by a membership change of the connection and notifies the handler
+func (connector *connectorImpl) handleGroupNotice(msg *cipher.Cipher) {
+	notice, err := groupnotice.ParseBytes(msg.Data)
+	if err != nil {
+		connector.logger.Printf("Error group notice: %s", err.Error())
+		return
+	}
+	if notice.MemberName == connector.GetConnectionName() {
+		connector.groups.update(notice.GroupName, notice.Action == groupnotice.ActionJoin)
+	}
+	if connector.noticeHandler != nil {
+		connector.noticeHandler(notice)
+	}
+}
@@ -0,0 +1,97 @@
+package csoconnector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/message/groupnotice"
+)
+
+func TestGroupCache(t *testing.T) {
+	cache := newGroupCache()
+	if _, isLoaded := cache.contains("news"); isLoaded {
+		t.Error("[TestGroupCache] groups are loaded before the Proxy server is called")
+	}
+	if _, isLoaded := cache.list(); isLoaded {
+		t.Error("[TestGroupCache] groups are listed before the Proxy server is called")
+	}
+
+	cache.set([]string{"sports", "news"})
+	cache.update("weather", true)
+	cache.update("sports", false)
+	groups, isLoaded := cache.list()
+	if !isLoaded || !reflect.DeepEqual(groups, []string{"news", "weather"}) {
+		t.Errorf("[TestGroupCache] invalid groups %v", groups)
+	}
+	if isMember, _ := cache.contains("sports"); isMember {
+		t.Error("[TestGroupCache] left group is kept")
+	}
+
+	cache.reset()
+	if _, isLoaded := cache.list(); isLoaded {
+		t.Error("[TestGroupCache] groups are loaded after reset")
+	}
+}
+
+// deliverNotice sends a membership change of memberName to the connector
+func (hub *testHub) deliverNotice(action groupnotice.Action, groupName, memberName string) {
+	data, err := groupnotice.BuildBytes(action, groupName, memberName)
+	if err != nil {
+		hub.t.Fatal("[deliverNotice] build notice failed")
+	}
+	hub.deliverRaw(0, 0, cipher.TypeGroupNotice, "hub", data, nil)
+}
+
+func TestGroupNotice(t *testing.T) {
+	chNotice := make(chan *groupnotice.GroupNotice, 4)
+	connector, hub := newTestConnector(t, "receiver", WithGroupNoticeHandler(func(notice *groupnotice.GroupNotice) {
+		chNotice <- notice
+	}))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+	if err := connector.JoinGroup(context.Background(), "sports"); err != nil {
+		t.Fatal("[TestGroupNotice] join group failed")
+	}
+
+	cases := []struct {
+		name       string
+		action     groupnotice.Action
+		groupName  string
+		memberName string
+		groups     []string
+	}{
+		{"join of the connection", groupnotice.ActionJoin, "news", "receiver", []string{"news", "sports"}},
+		{"join of another member", groupnotice.ActionJoin, "weather", "other", []string{"news", "sports"}},
+		{"leave of the connection", groupnotice.ActionLeave, "sports", "receiver", []string{"news"}},
+	}
+	for _, c := range cases {
+		hub.deliverNotice(c.action, c.groupName, c.memberName)
+		select {
+		case notice := <-chNotice:
+			if notice.Action != c.action || notice.GroupName != c.groupName || notice.MemberName != c.memberName {
+				t.Errorf("[TestGroupNotice] invalid notice of %s", c.name)
+			}
+		case <-hub.timeout():
+			t.Fatalf("[TestGroupNotice] notice of %s is not handled", c.name)
+		}
+		groups, err := connector.GetGroups(context.Background())
+		if err != nil || !reflect.DeepEqual(groups, c.groups) {
+			t.Errorf("[TestGroupNotice] invalid groups after %s: %v", c.name, groups)
+		}
+	}
+
+	// Invalid notices are skipped and notices are not acknowledged
+	hub.deliverRaw(0, 0, cipher.TypeGroupNotice, "hub", []byte{0x03, 0x01, 'a', 'b'}, nil)
+	select {
+	case <-chNotice:
+		t.Error("[TestGroupNotice] invalid notice is handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	hub.noMessage(50 * time.Millisecond)
+}
@@ -1,62 +1,189 @@
 package csoconnector
 
 import (
+	"context"
 	"errors"
+	"io"
 	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gecosys/cso-client-golang/config"
 	"github.com/gecosys/cso-client-golang/csoconnection"
 	"github.com/gecosys/cso-client-golang/csocounter"
+	"github.com/gecosys/cso-client-golang/csoe2e"
+	"github.com/gecosys/cso-client-golang/csoidempotency"
+	"github.com/gecosys/cso-client-golang/csolimiter"
+	"github.com/gecosys/cso-client-golang/csometrics"
 	"github.com/gecosys/cso-client-golang/csoparser"
 	"github.com/gecosys/cso-client-golang/csoproxy"
 	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/csosignature"
+	"github.com/gecosys/cso-client-golang/csotracing"
 	"github.com/gecosys/cso-client-golang/message/cipher"
 	"github.com/gecosys/cso-client-golang/message/readyticket"
 )
 
 type connectorImpl struct {
-	isActivated    bool
-	counter        csocounter.Counter
-	conn           csoconnection.Connection
-	chWriteMessage chan *csoqueue.ItemQueue
-	queueMessages  csoqueue.Queue
-	parser         csoparser.Parser
-	proxy          csoproxy.Proxy
-	conf           config.Config
+	isActivated      int32        // 1 if the connector is activated, read by sending goroutines
+	counter          atomic.Value // csocounter.Counter, created by the listening goroutine and read by sending goroutines
+	conn             csoconnection.Connection
+	chWriteMessage   chan *csoqueue.ItemQueue
+	queueMessages    csoqueue.Queue
+	parser           csoparser.Parser
+	proxy            csoproxy.Proxy
+	isOwnProxy       bool // the proxy is created by the connector, so it follows the number of Proxy servers of the config
+	conf             config.Config
+	options          *config.Options
+	logger           *log.Logger
+	metrics          csometrics.Metrics
+	connectedAt      atomic.Int64 // unix nanoseconds, used to measure activation latency
+	tracer           csotracing.Tracer
+	tracePeers       map[string]bool // connections and groups which receive trace context
+	mutexSpan        sync.Mutex
+	activationSpan   csotracing.Span
+	serverTicket     *csoproxy.ServerTicket // cached ticket for session resumption, only used by loopReconnect
+	isResumedSession int32                  // 1 if the current session uses the cached ticket
+	isRejected       int32                  // 1 if the Hub server rejected the current ticket
+	mutexConf        sync.Mutex
+	pendingConf      config.Config // applied at the next reconnect
+	watcher          config.Watcher
+	isForcedReload   bool // reconnect immediately when the watcher notifies a new config
+	counterStore     csocounter.Store
+	responseCache    csoidempotency.Cache
+	expiredHandler   ExpiredHandler
+	responseHandler  ResponseHandler
+	offline          *offlineBuffer // nil if the offline buffer is disabled
+	e2e              csoe2e.Encryptor
+	signer           csosignature.Signer
+	verifier         csosignature.Verifier
+	signaturePolicy  csosignature.Policy
+	limiter          csolimiter.Limiter
+	activation       *signal // broadcast when the connector is activated
+	queueSpace       *signal // broadcast when items leave the retry queue
+	httpClient       *http.Client
+	sharedTick       <-chan time.Time // ticks of a Manager, nil if the connector owns its timer
+	rotation         *keyRotation     // nil if key rotation is disabled
+	mutexProxy       sync.Mutex       // the proxy is used by loopReconnect, key rotation and group methods
+	groups           *groupCache
+	noticeHandler    GroupNoticeHandler
+	pending          map[uint64]*csoqueue.ItemQueue // items of the retry queue by ID, only used by the listening goroutine
+	optionErrors     []error                        // invalid options which are skipped, logged by setup
 }
 
 // DefaultConnector inits a new instance of Connector interface with default values
-func DefaultConnector(bufferSize int32, conf config.Config) Connector {
-	return &connectorImpl{
-		isActivated:    false,
-		counter:        nil,
-		conn:           csoconnection.NewConnection(bufferSize),
-		chWriteMessage: make(chan *csoqueue.ItemQueue),
-		queueMessages:  csoqueue.NewQueue(bufferSize),
-		parser:         csoparser.NewParser(),
-		proxy:          csoproxy.NewProxy(conf),
-		conf:           conf,
-	}
+// bufferSize is the default size of the queue and the channel of received messages
+func DefaultConnector(bufferSize int32, conf config.Config, opts ...Option) Connector {
+	connector := newConnector(bufferSize, conf, opts)
+	connector.queueMessages = csoqueue.NewPriorityQueue(
+		connector.options.QueueSize,
+		[csoqueue.NumberPriorities]int32{
+			connector.options.QueueSizeLow,
+			connector.options.QueueSizeNormal,
+			connector.options.QueueSizeHigh,
+		},
+		time.Duration(connector.options.ResendInterval),
+		connector.options.StarvationLimit,
+	)
+	connector.parser = csoparser.NewParser()
+	connector.proxy = newProxy(conf, connector.options, connector.httpClient)
+	connector.isOwnProxy = true
+	connector.setup()
+	return connector
 }
 
 // NewConnector inits a new instance of Connector interface
-func NewConnector(bufferSize int32, queue csoqueue.Queue, parser csoparser.Parser, proxy csoproxy.Proxy, conf config.Config) Connector {
-	return &connectorImpl{
-		isActivated:    false,
-		counter:        nil,
-		conn:           csoconnection.NewConnection(bufferSize),
-		chWriteMessage: make(chan *csoqueue.ItemQueue),
-		queueMessages:  queue,
-		parser:         parser,
-		proxy:          proxy,
-		conf:           conf,
+// Options of the queue and the proxy are not applied to the given queue and proxy
+func NewConnector(bufferSize int32, queue csoqueue.Queue, parser csoparser.Parser, proxy csoproxy.Proxy, conf config.Config, opts ...Option) Connector {
+	connector := newConnector(bufferSize, conf, opts)
+	connector.queueMessages = queue
+	connector.parser = parser
+	connector.proxy = proxy
+	connector.setup()
+	return connector
+}
+
+func newConnector(bufferSize int32, conf config.Config, opts []Option) *connectorImpl {
+	options := config.DefaultOptions()
+	options.QueueSize = bufferSize
+	options.BufferSize = bufferSize
+
+	connector := &connectorImpl{
+		isActivated: 0,
+		conf:        conf,
+		options:     options,
+		logger:      log.Default(),
+		metrics:     csometrics.NewNoopMetrics(),
+		tracer:      csotracing.NewNoopTracer(),
+		activation:  newSignal(),
+		queueSpace:  newSignal(),
+		groups:      newGroupCache(),
+		verifier:    csosignature.NewVerifier(nil, 0, 0),
+		pending:     make(map[uint64]*csoqueue.ItemQueue),
+	}
+	for _, opt := range opts {
+		opt(connector)
+	}
+	if connector.options.DisableLogging {
+		connector.logger = log.New(io.Discard, "", 0)
+	}
+	connector.conn = csoconnection.NewConnectionWithTimeout(
+		connector.options.BufferSize,
+		time.Duration(connector.options.DialTimeout),
+	)
+	// Items are counted by the queue before they are written to the channel, so writing rarely blocks
+	connector.chWriteMessage = make(chan *csoqueue.ItemQueue, connector.options.QueueSize)
+	if connector.isKeyRotationEnabled() {
+		connector.rotation = newKeyRotation()
+	}
+	if connector.options.OfflineBufferSize > 0 {
+		connector.offline = newOfflineBuffer(
+			connector.options.OfflineBufferSize,
+			connector.options.OfflineBufferBytes,
+			time.Duration(connector.options.OfflineBufferAge),
+		)
+	}
+	return connector
+}
+
+// setup applies options to components of the connector
+func (connector *connectorImpl) setup() {
+	for _, err := range connector.optionErrors {
+		connector.logger.Printf("Error options: %s", err.Error())
+	}
+	if connector.options.Compression != "" {
+		parser, isOk := connector.parser.(csoparser.CompressionParser)
+		if !isOk {
+			connector.logger.Printf("Error compression: the parser does not support compression")
+			return
+		}
+		err := parser.SetCompression(connector.options.Compression, connector.options.CompressionThreshold)
+		if err != nil {
+			connector.logger.Printf("Error compression: %s", err.Error())
+		}
 	}
 }
 
 func (connector *connectorImpl) Listen(cb func(sender string, data []byte) error) error {
+	return connector.ListenWithContext(func(ctx context.Context, sender string, data []byte) error {
+		return cb(sender, data)
+	})
+}
+
+func (connector *connectorImpl) ListenWithContext(cb func(ctx context.Context, sender string, data []byte) error) error {
+	return connector.ListenWithResponse(func(ctx context.Context, sender string, data []byte) ([]byte, error) {
+		return nil, cb(ctx, sender, data)
+	})
+}
+
+func (connector *connectorImpl) ListenWithResponse(cb func(ctx context.Context, sender string, data []byte) ([]byte, error)) error {
 	// Keep connection to Cloud Socket system
 	go connector.loopReconnect()
+	if connector.watcher != nil {
+		go connector.loopWatchConfig()
+	}
 
 	chRecvMessage, err := connector.conn.GetReadChannel()
 	if err != nil {
@@ -64,21 +191,31 @@ func (connector *connectorImpl) Listen(cb func(sender string, data []byte) error
 	}
 
 	var (
-		content     []byte
-		itemQueue   *csoqueue.ItemQueue
-		msg         *cipher.Cipher
-		readyTicket *readyticket.ReadyTicket
-		delayTime   = 100 * time.Millisecond
-		emptyData   = []byte{}
+		content      []byte
+		itemQueue    *csoqueue.ItemQueue
+		msg          *cipher.Cipher
+		readyTicket  *readyticket.ReadyTicket
+		heldMessages []*cipher.Cipher // received before the connection is activated
+		delayTime    = time.Duration(connector.options.TickInterval)
 	)
-	timer := time.NewTimer(delayTime)
+	tick, resetTick := connector.newTick(delayTime)
 
 	for {
 		select {
-		case <-timer.C:
+		case <-tick:
+			isDraining := connector.checkKeyRotation()
+			connector.flushOffline()
+			if isDraining {
+				resetTick()
+				continue
+			}
 			itemQueue = connector.queueMessages.NextMessage()
+			if connector.reportExpiredMessages() {
+				connector.queueSpace.broadcast()
+			}
+			connector.setQueueDepth()
 			if itemQueue == nil {
-				timer.Reset(delayTime)
+				resetTick()
 				continue
 			}
 			if itemQueue.IsGroup {
@@ -107,199 +244,527 @@ func (connector *connectorImpl) Listen(cb func(sender string, data []byte) error
 				)
 			}
 			if err != nil {
-				timer.Reset(delayTime)
+				resetTick()
 				continue
 			}
-			connector.conn.SendMessage(content)
-			timer.Reset(delayTime)
+			connector.resendMessage(itemQueue, content)
+			resetTick()
 		case itemQueue = <-connector.chWriteMessage:
-			connector.queueMessages.PushMessage(itemQueue)
+			connector.pushPending(itemQueue)
+			connector.setQueueDepth()
 		case content = <-chRecvMessage:
+			connector.countKeyUsage(len(content))
 			msg, err = connector.parser.ParseReceivedMessage(content)
 			if err != nil {
+				if err == csoparser.ErrInvalidSignature {
+					connector.metrics.MessageInvalidSignature()
+				}
 				continue
 			}
 
 			if msg.MessageType == cipher.TypeActivation {
 				readyTicket, err = readyticket.ParseBytes(msg.Data)
-				if err != nil || !readyTicket.IsReady {
+				if err != nil {
 					continue
 				}
-				connector.isActivated = true
-				if connector.counter == nil {
-					connector.counter = csocounter.NewCounter(
-						readyTicket.IdxWrite,
-						readyTicket.IdxRead,
-						readyTicket.MaskRead,
-					)
+				if !readyTicket.IsReady {
+					atomic.StoreInt32(&connector.isRejected, 1)
+					if atomic.LoadInt32(&connector.isResumedSession) == 1 {
+						// Close the connection to fall back to full registration
+						connector.conn.Close()
+					}
+					continue
 				}
-				continue
-			}
-
-			if connector.isActivated == false {
-				continue
-			}
-
-			if msg.MessageType != cipher.TypeDone && msg.MessageType != cipher.TypeSingle && msg.MessageType != cipher.TypeSingleCached {
-				if msg.MessageType != cipher.TypeGroup && msg.MessageType != cipher.TypeGroupCached {
+				err = connector.syncCounter(readyTicket)
+				if err != nil {
+					connector.logger.Printf("Error counter: %s", err.Error())
+					// Close the connection to activate again after reconnecting
+					connector.conn.Close()
 					continue
 				}
-			}
-
-			if msg.MessageID == 0 {
-				if msg.IsRequest {
-					cb(msg.Name, msg.Data)
+				if !connector.IsActivated() {
+					connector.metrics.ObserveActivationLatency(time.Duration(time.Now().UnixNano() - connector.connectedAt.Load()))
+					connector.endActivationSpan(nil)
+				}
+				connector.setActivated(true)
+				connector.dropPreviousKey()
+				for _, msg = range heldMessages {
+					connector.handleReceivedMessage(cb, msg)
 				}
+				heldMessages = nil
+				connector.flushOffline()
 				continue
 			}
 
-			if msg.IsRequest == false { // response
-				connector.queueMessages.ClearMessage(msg.MessageID)
+			if !connector.IsActivated() {
+				// Messages which the Hub server sent before the connection switched keys are handled after the activation
+				if len(heldMessages) < int(connector.options.BufferSize) {
+					heldMessages = append(heldMessages, msg)
+				}
 				continue
 			}
+			connector.handleReceivedMessage(cb, msg)
+		}
+	}
+}
 
-			if connector.counter.MarkReadDone(msg.MessageTag) {
-				err = cb(msg.Name, msg.Data)
-				if err != nil {
-					connector.counter.MarkReadUnused(msg.MessageTag)
-					continue
-				}
-			}
-			connector.sendResponse(msg.MessageID, msg.MessageTag, msg.Name, emptyData, msg.IsEncrypted)
+// handleReceivedMessage handles a message of the Hub server after the connection is activated
+func (connector *connectorImpl) handleReceivedMessage(cb func(ctx context.Context, sender string, data []byte) ([]byte, error), msg *cipher.Cipher) {
+	var (
+		err      error
+		response []byte
+		isCached bool
+	)
+
+	if msg.MessageType == cipher.TypeGroupNotice {
+		connector.handleGroupNotice(msg)
+		return
+	}
+
+	if msg.MessageType != cipher.TypeDone && msg.MessageType != cipher.TypeSingle && msg.MessageType != cipher.TypeSingleCached {
+		if msg.MessageType != cipher.TypeGroup && msg.MessageType != cipher.TypeGroupCached {
+			return
 		}
 	}
+
+	if msg.MessageID == 0 {
+		if msg.IsRequest {
+			connector.metrics.MessageReceived()
+			connector.handleMessage(cb, msg)
+		}
+		return
+	}
+
+	if msg.IsRequest == false { // response
+		connector.clearPending(msg)
+		connector.queueSpace.broadcast()
+		connector.setQueueDepth()
+		return
+	}
+
+	connector.metrics.MessageReceived()
+	response, isCached = connector.getResponse(msg)
+	if isCached {
+		connector.metrics.MessageDuplicated()
+	} else if connector.getCounter().MarkReadDone(msg.MessageTag) {
+		response, err = connector.handleMessage(cb, msg)
+		if err != nil && err != ErrSignatureRejected {
+			connector.getCounter().MarkReadUnused(msg.MessageTag)
+			return
+		}
+		// A rejected message is acknowledged without response, it is never accepted by resending
+		connector.commitCounter(msg.MessageTag)
+		if err == nil {
+			connector.putResponse(msg, response)
+		}
+	} else {
+		connector.metrics.MessageDuplicated()
+	}
+	if response == nil {
+		response = []byte{}
+	}
+	connector.sendResponse(msg.MessageID, msg.MessageTag, msg.Name, response, msg.IsEncrypted)
 }
 
 func (connector *connectorImpl) SendMessage(recvName string, content []byte, isEncrypted, isCached bool) error {
-	if connector.isActivated == false {
-		return errors.New("Connection is not ready")
+	return connector.SendMessageCtx(context.Background(), recvName, content, isEncrypted, isCached)
+}
+
+func (connector *connectorImpl) SendGroupMessage(groupName string, content []byte, isEncrypted, isCached bool) error {
+	return connector.SendGroupMessageCtx(context.Background(), groupName, content, isEncrypted, isCached)
+}
+
+func (connector *connectorImpl) SendMessageAndRetry(recvName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return connector.SendMessageAndRetryCtx(context.Background(), recvName, content, isEncrypted, numberRetry)
+}
+
+func (connector *connectorImpl) SendGroupMessageAndRetry(groupName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return connector.SendGroupMessageAndRetryCtx(context.Background(), groupName, content, isEncrypted, numberRetry)
+}
+
+func (connector *connectorImpl) SendMessageCtx(ctx context.Context, recvName string, content []byte, isEncrypted, isCached bool) (err error) {
+	ctx, span := connector.startSpan(ctx, "cso.send", recvName, false)
+	defer endSpan(span, &err)
+
+	isAllowed, err := connector.allowSend(ctx, recvName, false)
+	if !isAllowed {
+		return err
+	}
+	content, err = connector.wrapContent(ctx, recvName, false, content)
+	if err != nil {
+		return err
+	}
+	if connector.isOffline() {
+		return connector.pushOffline(&offlineMessage{
+			name:        recvName,
+			isGroup:     false,
+			content:     content,
+			isEncrypted: isEncrypted,
+			isCached:    isCached,
+		})
+	}
+	err = connector.waitActivated(ctx)
+	if err != nil {
+		return err
 	}
 	data, err := connector.parser.BuildMessage(0, 0, recvName, content, isEncrypted, isCached, true, true, true)
 	if err != nil {
 		return err
 	}
-	return connector.conn.SendMessage(data)
+	err = connector.writeMessage(data)
+	if err != nil {
+		return err
+	}
+	connector.metrics.MessageSent()
+	return nil
 }
 
-func (connector *connectorImpl) SendGroupMessage(groupName string, content []byte, isEncrypted, isCached bool) error {
-	if connector.isActivated == false {
-		return errors.New("Connection is not ready")
+func (connector *connectorImpl) SendGroupMessageCtx(ctx context.Context, groupName string, content []byte, isEncrypted, isCached bool) (err error) {
+	ctx, span := connector.startSpan(ctx, "cso.send", groupName, true)
+	defer endSpan(span, &err)
+
+	isAllowed, err := connector.allowSend(ctx, groupName, true)
+	if !isAllowed {
+		return err
+	}
+	content, err = connector.wrapContent(ctx, groupName, true, content)
+	if err != nil {
+		return err
+	}
+	if connector.isOffline() {
+		return connector.pushOffline(&offlineMessage{
+			name:        groupName,
+			isGroup:     true,
+			content:     content,
+			isEncrypted: isEncrypted,
+			isCached:    isCached,
+		})
+	}
+	err = connector.waitActivated(ctx)
+	if err != nil {
+		return err
 	}
 	data, err := connector.parser.BuildGroupMessage(0, 0, groupName, content, isEncrypted, isCached, true, true, true)
 	if err != nil {
 		return err
 	}
-	return connector.conn.SendMessage(data)
+	err = connector.writeMessage(data)
+	if err != nil {
+		return err
+	}
+	connector.metrics.MessageSent()
+	return nil
 }
 
-func (connector *connectorImpl) SendMessageAndRetry(recvName string, content []byte, isEncrypted bool, numberRetry int32) error {
-	if connector.isActivated == false {
-		return errors.New("Connection is not ready")
-	}
+func (connector *connectorImpl) SendMessageAndRetryCtx(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	_, err := connector.sendAndRetry(ctx, recvName, false, content, isEncrypted, numberRetry, 0)
+	return err
+}
 
-	if connector.queueMessages.TakeIndex() == false {
-		return errors.New("Queue is full")
-	}
+func (connector *connectorImpl) SendGroupMessageAndRetryCtx(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	_, err := connector.sendAndRetry(ctx, groupName, true, content, isEncrypted, numberRetry, 0)
+	return err
+}
 
-	connector.chWriteMessage <- &csoqueue.ItemQueue{
-		MsgID:       connector.counter.NextWriteIndex(),
-		MsgTag:      0,
-		RecvName:    recvName,
-		Content:     content,
-		IsEncrypted: isEncrypted,
-		IsCached:    false,
-		IsFirst:     true,
-		IsLast:      true,
-		IsRequest:   true,
-		IsGroup:     false,
-		NumberRetry: numberRetry + 1,
-		Timestamp:   0,
-	}
-	return nil
+func (connector *connectorImpl) SendMessageAndRetryWithTTL(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error) {
+	return connector.sendAndRetry(ctx, recvName, false, content, isEncrypted, numberRetry, ttl)
 }
 
-func (connector *connectorImpl) SendGroupMessageAndRetry(groupName string, content []byte, isEncrypted bool, numberRetry int32) error {
-	if connector.isActivated == false {
-		return errors.New("Connection is not ready")
+func (connector *connectorImpl) SendGroupMessageAndRetryWithTTL(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error) {
+	return connector.sendAndRetry(ctx, groupName, true, content, isEncrypted, numberRetry, ttl)
+}
+
+// sendAndRetry pushes a message into the retry queue and returns its ID
+// The message is dropped when it is not acknowledged within ttl (0 means no limit)
+func (connector *connectorImpl) sendAndRetry(ctx context.Context, name string, isGroup bool, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (msgID uint64, err error) {
+	ctx, span := connector.startSpan(ctx, "cso.send", name, isGroup)
+	defer endSpan(span, &err)
+
+	isAllowed, err := connector.allowSend(ctx, name, isGroup)
+	if !isAllowed {
+		return 0, err
+	}
+	content, err = connector.wrapContent(ctx, name, isGroup, content)
+	if err != nil {
+		return 0, err
+	}
+
+	var deadline uint64
+	if ttl > 0 {
+		deadline = uint64(time.Now().Add(ttl).UnixNano() / int64(time.Millisecond))
+	}
+	priority := priorityFromContext(ctx)
+	if connector.isOffline() {
+		// The ID is assigned when the message is flushed
+		return 0, connector.pushOffline(&offlineMessage{
+			name:        name,
+			isGroup:     isGroup,
+			content:     content,
+			isEncrypted: isEncrypted,
+			isRetry:     true,
+			numberRetry: numberRetry,
+			deadline:    deadline,
+			priority:    priority,
+		})
 	}
 
-	if connector.queueMessages.TakeIndex() == false {
-		return errors.New("Queue is full")
+	err = connector.waitActivated(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = connector.takeIndex(ctx, priority)
+	if err != nil {
+		return 0, err
 	}
 
-	connector.chWriteMessage <- &csoqueue.ItemQueue{
-		MsgID:       connector.counter.NextWriteIndex(),
+	msgID = connector.getCounter().NextWriteIndex()
+	err = connector.pushItem(ctx, &csoqueue.ItemQueue{
+		MsgID:       msgID,
 		MsgTag:      0,
-		RecvName:    groupName,
+		RecvName:    name,
 		Content:     content,
 		IsEncrypted: isEncrypted,
 		IsCached:    false,
 		IsFirst:     true,
 		IsLast:      true,
 		IsRequest:   true,
-		IsGroup:     true,
+		IsGroup:     isGroup,
 		NumberRetry: numberRetry + 1,
 		Timestamp:   0,
+		Deadline:    deadline,
+		Priority:    priority,
+	})
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return msgID, nil
 }
 
 func (connector *connectorImpl) loopReconnect() {
 	var (
 		err          error
 		serverTicket *csoproxy.ServerTicket
-		delayTime    = 3 * time.Second
+		delayTime    = time.Duration(connector.options.ReconnectDelay)
 	)
-	for {
-		serverTicket, err = connector.prepare()
-		if err != nil {
-			log.Printf("Error prepare: %s", err.Error())
-			time.Sleep(delayTime) // delay `delayTime` seconds before attempting to reconnect to Cloud Socket system
-			continue
+	for isFirst := true; ; isFirst = false {
+		connector.applyPendingConfig()
+		if !isFirst {
+			connector.metrics.Reconnect()
+		}
+		connector.setConnectionStatus()
+		isResumed := false
+		if serverTicket = connector.takeRotatedTicket(); serverTicket != nil {
+			connector.metrics.KeyRotated()
+			connector.serverTicket = serverTicket
+		} else if connector.canResume() {
+			isResumed = true
+			serverTicket = connector.serverTicket
+		} else {
+			serverTicket, err = connector.prepare()
+			if err != nil {
+				connector.logger.Printf("Error prepare: %s", err.Error())
+				time.Sleep(delayTime) // delay `delayTime` seconds before attempting to reconnect to Cloud Socket system
+				continue
+			}
+			connector.serverTicket = serverTicket
 		}
 
 		// Connect to Cloud Socket system
-		connector.parser.SetSecretKey(serverTicket.ServerSecretKey)
+		connector.startKeyUsage(serverTicket, isResumed)
+		connector.setSecretKey(serverTicket.ServerSecretKey)
 		err = connector.conn.Connect(serverTicket.HubAddress)
+		connector.setConnectionStatus()
 		if err != nil {
-			log.Printf("Error connect: %s", err.Error())
+			connector.logger.Printf("Error connect: %s", err.Error())
+			connector.serverTicket = nil
+			if isResumed {
+				continue // fall back to full registration immediately
+			}
 			time.Sleep(delayTime) // delay `delayTime` seconds before attempting to reconnect to Cloud Socket system
 			continue
 		}
+		atomic.StoreInt32(&connector.isRejected, 0)
+		if isResumed {
+			atomic.StoreInt32(&connector.isResumedSession, 1)
+		} else {
+			atomic.StoreInt32(&connector.isResumedSession, 0)
+		}
+		connector.connectedAt.Store(time.Now().UnixNano())
+		connector.startActivationSpan(serverTicket.HubAddress)
 
 		// Activate the connection
-		isDisonnected := false
-		connector.isActivated = false
-		go func() {
+		isDisonnected := int32(0) // 1 after LoopListen returns, read by the activating goroutine
+		connector.setActivated(false)
+		go func(serverTicket *csoproxy.ServerTicket) {
 			ticker := time.NewTimer(0)
 			for range ticker.C {
-				if isDisonnected || connector.isActivated {
+				if atomic.LoadInt32(&isDisonnected) == 1 || connector.IsActivated() {
 					break
 				}
-				err = connector.activateConnection(serverTicket.TicketID, serverTicket.TicketBytes)
+				err := connector.activateConnection(serverTicket.TicketID, serverTicket.TicketBytes)
 				if err != nil {
-					log.Printf("Error activation: %s", err.Error())
+					connector.logger.Printf("Error activation: %s", err.Error())
 				}
-				ticker.Reset(delayTime)
+				ticker.Reset(time.Duration(connector.options.ActivationInterval))
 			}
 			ticker.Stop()
-		}()
+		}(serverTicket)
 
 		err = connector.conn.LoopListen()
 		if err != nil {
-			log.Printf("Error listen: %s", err.Error())
+			connector.logger.Printf("Error listen: %s", err.Error())
+		}
+		atomic.StoreInt32(&isDisonnected, 1)
+		connector.endActivationSpan(errors.New("Connection closed before activation"))
+		connector.setConnectionStatus()
+		if !connector.IsActivated() || atomic.LoadInt32(&connector.isRejected) == 1 {
+			connector.serverTicket = nil
+			if isResumed {
+				connector.logger.Printf("Error resume: the ticket is not accepted, register again")
+				continue // fall back to full registration immediately
+			}
+		}
+		if connector.hasRotatedTicket() {
+			continue // switch to the new key immediately
 		}
-		isDisonnected = true
 		time.Sleep(delayTime) // delay `delayTime` seconds before attempting to reconnect to Cloud Socket system
 	}
 }
 
-func (connector *connectorImpl) prepare() (*csoproxy.ServerTicket, error) {
-	serverKey, err := connector.proxy.ExchangeKey()
+func (connector *connectorImpl) IsActivated() bool {
+	return atomic.LoadInt32(&connector.isActivated) == 1
+}
+
+func (connector *connectorImpl) GetConnectionName() string {
+	connector.mutexConf.Lock()
+	defer connector.mutexConf.Unlock()
+	return connector.conf.GetConnectionName()
+}
+
+// UpdateConfig validates conf and applies it at the next reconnect
+// The current connection is closed to reconnect immediately if forceReconnect is true
+// The retry queue and counters are kept
+func (connector *connectorImpl) UpdateConfig(conf config.Config, forceReconnect bool) error {
+	err := config.Validate(conf)
+	if err != nil {
+		return err
+	}
+	connector.mutexConf.Lock()
+	connector.pendingConf = conf
+	connector.mutexConf.Unlock()
+	if forceReconnect {
+		return connector.conn.Close()
+	}
+	return nil
+}
+
+func (connector *connectorImpl) loopWatchConfig() {
+	for conf := range connector.watcher.Updates() {
+		err := connector.UpdateConfig(conf, connector.isForcedReload)
+		if err != nil {
+			connector.logger.Printf("Error update config: %s", err.Error())
+		}
+	}
+}
+
+// applyPendingConfig replaces config of the connector and the proxy, it is invoked by loopReconnect only
+// A proxy created by the connector is replaced when the config switches between one and many Proxy servers
+func (connector *connectorImpl) applyPendingConfig() {
+	connector.mutexConf.Lock()
+	conf := connector.pendingConf
+	connector.pendingConf = nil
+	if conf != nil {
+		connector.conf = conf
+	}
+	connector.mutexConf.Unlock()
+	if conf == nil {
+		return
+	}
+	connector.mutexProxy.Lock()
+	_, isFailover := connector.proxy.(csoproxy.FailoverProxy)
+	if connector.isOwnProxy && isFailover != isFailoverConfig(conf) {
+		connector.proxy = newProxy(conf, connector.options, connector.httpClient)
+	} else {
+		connector.proxy.SetConfig(conf)
+	}
+	connector.mutexProxy.Unlock()
+	connector.serverTicket = nil  // credentials changed, so register again
+	connector.takeRotatedTicket() // registered by old credentials
+	connector.groups.reset()
+}
+
+// canResume checks if the cached ticket can be used to reconnect
+func (connector *connectorImpl) canResume() bool {
+	if time.Duration(connector.options.TicketLifetime) <= 0 || connector.serverTicket == nil {
+		return false
+	}
+	return time.Since(connector.serverTicket.IssuedAt) < time.Duration(connector.options.TicketLifetime)
+}
+
+func (connector *connectorImpl) prepare() (serverTicket *csoproxy.ServerTicket, err error) {
+	connector.mutexProxy.Lock()
+	defer connector.mutexProxy.Unlock()
+
+	ctx, span := connector.tracer.Start(context.Background(), "cso.proxy.register")
+	defer endSpan(span, &err)
+
+	ctxCall, spanCall := connector.tracer.Start(ctx, "cso.proxy.exchange_key")
+	begin := time.Now()
+	serverKey, err := connector.proxy.ExchangeKeyContext(ctxCall)
+	connector.metrics.ObserveProxyCall("exchange-key", time.Since(begin))
+	endSpan(spanCall, &err)
 	if err != nil {
 		return nil, err
 	}
-	return connector.proxy.RegisterConnection(serverKey)
+
+	ctxCall, spanCall = connector.tracer.Start(ctx, "cso.proxy.register_connection")
+	begin = time.Now()
+	serverTicket, err = connector.proxy.RegisterConnectionContext(ctxCall, serverKey)
+	connector.metrics.ObserveProxyCall("register-connection", time.Since(begin))
+	endSpan(spanCall, &err)
+	return serverTicket, err
+}
+
+// newProxy returns a Proxy which fails over between Proxy servers when conf has many of them
+func newProxy(conf config.Config, options *config.Options, client *http.Client) csoproxy.Proxy {
+	opts := []csoproxy.Option{
+		csoproxy.WithHTTPClient(client),
+		csoproxy.WithUserAgent(options.UserAgent),
+		csoproxy.WithRetry(options.HTTPRetry, time.Duration(options.HTTPRetryDelay)),
+	}
+	// Timeout of an injected client is kept unless http_timeout is set explicitly
+	if client == nil || options.IsSet("http_timeout") {
+		opts = append(opts, csoproxy.WithTimeout(time.Duration(options.HTTPTimeout)))
+	}
+	switch options.KeyExchange {
+	case config.KeyExchangeX25519:
+		opts = append(opts, csoproxy.WithKeyExchange(csoproxy.KeyExchangeX25519, true))
+	case config.KeyExchangeX25519Only:
+		opts = append(opts, csoproxy.WithKeyExchange(csoproxy.KeyExchangeX25519, false))
+	}
+	if isFailoverConfig(conf) {
+		return csoproxy.NewFailoverProxy(conf, time.Duration(options.FailoverCooldown), opts...)
+	}
+	return csoproxy.NewProxy(conf, opts...)
+}
+
+// isFailoverConfig checks if conf has many Proxy servers
+func isFailoverConfig(conf config.Config) bool {
+	return len(config.GetEndpoints(conf)) > 1
+}
+
+// setQueueDepth exports number of items of the retry queue if the queue reports it
+func (connector *connectorImpl) setQueueDepth() {
+	if queue, isOk := connector.queueMessages.(csoqueue.LenQueue); isOk {
+		connector.metrics.SetQueueDepth(queue.Len())
+	}
+}
+
+// setConnectionStatus exports status of the connection if the connection reports it
+func (connector *connectorImpl) setConnectionStatus() {
+	if conn, isOk := connector.conn.(csoconnection.StatusConnection); isOk {
+		connector.metrics.SetConnectionStatus(uint8(conn.GetStatus()))
+	}
 }
 
 func (connector *connectorImpl) activateConnection(ticketID uint32, ticketBytes []byte) error {
@@ -307,7 +772,7 @@ func (connector *connectorImpl) activateConnection(ticketID uint32, ticketBytes
 	if err != nil {
 		return err
 	}
-	return connector.conn.SendMessage(data)
+	return connector.writeMessage(data)
 }
 
 func (connector *connectorImpl) sendResponse(msgID, msgTag uint64, recvName string, data []byte, isEncrypted bool) error {
@@ -325,5 +790,61 @@ func (connector *connectorImpl) sendResponse(msgID, msgTag uint64, recvName stri
 	if err != nil {
 		return err
 	}
-	return connector.conn.SendMessage(data)
+	return connector.writeMessage(data)
+}
+
+// allowSend applies the rate limiter, it returns false with csolimiter.ErrDropped if the message is dropped
+// Retries and responses are not limited, they are paced by the retry queue and received messages
+func (connector *connectorImpl) allowSend(ctx context.Context, name string, isGroup bool) (bool, error) {
+	if connector.limiter == nil {
+		return true, nil
+	}
+	isAllowed, err := connector.limiter.Allow(ctx, name, isGroup)
+	if isAllowed {
+		return true, nil
+	}
+	connector.metrics.MessageRateLimited()
+	if err == nil {
+		err = csolimiter.ErrDropped
+	}
+	return false, err
+}
+
+// newTick returns the channel which drives the retry queue and the function rearming it
+// Ticks of a Manager are shared by its identities, so rearming is not needed
+func (connector *connectorImpl) newTick(interval time.Duration) (<-chan time.Time, func()) {
+	if connector.sharedTick != nil {
+		return connector.sharedTick, func() {}
+	}
+	timer := time.NewTimer(interval)
+	return timer.C, func() {
+		timer.Reset(interval)
+	}
+}
+
+func (connector *connectorImpl) writeMessage(data []byte) error {
+	begin := time.Now()
+	err := connector.conn.SendMessage(data)
+	connector.metrics.ObserveSendLatency(time.Since(begin))
+	if err == nil {
+		connector.countKeyUsage(len(data))
+	}
+	return err
+}
+
+func (connector *connectorImpl) resendMessage(item *csoqueue.ItemQueue, data []byte) {
+	if item.NumberSent <= 1 {
+		if connector.writeMessage(data) == nil {
+			connector.metrics.MessageSent()
+		}
+		return
+	}
+
+	span := connector.startRetrySpan(item)
+	err := connector.writeMessage(data)
+	if err == nil {
+		connector.metrics.MessageSent()
+	}
+	connector.metrics.MessageRetried()
+	endSpan(span, &err)
 }
@@ -1,12 +1,53 @@
 package csoconnector
 
+import (
+	"context"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
 // Connector keeps connection to server
 type Connector interface {
 	Listen(cb func(sender string, data []byte) error) error
+	ListenWithContext(cb func(ctx context.Context, sender string, data []byte) error) error
+	// ListenWithResponse sends the data returned by cb in the response to the sender, see WithResponseHandler
+	ListenWithResponse(cb func(ctx context.Context, sender string, data []byte) ([]byte, error)) error
 
+	// Send methods return csolimiter.ErrDropped when the rate limiter drops the message (csolimiter.ModeDrop)
+	// and csolimiter.ErrRateLimited when it rejects the message (csolimiter.ModeError), see WithRateLimiter
 	SendMessage(recvName string, content []byte, isEncrypted, isCached bool) error
 	SendGroupMessage(groupName string, content []byte, isEncrypted, isCached bool) error
 
+	// Methods return csolimiter.ErrDropped when the rate limiter drops the message
 	SendMessageAndRetry(recvName string, content []byte, isEncrypted bool, numberRetry int32) error
 	SendGroupMessageAndRetry(groupName string, content []byte, isEncrypted bool, numberRetry int32) error
+
+	// Methods propagate trace context of ctx to the receiver
+	// They wait for activation and capacity of the retry queue until ctx is done
+	// A ctx which is never done (e.g. context.Background) fails immediately like the methods above
+	// They return csolimiter.ErrDropped when the rate limiter drops the message
+	SendMessageCtx(ctx context.Context, recvName string, content []byte, isEncrypted, isCached bool) error
+	SendGroupMessageCtx(ctx context.Context, groupName string, content []byte, isEncrypted, isCached bool) error
+	SendMessageAndRetryCtx(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32) error
+	SendGroupMessageAndRetryCtx(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32) error
+
+	// Methods drop the message when it is not acknowledged within ttl and return its ID
+	// The ID is 0 when the message is kept in the offline buffer
+	// Dropped messages are reported to the handler set by WithExpiredHandler
+	// They return 0 and csolimiter.ErrDropped when the rate limiter drops the message
+	SendMessageAndRetryWithTTL(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error)
+	SendGroupMessageAndRetryWithTTL(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error)
+
+	IsActivated() bool
+	GetConnectionName() string
+
+	// Group methods change and list groups of the connection through the Proxy server
+	// Groups are cached and updated by membership notices, see WithGroupNoticeHandler
+	JoinGroup(ctx context.Context, groupName string) error
+	LeaveGroup(ctx context.Context, groupName string) error
+	GetGroups(ctx context.Context) ([]string, error)
+
+	// UpdateConfig applies conf at the next reconnect, or immediately if forceReconnect is true
+	UpdateConfig(conf config.Config, forceReconnect bool) error
 }
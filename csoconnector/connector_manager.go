@@ -0,0 +1,200 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+// Manager hosts many identities (connection names with their own project tokens) in one process
+// Identities share the HTTP client and the timer of retry queues, messages of all identities go to one dispatcher
+type Manager interface {
+	// AddIdentity creates a connector for conf, opts are applied after options of the manager
+	// An identity added after Listen starts listening immediately
+	AddIdentity(conf config.Config, opts ...Option) (Connector, error)
+	// GetIdentity returns the connector which sends messages as name
+	// Messages are received through Listen of the manager, not Listen of the connector
+	GetIdentity(name string) (Connector, bool)
+	GetIdentities() []string
+
+	// Listen dispatches messages of all identities to cb, identity is the connection name which received the message
+	// cb is invoked concurrently by identities, the method returns the first error of any identity
+	// Other identities keep their connections after Listen returns, their messages are not acknowledged
+	// until Listen is invoked again, so senders resend them
+	Listen(cb func(ctx context.Context, identity, sender string, data []byte) ([]byte, error)) error
+}
+
+type managerImpl struct {
+	mutex      sync.Mutex
+	bufferSize int32
+	opts       []Option
+	httpClient *http.Client
+	interval   time.Duration
+	identities map[string]*connectorImpl
+	ticks      map[string]chan time.Time
+	listening  map[string]bool // identities whose Listen is running
+	dispatcher func(ctx context.Context, identity, sender string, data []byte) ([]byte, error)
+	chErr      chan error
+	create     func(conf config.Config, opts []Option) *connectorImpl // creates the connector of an identity
+}
+
+// ErrManagerNotListening is returned to an identity which receives a message while Listen of the manager is not running
+var ErrManagerNotListening = errors.New("Manager is not listening")
+
+// NewManager inits a new instance of Manager interface
+// bufferSize and opts are applied to every identity
+func NewManager(bufferSize int32, opts ...Option) Manager {
+	// Resolve options once to know the shared tick interval
+	resolved := &connectorImpl{options: config.DefaultOptions()}
+	for _, opt := range opts {
+		opt(resolved)
+	}
+
+	httpClient := resolved.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	}
+	return &managerImpl{
+		bufferSize: bufferSize,
+		opts:       opts,
+		httpClient: httpClient,
+		interval:   time.Duration(resolved.options.TickInterval),
+		identities: make(map[string]*connectorImpl),
+		ticks:      make(map[string]chan time.Time),
+		listening:  make(map[string]bool),
+		chErr:      make(chan error, 1),
+		create: func(conf config.Config, opts []Option) *connectorImpl {
+			return DefaultConnector(bufferSize, conf, opts...).(*connectorImpl)
+		},
+	}
+}
+
+func (manager *managerImpl) AddIdentity(conf config.Config, opts ...Option) (Connector, error) {
+	name := conf.GetConnectionName()
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if _, isExisted := manager.identities[name]; isExisted {
+		return nil, errors.New("Identity already exists")
+	}
+
+	tick := make(chan time.Time, 1)
+	shared := func(connector *connectorImpl) {
+		connector.httpClient = manager.httpClient
+		connector.sharedTick = tick
+	}
+	memberOpts := make([]Option, 0, len(manager.opts)+len(opts)+1)
+	memberOpts = append(memberOpts, manager.opts...)
+	memberOpts = append(memberOpts, shared)
+	memberOpts = append(memberOpts, opts...)
+	connector := manager.create(conf, memberOpts)
+
+	manager.identities[name] = connector
+	manager.ticks[name] = tick
+	if manager.dispatcher != nil {
+		manager.listen(name, connector)
+	}
+	return connector, nil
+}
+
+func (manager *managerImpl) GetIdentity(name string) (Connector, bool) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	connector, isExisted := manager.identities[name]
+	if !isExisted {
+		return nil, false
+	}
+	return connector, true
+}
+
+func (manager *managerImpl) GetIdentities() []string {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	names := make([]string, 0, len(manager.identities))
+	for name := range manager.identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (manager *managerImpl) Listen(cb func(ctx context.Context, identity, sender string, data []byte) ([]byte, error)) error {
+	manager.mutex.Lock()
+	if manager.dispatcher != nil {
+		manager.mutex.Unlock()
+		return errors.New("Manager is listening")
+	}
+	manager.dispatcher = cb
+	for name, connector := range manager.identities {
+		manager.listen(name, connector)
+	}
+	manager.mutex.Unlock()
+
+	chStopTick := make(chan struct{})
+	go manager.loopTick(chStopTick)
+	err := <-manager.chErr
+	close(chStopTick)
+
+	manager.mutex.Lock()
+	manager.dispatcher = nil
+	manager.mutex.Unlock()
+	return err
+}
+
+// listen starts an identity which is not listening yet, it is invoked with the mutex held
+func (manager *managerImpl) listen(name string, connector *connectorImpl) {
+	if manager.listening[name] {
+		return
+	}
+	manager.listening[name] = true
+	go func() {
+		err := connector.ListenWithResponse(func(ctx context.Context, sender string, data []byte) ([]byte, error) {
+			dispatcher := manager.getDispatcher()
+			if dispatcher == nil {
+				return nil, ErrManagerNotListening
+			}
+			return dispatcher(ctx, name, sender, data)
+		})
+		manager.mutex.Lock()
+		delete(manager.listening, name)
+		manager.mutex.Unlock()
+		select {
+		case manager.chErr <- err:
+		default:
+		}
+	}()
+}
+
+func (manager *managerImpl) getDispatcher() func(ctx context.Context, identity, sender string, data []byte) ([]byte, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.dispatcher
+}
+
+// loopTick drives retry queues of all identities by one timer until chStop is closed
+// A tick is skipped for an identity which is still busy with the previous one
+func (manager *managerImpl) loopTick(chStop chan struct{}) {
+	ticker := time.NewTicker(manager.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-chStop:
+			return
+		case now := <-ticker.C:
+			manager.mutex.Lock()
+			for _, tick := range manager.ticks {
+				select {
+				case tick <- now:
+				default:
+				}
+			}
+			manager.mutex.Unlock()
+		}
+	}
+}
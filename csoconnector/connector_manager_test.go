@@ -0,0 +1,162 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+var errTestRead = errors.New("read failed")
+
+// newTestManager returns a manager whose identities use fake connections, identities in failing cannot listen
+func newTestManager(t *testing.T, failing ...string) (*managerImpl, func(name string) *testHub) {
+	var (
+		mutex sync.Mutex
+		hubs  = make(map[string]*testHub)
+	)
+	manager := NewManager(16, WithTickInterval(5*time.Millisecond), WithLogger(nil)).(*managerImpl)
+	manager.create = func(conf config.Config, opts []Option) *connectorImpl {
+		connector, hub := newTestConnector(t, conf.GetConnectionName(), opts...)
+		for _, name := range failing {
+			if name == conf.GetConnectionName() {
+				hub.conn.readErr = errTestRead
+			}
+		}
+		mutex.Lock()
+		hubs[conf.GetConnectionName()] = hub
+		mutex.Unlock()
+		return connector
+	}
+	return manager, func(name string) *testHub {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return hubs[name]
+	}
+}
+
+func newTestIdentity(name string) config.Config {
+	return config.NewConfig("project", "dG9rZW4=", name, "key", "http://proxy")
+}
+
+func waitListening(t *testing.T, manager *managerImpl, isListening bool) {
+	deadline := time.Now().Add(testTimeout)
+	for (manager.getDispatcher() != nil) != isListening {
+		if time.Now().After(deadline) {
+			t.Fatal("[waitListening] timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerIdentities(t *testing.T) {
+	manager, getHub := newTestManager(t)
+	connA, err := manager.AddIdentity(newTestIdentity("a"))
+	if err != nil {
+		t.Fatal("[TestManagerIdentities] add identity failed")
+	}
+	_, err = manager.AddIdentity(newTestIdentity("a"))
+	if err == nil {
+		t.Error("[TestManagerIdentities] duplicate identity is added")
+	}
+
+	chReceived := make(chan string, 4)
+	go manager.Listen(func(ctx context.Context, identity, sender string, data []byte) ([]byte, error) {
+		chReceived <- identity + ":" + string(data)
+		return nil, nil
+	})
+	waitListening(t, manager, true)
+
+	// An identity added after Listen starts listening immediately
+	connB, err := manager.AddIdentity(newTestIdentity("b"))
+	if err != nil {
+		t.Fatal("[TestManagerIdentities] add identity after Listen failed")
+	}
+	if names := manager.GetIdentities(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Error("[TestManagerIdentities] invalid identities")
+	}
+	if conn, isExisted := manager.GetIdentity("b"); !isExisted || conn != connB {
+		t.Error("[TestManagerIdentities] identity is not found")
+	}
+
+	for idx, conn := range []Connector{connA, connB} {
+		hub := getHub(conn.GetConnectionName())
+		hub.activate()
+		waitActivated(t, conn)
+		hub.deliver(uint64(idx+1), uint64(idx+1), "sender", []byte("hello"))
+		select {
+		case received := <-chReceived:
+			if received != conn.GetConnectionName()+":hello" {
+				t.Errorf("[TestManagerIdentities] invalid message %s", received)
+			}
+		case <-hub.timeout():
+			t.Fatal("[TestManagerIdentities] timeout")
+		}
+		hub.nextData()
+	}
+
+	// Retry queues of all identities are driven by ticks of the manager
+	for _, conn := range []Connector{connA, connB} {
+		err = conn.SendMessageAndRetry("receiver", []byte("retry"), false, 1)
+		if err != nil {
+			t.Fatal("[TestManagerIdentities] send failed")
+		}
+	}
+	for _, conn := range []Connector{connA, connB} {
+		msg := getHub(conn.GetConnectionName()).nextData()
+		if string(msg.Data) != "retry" {
+			t.Errorf("[TestManagerIdentities] retry message of %s is not sent", conn.GetConnectionName())
+		}
+	}
+}
+
+func TestManagerListenAgain(t *testing.T) {
+	manager, getHub := newTestManager(t, "failing")
+	connA, _ := manager.AddIdentity(newTestIdentity("a"))
+
+	chErr := make(chan error, 1)
+	chReceived := make(chan string, 4)
+	listen := func() {
+		chErr <- manager.Listen(func(ctx context.Context, identity, sender string, data []byte) ([]byte, error) {
+			chReceived <- identity
+			return nil, nil
+		})
+	}
+	go listen()
+	waitListening(t, manager, true)
+	hubA := getHub("a")
+	hubA.activate()
+	waitActivated(t, connA)
+
+	// Listen returns the error of an identity
+	manager.AddIdentity(newTestIdentity("failing"))
+	select {
+	case err := <-chErr:
+		if err != errTestRead {
+			t.Fatal("[TestManagerListenAgain] invalid error")
+		}
+	case <-hubA.timeout():
+		t.Fatal("[TestManagerListenAgain] timeout")
+	}
+	waitListening(t, manager, false)
+
+	// Messages are not acknowledged while the manager is not listening
+	hubA.deliver(1, 1, "sender", []byte("hello"))
+	hubA.noMessage(50 * time.Millisecond)
+
+	go listen()
+	select {
+	case err := <-chErr:
+		if err != errTestRead {
+			t.Error("[TestManagerListenAgain] Listen is refused after it returned")
+		}
+	case <-hubA.timeout():
+		t.Fatal("[TestManagerListenAgain] timeout")
+	}
+	if hubA.numberConnect() != 1 {
+		t.Error("[TestManagerListenAgain] listening identity is started again")
+	}
+}
@@ -0,0 +1,84 @@
+package csoconnector
+
+import (
+	"context"
+
+	"github.com/gecosys/cso-client-golang/csoidempotency"
+	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/csosignature"
+	"github.com/gecosys/cso-client-golang/message/cipher"
+)
+
+type messageInfoKey struct{}
+
+// MessageInfo is information of a received message, it is stored in the context passed to handlers
+type MessageInfo struct {
+	Sender      string
+	MessageID   uint64 // 0 if the sender does not wait for a response
+	MessageTag  uint64
+	IsGroup     bool
+	IsEncrypted bool
+	IsCached    bool
+	IsE2E       bool // content was encrypted end-to-end by the sender
+
+	Signer          string              // connection name in the signature, empty if unsigned
+	SignatureStatus csosignature.Status // result of verifying the signature by the trust store
+
+	signature *csosignature.Signature // valid signature, its nonce is remembered after handling
+}
+
+// MessageInfoFromContext returns information of the message which is being handled
+func MessageInfoFromContext(ctx context.Context) (*MessageInfo, bool) {
+	info, ok := ctx.Value(messageInfoKey{}).(*MessageInfo)
+	return info, ok
+}
+
+func newMessageInfo(msg *cipher.Cipher) *MessageInfo {
+	return &MessageInfo{
+		Sender:      msg.Name,
+		MessageID:   msg.MessageID,
+		MessageTag:  msg.MessageTag,
+		IsGroup:     msg.MessageType == cipher.TypeGroup || msg.MessageType == cipher.TypeGroupCached,
+		IsEncrypted: msg.IsEncrypted,
+		IsCached:    msg.MessageType == cipher.TypeSingleCached || msg.MessageType == cipher.TypeGroupCached,
+	}
+}
+
+// getResponse returns the cached response of a message which was handled
+func (connector *connectorImpl) getResponse(msg *cipher.Cipher) ([]byte, bool) {
+	if connector.responseCache == nil {
+		return nil, false
+	}
+	return connector.responseCache.Get(responseKey(msg))
+}
+
+// putResponse caches the response of a message which was handled successfully
+func (connector *connectorImpl) putResponse(msg *cipher.Cipher, response []byte) {
+	if connector.responseCache == nil {
+		return
+	}
+	connector.responseCache.Put(responseKey(msg), response)
+}
+
+func responseKey(msg *cipher.Cipher) csoidempotency.Key {
+	return csoidempotency.Key{
+		Sender:     msg.Name,
+		MessageID:  msg.MessageID,
+		MessageTag: msg.MessageTag,
+	}
+}
+
+type priorityKey struct{}
+
+// ContextWithPriority returns ctx which sends messages through the retry queue with priority
+func ContextWithPriority(ctx context.Context, priority csoqueue.Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) csoqueue.Priority {
+	priority, ok := ctx.Value(priorityKey{}).(csoqueue.Priority)
+	if !ok {
+		return csoqueue.PriorityNormal
+	}
+	return priority
+}
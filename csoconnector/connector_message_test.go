@@ -0,0 +1,66 @@
+package csoconnector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoidempotency"
+)
+
+func TestResponseHandler(t *testing.T) {
+	type response struct {
+		msgID    uint64
+		recvName string
+		data     string
+	}
+	chResponse := make(chan response, 4)
+	sender, hubSender := newTestConnector(t, "sender", WithResponseHandler(func(msgID uint64, recvName string, isGroup bool, data []byte) {
+		chResponse <- response{msgID, recvName, string(data)}
+	}))
+	numberHandled := 0
+	receiver, hubReceiver := newTestConnector(t, "receiver", WithResponseCache(csoidempotency.NewCache(16, time.Minute)))
+	go sender.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	go receiver.ListenWithResponse(func(ctx context.Context, sender string, data []byte) ([]byte, error) {
+		numberHandled++
+		return []byte(fmt.Sprintf("result-%d", numberHandled)), nil
+	})
+	hubSender.activate()
+	hubReceiver.activate()
+	waitActivated(t, sender)
+	waitActivated(t, receiver)
+
+	err := sender.SendMessageAndRetry("receiver", []byte("request"), false, 3)
+	if err != nil {
+		t.Fatal("[TestResponseHandler] send failed")
+	}
+	request := hubSender.nextData()
+
+	// The duplicate is answered by the cached response
+	for idx := 0; idx < 2; idx++ {
+		hubReceiver.deliver(request.MessageID, 1, "sender", request.Data)
+		ack := hubReceiver.nextData()
+		if string(ack.Data) != "result-1" {
+			t.Fatalf("[TestResponseHandler] invalid response %q", ack.Data)
+		}
+		data, _ := hubSender.parser.BuildMessage(ack.MessageID, ack.MessageTag, "receiver", ack.Data, false, false, true, true, false)
+		hubSender.conn.chRead <- data
+	}
+
+	select {
+	case resp := <-chResponse:
+		if resp.msgID != request.MessageID || resp.recvName != "receiver" || resp.data != "result-1" {
+			t.Error("[TestResponseHandler] invalid response")
+		}
+	case <-hubSender.timeout():
+		t.Fatal("[TestResponseHandler] timeout")
+	}
+	select {
+	case <-chResponse:
+		t.Error("[TestResponseHandler] response of an answered message is notified")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,150 @@
+package csoconnector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoconnection"
+	"github.com/gecosys/cso-client-golang/csometrics"
+	"github.com/gecosys/cso-client-golang/csoparser"
+	"github.com/gecosys/cso-client-golang/csoqueue"
+)
+
+// plainQueue implements only csoqueue.Queue
+type plainQueue struct {
+	csoqueue.Queue
+}
+
+// plainConn implements only csoconnection.Connection
+type plainConn struct {
+	csoconnection.Connection
+}
+
+// metricValue returns value of the sample name of metrics
+func metricValue(metrics csometrics.PrometheusMetrics, name string) string {
+	buf := new(bytes.Buffer)
+	metrics.WriteTo(buf)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == name {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+func waitMetric(t *testing.T, metrics csometrics.PrometheusMetrics, name, value string) {
+	deadline := time.Now().Add(testTimeout)
+	for metricValue(metrics, name) != value {
+		if time.Now().After(deadline) {
+			t.Fatalf("[waitMetric] %s is %s, expected %s", name, metricValue(metrics, name), value)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMetricsReconnect(t *testing.T) {
+	metrics := csometrics.NewPrometheusMetrics("")
+	connector, hub := newTestConnector(t, "receiver", WithMetrics(metrics))
+	go connector.Listen(func(sender string, data []byte) error { return nil })
+	hub.activate()
+	waitActivated(t, connector)
+	waitMetric(t, metrics, "cso_connection_status", "2")
+	if metricValue(metrics, "cso_reconnects_total") != "0" {
+		t.Error("[TestMetricsReconnect] the first connection is counted as a reconnect")
+	}
+
+	hub.conn.Close()
+	hub.activate()
+	waitMetric(t, metrics, "cso_reconnects_total", "1")
+}
+
+func TestMetricsInvalidMessage(t *testing.T) {
+	metrics := csometrics.NewPrometheusMetrics("")
+	connector, hub := newTestConnector(t, "receiver", WithMetrics(metrics))
+	chHandled := make(chan []byte, 4)
+	go connector.Listen(func(sender string, data []byte) error {
+		chHandled <- data
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	otherParser := csoparser.NewParser()
+	otherParser.SetSecretKey([]byte("fedcba9876543210fedcba9876543210"))
+	for _, isEncrypted := range []bool{false, true} {
+		data, err := otherParser.BuildMessage(0, 1, "sender", []byte("forged"), isEncrypted, false, true, true, true)
+		if err != nil {
+			t.Fatal("[TestMetricsInvalidMessage] build message failed")
+		}
+		hub.conn.chRead <- data
+	}
+	waitMetric(t, metrics, "cso_messages_invalid_signature_total", "2")
+
+	hub.deliver(0, 2, "sender", []byte("valid"))
+	select {
+	case data := <-chHandled:
+		if string(data) != "valid" {
+			t.Error("[TestMetricsInvalidMessage] invalid message is handled")
+		}
+	case <-hub.timeout():
+		t.Fatal("[TestMetricsInvalidMessage] valid message is not handled")
+	}
+	if metricValue(metrics, "cso_messages_invalid_signature_total") != "2" {
+		t.Error("[TestMetricsInvalidMessage] valid message is counted")
+	}
+}
+
+func TestMetricsOptionalInterfaces(t *testing.T) {
+	cases := []struct {
+		name   string
+		plain  bool
+		depth  string
+		status string
+	}{
+		{"full", false, "1", "2"},
+		{"plain", true, "0", "0"},
+	}
+	for _, c := range cases {
+		metrics := csometrics.NewPrometheusMetrics("")
+		isExpired := make(chan struct{}, 1)
+		connector, hub := newTestConnector(t, "sender", WithMetrics(metrics), WithExpiredHandler(func(msgID uint64, recvName string, isGroup bool, err error) {
+			isExpired <- struct{}{}
+		}))
+		if c.plain {
+			connector.queueMessages = &plainQueue{Queue: connector.queueMessages}
+			connector.conn = &plainConn{Connection: hub.conn}
+		}
+		go connector.Listen(func(sender string, data []byte) error { return nil })
+		hub.activate()
+		waitActivated(t, connector)
+
+		err := connector.SendMessageAndRetry("receiver", []byte("request"), false, 1)
+		if err != nil {
+			t.Fatalf("[TestMetricsOptionalInterfaces] send message of %s failed", c.name)
+		}
+		if msg := hub.nextData(); string(msg.Data) != "request" {
+			t.Errorf("[TestMetricsOptionalInterfaces] invalid message of %s", c.name)
+		}
+		if metricValue(metrics, "cso_connection_status") != c.status {
+			t.Errorf("[TestMetricsOptionalInterfaces] invalid connection status of %s", c.name)
+		}
+		if c.plain {
+			// Nothing is reported without the optional interfaces
+			time.Sleep(200 * time.Millisecond)
+			if metricValue(metrics, "cso_queue_depth") != c.depth || len(isExpired) != 0 {
+				t.Errorf("[TestMetricsOptionalInterfaces] invalid metrics of %s", c.name)
+			}
+			continue
+		}
+		waitMetric(t, metrics, "cso_queue_depth", c.depth)
+		select {
+		case <-isExpired:
+		case <-hub.timeout():
+			t.Errorf("[TestMetricsOptionalInterfaces] expired message of %s is not reported", c.name)
+		}
+		waitMetric(t, metrics, "cso_messages_expired_total", "1")
+	}
+}
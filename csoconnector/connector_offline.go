@@ -0,0 +1,198 @@
+package csoconnector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoqueue"
+)
+
+// ErrOfflineBufferFull is returned when a message can not be buffered while the connector is not activated
+var ErrOfflineBufferFull = errors.New("Offline buffer is full")
+
+// offlineMessage is a message which is accepted while the connector is not activated
+type offlineMessage struct {
+	name        string
+	isGroup     bool
+	content     []byte
+	isEncrypted bool
+	isCached    bool
+	isRetry     bool
+	numberRetry int32
+	deadline    uint64 // unix milliseconds, 0 means no deadline
+	priority    csoqueue.Priority
+	createdAt   int64 // unix nanoseconds
+}
+
+// offlineBuffer keeps messages in order until the connector is activated
+type offlineBuffer struct {
+	mutex    sync.Mutex
+	maxCount int
+	maxBytes int
+	maxAge   time.Duration
+	messages []*offlineMessage
+	bytes    int
+}
+
+func newOfflineBuffer(maxCount int, maxBytes int, maxAge time.Duration) *offlineBuffer {
+	return &offlineBuffer{
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+	}
+}
+
+func (buffer *offlineBuffer) len() int {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return len(buffer.messages)
+}
+
+// push appends msg, messages older than maxAge are removed first to make room
+func (buffer *offlineBuffer) push(msg *offlineMessage) (expired []*offlineMessage, err error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	for len(buffer.messages) > 0 && buffer.isExpired(buffer.messages[0], msg.createdAt) {
+		expired = append(expired, buffer.messages[0])
+		buffer.removeFront()
+	}
+	if len(buffer.messages) >= buffer.maxCount {
+		return expired, ErrOfflineBufferFull
+	}
+	if buffer.maxBytes > 0 && buffer.bytes+len(msg.content) > buffer.maxBytes {
+		return expired, ErrOfflineBufferFull
+	}
+	buffer.messages = append(buffer.messages, msg)
+	buffer.bytes += len(msg.content)
+	return expired, nil
+}
+
+// front returns the oldest message without removing it
+func (buffer *offlineBuffer) front() *offlineMessage {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	if len(buffer.messages) == 0 {
+		return nil
+	}
+	return buffer.messages[0]
+}
+
+// remove removes msg if it is still the oldest message
+func (buffer *offlineBuffer) remove(msg *offlineMessage) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	if len(buffer.messages) > 0 && buffer.messages[0] == msg {
+		buffer.removeFront()
+	}
+}
+
+func (buffer *offlineBuffer) removeFront() {
+	buffer.bytes -= len(buffer.messages[0].content)
+	buffer.messages[0] = nil
+	buffer.messages = buffer.messages[1:]
+}
+
+func (buffer *offlineBuffer) isExpired(msg *offlineMessage, now int64) bool {
+	if buffer.maxAge > 0 && time.Duration(now-msg.createdAt) >= buffer.maxAge {
+		return true
+	}
+	return msg.deadline != 0 && uint64(now/int64(time.Millisecond)) >= msg.deadline
+}
+
+// isOffline returns true if a message must go through the offline buffer
+// Messages are buffered until all earlier buffered messages are flushed, so the order is kept
+func (connector *connectorImpl) isOffline() bool {
+	if connector.offline == nil {
+		return false
+	}
+	return !connector.IsActivated() || connector.offline.len() > 0
+}
+
+func (connector *connectorImpl) pushOffline(msg *offlineMessage) error {
+	msg.createdAt = time.Now().UnixNano()
+	expired, err := connector.offline.push(msg)
+	for _, item := range expired {
+		connector.reportExpiredOffline(item)
+	}
+	return err
+}
+
+// flushOffline sends buffered messages in order, it is invoked on the listening goroutine
+// Flushing stops at the first failure and continues at the next tick
+func (connector *connectorImpl) flushOffline() {
+	if connector.offline == nil {
+		return
+	}
+	for connector.IsActivated() {
+		msg := connector.offline.front()
+		if msg == nil {
+			return
+		}
+		if connector.offline.isExpired(msg, time.Now().UnixNano()) {
+			connector.offline.remove(msg)
+			connector.reportExpiredOffline(msg)
+			continue
+		}
+		if connector.sendOffline(msg) != nil {
+			return
+		}
+		connector.offline.remove(msg)
+	}
+}
+
+func (connector *connectorImpl) sendOffline(msg *offlineMessage) error {
+	if msg.isRetry {
+		if connector.takeQueueIndex(msg.priority) == false {
+			return errors.New("Queue is full")
+		}
+		connector.pushPending(&csoqueue.ItemQueue{
+			MsgID:       connector.getCounter().NextWriteIndex(),
+			MsgTag:      0,
+			RecvName:    msg.name,
+			Content:     msg.content,
+			IsEncrypted: msg.isEncrypted,
+			IsCached:    false,
+			IsFirst:     true,
+			IsLast:      true,
+			IsRequest:   true,
+			IsGroup:     msg.isGroup,
+			NumberRetry: msg.numberRetry + 1,
+			Timestamp:   0,
+			Deadline:    msg.deadline,
+			Priority:    msg.priority,
+		})
+		connector.setQueueDepth()
+		return nil
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if msg.isGroup {
+		data, err = connector.parser.BuildGroupMessage(0, 0, msg.name, msg.content, msg.isEncrypted, msg.isCached, true, true, true)
+	} else {
+		data, err = connector.parser.BuildMessage(0, 0, msg.name, msg.content, msg.isEncrypted, msg.isCached, true, true, true)
+	}
+	if err != nil {
+		// The message can never be built, so it is dropped instead of blocking the buffer
+		connector.logger.Printf("Error offline message: %s", err.Error())
+		return nil
+	}
+	err = connector.writeMessage(data)
+	if err != nil {
+		return err
+	}
+	connector.metrics.MessageSent()
+	return nil
+}
+
+// reportExpiredOffline reports a buffered message which is too old, its ID is 0 because it was never queued
+func (connector *connectorImpl) reportExpiredOffline(msg *offlineMessage) {
+	connector.metrics.MessageExpired()
+	if connector.expiredHandler != nil {
+		connector.expiredHandler(0, msg.name, msg.isGroup, ErrDeadlineExceeded)
+	}
+}
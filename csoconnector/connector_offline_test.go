@@ -0,0 +1,148 @@
+package csoconnector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOfflineBufferLimits(t *testing.T) {
+	now := time.Now().UnixNano()
+	cases := []struct {
+		name     string
+		maxCount int
+		maxBytes int
+		contents []string
+		isFull   bool
+	}{
+		{"below limits", 2, 10, []string{"01234", "56789"}, false},
+		{"count", 2, 0, []string{"a", "b", "c"}, true},
+		{"bytes", 8, 10, []string{"01234", "56789", "a"}, true},
+	}
+	for _, c := range cases {
+		buffer := newOfflineBuffer(c.maxCount, c.maxBytes, 0)
+		var err error
+		for _, content := range c.contents {
+			_, err = buffer.push(&offlineMessage{content: []byte(content), createdAt: now})
+		}
+		if (err == ErrOfflineBufferFull) != c.isFull {
+			t.Errorf("[TestOfflineBufferLimits] invalid result of %s", c.name)
+		}
+		if c.isFull && buffer.len() != len(c.contents)-1 {
+			t.Errorf("[TestOfflineBufferLimits] rejected message of %s is buffered", c.name)
+		}
+	}
+
+	// Removing a message makes room for another one
+	buffer := newOfflineBuffer(1, 0, 0)
+	buffer.push(&offlineMessage{content: []byte("a"), createdAt: now})
+	buffer.remove(buffer.front())
+	if _, err := buffer.push(&offlineMessage{content: []byte("b"), createdAt: now}); err != nil || buffer.bytes != 1 {
+		t.Error("[TestOfflineBufferLimits] removed message is counted")
+	}
+}
+
+func TestOfflineBufferExpiry(t *testing.T) {
+	now := time.Now()
+	buffer := newOfflineBuffer(2, 0, time.Second)
+	old := &offlineMessage{name: "old", createdAt: now.Add(-2 * time.Second).UnixNano()}
+	deadline := &offlineMessage{name: "deadline", createdAt: now.UnixNano(), deadline: uint64(now.Add(-time.Millisecond).UnixNano() / int64(time.Millisecond))}
+	if buffer.isExpired(old, now.UnixNano()) == false || buffer.isExpired(deadline, now.UnixNano()) == false {
+		t.Error("[TestOfflineBufferExpiry] message is not expired by age or deadline")
+	}
+	if buffer.isExpired(&offlineMessage{createdAt: now.UnixNano()}, now.UnixNano()) {
+		t.Error("[TestOfflineBufferExpiry] new message is expired")
+	}
+
+	// Expired messages are removed to make room
+	buffer.push(old)
+	buffer.push(&offlineMessage{name: "new", createdAt: now.Add(-2 * time.Second).UnixNano()})
+	expired, err := buffer.push(&offlineMessage{name: "next", createdAt: now.UnixNano()})
+	if err != nil || len(expired) != 2 || expired[0].name != "old" || buffer.front().name != "next" {
+		t.Error("[TestOfflineBufferExpiry] expired messages are not removed in order")
+	}
+}
+
+func TestOfflineFlush(t *testing.T) {
+	connector, hub := newTestConnector(t, "sender", WithOfflineBuffer(4, 0, 0))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+
+	// Messages are accepted before activation
+	if connector.SendMessage("receiver", []byte("first"), false, false) != nil ||
+		connector.SendMessageAndRetry("receiver", []byte("second"), false, 3) != nil ||
+		connector.SendGroupMessage("group", []byte("third"), false, false) != nil ||
+		connector.SendMessageAndRetry("receiver", []byte("fourth"), false, 3) != nil {
+		t.Fatal("[TestOfflineFlush] message is not buffered")
+	}
+	if connector.SendMessage("receiver", []byte("fifth"), false, false) != ErrOfflineBufferFull {
+		t.Error("[TestOfflineFlush] message is buffered after the buffer is full")
+	}
+	hub.noMessage(50 * time.Millisecond)
+
+	// Messages without retry are sent in order after activation, then the retry queue sends the others in order
+	hub.activate()
+	for _, expected := range []struct {
+		content string
+		name    string
+		isRetry bool
+	}{
+		{"first", "receiver", false},
+		{"third", "group", false},
+		{"second", "receiver", true},
+		{"fourth", "receiver", true},
+	} {
+		msg := hub.nextData()
+		if string(msg.Data) != expected.content || msg.Name != expected.name || (msg.MessageID != 0) != expected.isRetry {
+			t.Errorf("[TestOfflineFlush] expected %q, got %q", expected.content, msg.Data)
+		}
+	}
+
+	// Messages are sent directly after the buffer is flushed
+	if connector.SendMessage("receiver", []byte("sixth"), false, false) != nil {
+		t.Fatal("[TestOfflineFlush] send failed")
+	}
+	if msg := hub.nextData(); string(msg.Data) != "sixth" {
+		t.Errorf("[TestOfflineFlush] expected %q, got %q", "sixth", msg.Data)
+	}
+}
+
+func TestOfflineExpiry(t *testing.T) {
+	chExpired := make(chan string, 4)
+	connector, hub := newTestConnector(t, "sender", WithOfflineBuffer(8, 0, 50*time.Millisecond), WithExpiredHandler(
+		func(msgID uint64, recvName string, isGroup bool, err error) {
+			if msgID == 0 && err == ErrDeadlineExceeded {
+				chExpired <- recvName
+			}
+		},
+	))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+
+	// A message is removed when a new message arrives after its age
+	connector.SendMessage("old", []byte("content"), false, false)
+	time.Sleep(60 * time.Millisecond)
+	connector.SendMessage("new", []byte("content"), false, false)
+	select {
+	case name := <-chExpired:
+		if name != "old" {
+			t.Errorf("[TestOfflineExpiry] expected expiry of %q, got %q", "old", name)
+		}
+	case <-hub.timeout():
+		t.Fatal("[TestOfflineExpiry] expiry is not reported")
+	}
+
+	// A message is removed when the connector is activated after its age
+	time.Sleep(60 * time.Millisecond)
+	hub.activate()
+	select {
+	case name := <-chExpired:
+		if name != "new" {
+			t.Errorf("[TestOfflineExpiry] expected expiry of %q, got %q", "new", name)
+		}
+	case <-hub.timeout():
+		t.Fatal("[TestOfflineExpiry] expiry is not reported by flushing")
+	}
+	hub.noMessage(50 * time.Millisecond)
+}
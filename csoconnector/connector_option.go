@@ -0,0 +1,285 @@
+package csoconnector
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+	"github.com/gecosys/cso-client-golang/csocounter"
+	"github.com/gecosys/cso-client-golang/csoe2e"
+	"github.com/gecosys/cso-client-golang/csoidempotency"
+	"github.com/gecosys/cso-client-golang/csolimiter"
+	"github.com/gecosys/cso-client-golang/csometrics"
+	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/csosignature"
+	"github.com/gecosys/cso-client-golang/csotracing"
+)
+
+// Option configures optional components and tunables of Connector
+// Options are applied in order, so later options override earlier ones
+type Option func(connector *connectorImpl)
+
+// WithOptions overrides tunables by non-zero and explicitly set fields of opts (e.g. loaded by config.NewOptionsFromFile)
+// Invalid opts are logged and skipped
+func WithOptions(opts *config.Options) Option {
+	return func(connector *connectorImpl) {
+		err := connector.options.Merge(opts)
+		if err != nil {
+			connector.optionErrors = append(connector.optionErrors, err)
+		}
+	}
+}
+
+// WithQueueSize sets capacity of the retry queue
+func WithQueueSize(size int32) Option {
+	return func(connector *connectorImpl) {
+		connector.options.QueueSize = size
+	}
+}
+
+// WithPriorityQueue sets capacities of priority classes of the retry queue and the starvation guard
+// caps are indexed from csoqueue.PriorityLow to csoqueue.PriorityHigh, 0 means the capacity of the queue
+func WithPriorityQueue(caps [csoqueue.NumberPriorities]int32, starvationLimit int) Option {
+	return func(connector *connectorImpl) {
+		connector.options.QueueSizeLow = caps[0]
+		connector.options.QueueSizeNormal = caps[1]
+		connector.options.QueueSizeHigh = caps[2]
+		connector.options.StarvationLimit = starvationLimit
+	}
+}
+
+// WithBufferSize sets capacity of the channel of received messages
+func WithBufferSize(size int32) Option {
+	return func(connector *connectorImpl) {
+		connector.options.BufferSize = size
+	}
+}
+
+// WithResendInterval sets interval of resending an unacknowledged message
+func WithResendInterval(interval time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.ResendInterval = config.Duration(interval)
+	}
+}
+
+// WithTickInterval sets interval of taking the next message from the retry queue
+func WithTickInterval(interval time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.TickInterval = config.Duration(interval)
+	}
+}
+
+// WithReconnectDelay sets delay before reconnecting to the Cloud Socket system
+func WithReconnectDelay(delay time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.ReconnectDelay = config.Duration(delay)
+	}
+}
+
+// WithActivationInterval sets interval of resending the activation message
+func WithActivationInterval(interval time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.ActivationInterval = config.Duration(interval)
+	}
+}
+
+// WithDialTimeout sets timeout of dialing the Hub server
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.DialTimeout = config.Duration(timeout)
+	}
+}
+
+// WithReplayWindow sets number of message indices tracked by the replay-protection window
+func WithReplayWindow(size uint32) Option {
+	return func(connector *connectorImpl) {
+		connector.options.ReplayWindow = size
+	}
+}
+
+// WithCounterStore saves processed message tags and used write indices to store
+// A message which was handled and saved before a crash is not handled again after restarting
+func WithCounterStore(store csocounter.Store) Option {
+	return func(connector *connectorImpl) {
+		connector.counterStore = store
+	}
+}
+
+// WithResponseCache answers duplicates of handled messages by their cached responses without running the handler
+// Failed messages are not cached, so their retries run the handler again
+func WithResponseCache(cache csoidempotency.Cache) Option {
+	return func(connector *connectorImpl) {
+		connector.responseCache = cache
+	}
+}
+
+// WithResponseHandler sets handler which is notified of responses of messages sent by retry methods
+// The handler is invoked on the listening goroutine, so it must not block
+func WithResponseHandler(handler ResponseHandler) Option {
+	return func(connector *connectorImpl) {
+		connector.responseHandler = handler
+	}
+}
+
+// WithExpiredHandler sets handler which is notified of messages removed from the retry queue without response
+// The handler is invoked on the listening goroutine or a sending goroutine, so it must not block
+func WithExpiredHandler(handler ExpiredHandler) Option {
+	return func(connector *connectorImpl) {
+		connector.expiredHandler = handler
+	}
+}
+
+// WithOfflineBuffer accepts messages while the connector is not activated and hands them over in order after activation
+// Messages without retry are sent immediately, messages with retry are pushed into the retry queue and sent by it
+// The buffer is bounded by number of messages, total bytes of contents (0 means no limit) and age (0 means no limit)
+func WithOfflineBuffer(maxCount int, maxBytes int, maxAge time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.OfflineBufferSize = maxCount
+		connector.options.OfflineBufferBytes = maxBytes
+		connector.options.OfflineBufferAge = config.Duration(maxAge)
+	}
+}
+
+// WithRateLimiter limits rate of messages sent by the Send methods
+func WithRateLimiter(limiter csolimiter.Limiter) Option {
+	return func(connector *connectorImpl) {
+		connector.limiter = limiter
+	}
+}
+
+// WithHTTPClient sets the client which sends HTTP requests to the Proxy server, it can be shared by connectors
+// Its timeout is kept unless http_timeout is set by WithOptions
+func WithHTTPClient(client *http.Client) Option {
+	return func(connector *connectorImpl) {
+		connector.httpClient = client
+	}
+}
+
+// WithE2E sets Encryptor which encrypts messages sent with ContextWithE2E and decrypts received messages
+func WithE2E(encryptor csoe2e.Encryptor) Option {
+	return func(connector *connectorImpl) {
+		connector.e2e = encryptor
+	}
+}
+
+// WithGroupNoticeHandler sets handler which is notified of membership changes of groups
+func WithGroupNoticeHandler(handler GroupNoticeHandler) Option {
+	return func(connector *connectorImpl) {
+		connector.noticeHandler = handler
+	}
+}
+
+// WithSigner signs contents of all sent messages by signer
+func WithSigner(signer csosignature.Signer) Option {
+	return func(connector *connectorImpl) {
+		connector.signer = signer
+	}
+}
+
+// WithTrustStore verifies signatures of received messages by keys of trust
+// Messages which are not accepted by policy are acknowledged but not delivered to handlers
+func WithTrustStore(trust csosignature.TrustStore, policy csosignature.Policy) Option {
+	return WithVerifier(csosignature.NewVerifier(trust, csosignature.DefaultMaxAge, csosignature.DefaultReplayCapacity), policy)
+}
+
+// WithVerifier verifies signatures of received messages by verifier, e.g. with a custom max age
+func WithVerifier(verifier csosignature.Verifier, policy csosignature.Policy) Option {
+	return func(connector *connectorImpl) {
+		if verifier != nil {
+			connector.verifier = verifier
+		}
+		connector.signaturePolicy = policy
+	}
+}
+
+// WithLogger sets logger of errors, nil disables logging
+func WithLogger(logger *log.Logger) Option {
+	return func(connector *connectorImpl) {
+		if logger == nil {
+			connector.options.DisableLogging = true
+			return
+		}
+		connector.options.DisableLogging = false
+		connector.logger = logger
+	}
+}
+
+// WithMetrics sets Metrics which records statistics of the connector
+func WithMetrics(metrics csometrics.Metrics) Option {
+	return func(connector *connectorImpl) {
+		if metrics != nil {
+			connector.metrics = metrics
+		}
+	}
+}
+
+// WithTracer sets Tracer which creates spans and propagates trace context through messages to peers set by WithTracePeers
+func WithTracer(tracer csotracing.Tracer) Option {
+	return func(connector *connectorImpl) {
+		if tracer != nil {
+			connector.tracer = tracer
+		}
+	}
+}
+
+// WithTracePeers sets connections and groups which trace context is propagated to and extracted from
+// Trace context is sent in an envelope, so peers must run a version of the library which supports envelopes
+// AllPeers propagates trace context to all peers, by default it is not propagated to any peer
+func WithTracePeers(names ...string) Option {
+	return func(connector *connectorImpl) {
+		connector.tracePeers = make(map[string]bool, len(names))
+		for _, name := range names {
+			connector.tracePeers[name] = true
+		}
+	}
+}
+
+// WithSessionResumption reuses the last ticket and secret key on reconnect instead of registering again
+// The ticket is dropped when the Hub server rejects it or it is older than lifetime
+func WithSessionResumption(lifetime time.Duration) Option {
+	return func(connector *connectorImpl) {
+		connector.options.TicketLifetime = config.Duration(lifetime)
+	}
+}
+
+// WithKeyExchange sets key exchange with the Proxy server (config.KeyExchangeDH, config.KeyExchangeX25519 or config.KeyExchangeX25519Only)
+func WithKeyExchange(keyExchange string) Option {
+	return func(connector *connectorImpl) {
+		connector.options.KeyExchange = keyExchange
+	}
+}
+
+// WithKeyRotation registers again in background and switches to the new session key after the key is used
+// for interval, maxBytes bytes or maxMessages messages (0 disables the limit)
+// A new key needs a new connection to the Hub server, so the connector waits until sent messages of the retry queue
+// are acknowledged (at most a resend interval) and reconnects. Unacknowledged messages are resent by the new key.
+// Messages which the Hub server delivered by the old key are accepted until the new key is activated
+func WithKeyRotation(interval time.Duration, maxBytes, maxMessages int64) Option {
+	return func(connector *connectorImpl) {
+		connector.options.KeyRotationInterval = config.Duration(interval)
+		connector.options.KeyRotationBytes = maxBytes
+		connector.options.KeyRotationMessages = maxMessages
+	}
+}
+
+// WithCompression compresses content larger than threshold (bytes) by algorithm before encryption
+// Supported algorithms are defined in utils (CompressionGzip, CompressionZstd, CompressionSnappy)
+// The parser must implement csoparser.CompressionParser, content is not compressed otherwise
+// Content sent with ContextWithE2E is sealed before the parser sees it, so it is not compressed
+func WithCompression(algorithm string, threshold int) Option {
+	return func(connector *connectorImpl) {
+		connector.options.Compression = algorithm
+		connector.options.CompressionThreshold = threshold
+	}
+}
+
+// WithConfigWatcher applies configs notified by watcher at the next reconnect
+// The connection is closed to reconnect immediately if forceReconnect is true
+// Updates of watcher are read until it is closed
+func WithConfigWatcher(watcher config.Watcher, forceReconnect bool) Option {
+	return func(connector *connectorImpl) {
+		connector.watcher = watcher
+		connector.isForcedReload = forceReconnect
+	}
+}
@@ -0,0 +1,276 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+// Pool is Connector which keeps many connections under distinct connection names
+// Sends are balanced over activated connections and received messages of all connections are merged
+type Pool interface {
+	Connector
+
+	Size() int
+	GetConnector(idx int) Connector
+}
+
+// ErrEmptyPool is returned when a pool is created without connectors
+var ErrEmptyPool = errors.New("Pool is empty")
+
+// GroupError is returned when some connections of a pool fail to join or leave a group
+type GroupError struct {
+	Group  string
+	Errors map[string]error // errors by connection name
+}
+
+func (err *GroupError) Error() string {
+	names := make([]string, 0, len(err.Errors))
+	for name := range err.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("Group %q failed on connections %s: %s", err.Group, strings.Join(names, ", "), err.Errors[names[0]].Error())
+}
+
+type poolImpl struct {
+	connectors []Connector
+	next       uint32
+	mutexConf  sync.Mutex
+	conf       config.Config
+}
+
+// DefaultPool inits a new instance of Pool interface with size connectors created by DefaultConnector
+// Connection names are the name of conf with suffix "-0", "-1", ...
+// Options are applied to every connector, so stateful components (e.g. WithCounterStore) must not be shared
+// ErrEmptyPool is returned if size is not positive
+func DefaultPool(size int, bufferSize int32, conf config.Config, opts ...Option) (Pool, error) {
+	if size <= 0 {
+		return nil, ErrEmptyPool
+	}
+	connectors := make([]Connector, size)
+	for idx := range connectors {
+		connectors[idx] = DefaultConnector(bufferSize, poolConfig(conf, idx), opts...)
+	}
+	return &poolImpl{
+		connectors: connectors,
+		conf:       conf,
+	}, nil
+}
+
+// NewPool inits a new instance of Pool interface with connectors which must have distinct connection names
+// ErrEmptyPool is returned if connectors is empty
+func NewPool(connectors []Connector) (Pool, error) {
+	if len(connectors) == 0 {
+		return nil, ErrEmptyPool
+	}
+	return &poolImpl{connectors: connectors}, nil
+}
+
+func poolConfig(conf config.Config, idx int) config.Config {
+	return config.WithConnectionName(conf, fmt.Sprintf("%s-%d", conf.GetConnectionName(), idx))
+}
+
+func (pool *poolImpl) Size() int {
+	return len(pool.connectors)
+}
+
+func (pool *poolImpl) GetConnector(idx int) Connector {
+	return pool.connectors[idx]
+}
+
+// IsActivated returns true if any connection is activated
+func (pool *poolImpl) IsActivated() bool {
+	for _, connector := range pool.connectors {
+		if connector.IsActivated() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConnectionName returns the name which connection names are derived from
+// It is the name of the first connection if the pool was created by NewPool
+func (pool *poolImpl) GetConnectionName() string {
+	pool.mutexConf.Lock()
+	defer pool.mutexConf.Unlock()
+	if pool.conf != nil {
+		return pool.conf.GetConnectionName()
+	}
+	return pool.connectors[0].GetConnectionName()
+}
+
+// JoinGroup adds all connections to a group
+// If any connection fails, the others leave the group again and a GroupError reports the failed connections
+func (pool *poolImpl) JoinGroup(ctx context.Context, groupName string) error {
+	joined := make([]Connector, 0, len(pool.connectors))
+	errs := make(map[string]error)
+	for _, connector := range pool.connectors {
+		err := connector.JoinGroup(ctx, groupName)
+		if err != nil {
+			errs[connector.GetConnectionName()] = err
+			continue
+		}
+		joined = append(joined, connector)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, connector := range joined {
+		err := connector.LeaveGroup(ctx, groupName)
+		if err != nil {
+			errs[connector.GetConnectionName()] = err // the connection stays in the group
+		}
+	}
+	return &GroupError{Group: groupName, Errors: errs}
+}
+
+// LeaveGroup removes all connections from a group
+// Every connection tries to leave, a GroupError reports the connections which are still in the group
+func (pool *poolImpl) LeaveGroup(ctx context.Context, groupName string) error {
+	errs := make(map[string]error)
+	for _, connector := range pool.connectors {
+		err := connector.LeaveGroup(ctx, groupName)
+		if err != nil {
+			errs[connector.GetConnectionName()] = err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &GroupError{Group: groupName, Errors: errs}
+}
+
+// GetGroups returns groups of the first connection, connections join and leave groups together
+func (pool *poolImpl) GetGroups(ctx context.Context) ([]string, error) {
+	return pool.connectors[0].GetGroups(ctx)
+}
+
+// pick returns the next activated connector in round-robin order
+// The next connector is returned if none is activated, so the send follows its behavior (wait, buffer or fail)
+func (pool *poolImpl) pick() Connector {
+	size := uint32(len(pool.connectors))
+	start := atomic.AddUint32(&pool.next, 1) - 1
+	for offset := uint32(0); offset < size; offset++ {
+		connector := pool.connectors[(start+offset)%size]
+		if connector.IsActivated() {
+			return connector
+		}
+	}
+	return pool.connectors[start%size]
+}
+
+func (pool *poolImpl) Listen(cb func(sender string, data []byte) error) error {
+	return pool.ListenWithContext(func(ctx context.Context, sender string, data []byte) error {
+		return cb(sender, data)
+	})
+}
+
+func (pool *poolImpl) ListenWithContext(cb func(ctx context.Context, sender string, data []byte) error) error {
+	return pool.ListenWithResponse(func(ctx context.Context, sender string, data []byte) ([]byte, error) {
+		return nil, cb(ctx, sender, data)
+	})
+}
+
+// ListenWithResponse listens on all connections, cb is invoked concurrently by connections
+// Each connection reconnects independently, the method returns when all connections stop
+func (pool *poolImpl) ListenWithResponse(cb func(ctx context.Context, sender string, data []byte) ([]byte, error)) error {
+	var (
+		wg       sync.WaitGroup
+		mutexErr sync.Mutex
+		firstErr error
+	)
+	for _, connector := range pool.connectors {
+		wg.Add(1)
+		go func(connector Connector) {
+			defer wg.Done()
+			err := connector.ListenWithResponse(cb)
+			mutexErr.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mutexErr.Unlock()
+		}(connector)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (pool *poolImpl) SendMessage(recvName string, content []byte, isEncrypted, isCached bool) error {
+	return pool.pick().SendMessage(recvName, content, isEncrypted, isCached)
+}
+
+func (pool *poolImpl) SendGroupMessage(groupName string, content []byte, isEncrypted, isCached bool) error {
+	return pool.pick().SendGroupMessage(groupName, content, isEncrypted, isCached)
+}
+
+func (pool *poolImpl) SendMessageAndRetry(recvName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return pool.pick().SendMessageAndRetry(recvName, content, isEncrypted, numberRetry)
+}
+
+func (pool *poolImpl) SendGroupMessageAndRetry(groupName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return pool.pick().SendGroupMessageAndRetry(groupName, content, isEncrypted, numberRetry)
+}
+
+func (pool *poolImpl) SendMessageCtx(ctx context.Context, recvName string, content []byte, isEncrypted, isCached bool) error {
+	return pool.pick().SendMessageCtx(ctx, recvName, content, isEncrypted, isCached)
+}
+
+func (pool *poolImpl) SendGroupMessageCtx(ctx context.Context, groupName string, content []byte, isEncrypted, isCached bool) error {
+	return pool.pick().SendGroupMessageCtx(ctx, groupName, content, isEncrypted, isCached)
+}
+
+func (pool *poolImpl) SendMessageAndRetryCtx(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return pool.pick().SendMessageAndRetryCtx(ctx, recvName, content, isEncrypted, numberRetry)
+}
+
+func (pool *poolImpl) SendGroupMessageAndRetryCtx(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32) error {
+	return pool.pick().SendGroupMessageAndRetryCtx(ctx, groupName, content, isEncrypted, numberRetry)
+}
+
+// SendMessageAndRetryWithTTL returns the ID of the message in the chosen connection, IDs of connections may overlap
+func (pool *poolImpl) SendMessageAndRetryWithTTL(ctx context.Context, recvName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error) {
+	return pool.pick().SendMessageAndRetryWithTTL(ctx, recvName, content, isEncrypted, numberRetry, ttl)
+}
+
+// SendGroupMessageAndRetryWithTTL returns the ID of the message in the chosen connection, IDs of connections may overlap
+func (pool *poolImpl) SendGroupMessageAndRetryWithTTL(ctx context.Context, groupName string, content []byte, isEncrypted bool, numberRetry int32, ttl time.Duration) (uint64, error) {
+	return pool.pick().SendGroupMessageAndRetryWithTTL(ctx, groupName, content, isEncrypted, numberRetry, ttl)
+}
+
+// UpdateConfig applies conf to all connections
+// Connection names are derived from conf if the pool was created by DefaultPool, otherwise they are kept
+func (pool *poolImpl) UpdateConfig(conf config.Config, forceReconnect bool) error {
+	err := config.Validate(conf)
+	if err != nil {
+		return err
+	}
+
+	pool.mutexConf.Lock()
+	isDerived := pool.conf != nil
+	if isDerived {
+		pool.conf = conf
+	}
+	pool.mutexConf.Unlock()
+
+	for idx, connector := range pool.connectors {
+		var memberConf config.Config
+		if isDerived {
+			memberConf = poolConfig(conf, idx)
+		} else {
+			memberConf = config.WithConnectionName(conf, connector.GetConnectionName())
+		}
+		err = connector.UpdateConfig(memberConf, forceReconnect)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
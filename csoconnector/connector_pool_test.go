@@ -0,0 +1,162 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+var errTestGroup = errors.New("group failed")
+
+// fakeMember is a Connector of a pool which records sends and group membership
+type fakeMember struct {
+	Connector
+	name        string
+	isActivated bool
+	numberSent  int
+	groups      map[string]bool
+	joinErr     error
+	leaveErr    error
+}
+
+func newFakeMember(name string, isActivated bool) *fakeMember {
+	return &fakeMember{name: name, isActivated: isActivated, groups: make(map[string]bool)}
+}
+
+func (member *fakeMember) IsActivated() bool {
+	return member.isActivated
+}
+
+func (member *fakeMember) GetConnectionName() string {
+	return member.name
+}
+
+func (member *fakeMember) SendMessage(recvName string, content []byte, isEncrypted, isCached bool) error {
+	member.numberSent++
+	return nil
+}
+
+func (member *fakeMember) JoinGroup(ctx context.Context, groupName string) error {
+	if member.joinErr != nil {
+		return member.joinErr
+	}
+	member.groups[groupName] = true
+	return nil
+}
+
+func (member *fakeMember) LeaveGroup(ctx context.Context, groupName string) error {
+	if member.leaveErr != nil {
+		return member.leaveErr
+	}
+	delete(member.groups, groupName)
+	return nil
+}
+
+func TestPoolSize(t *testing.T) {
+	conf := config.NewConfig("project", "dG9rZW4=", "pool", "key", "http://proxy")
+	for _, size := range []int{0, -1} {
+		if _, err := DefaultPool(size, 16, conf); err != ErrEmptyPool {
+			t.Errorf("[TestPoolSize] pool of size %d is created", size)
+		}
+	}
+	if _, err := NewPool(nil); err != ErrEmptyPool {
+		t.Error("[TestPoolSize] pool without connectors is created")
+	}
+
+	pool, err := DefaultPool(2, 16, conf, WithLogger(nil))
+	if err != nil || pool.Size() != 2 {
+		t.Fatal("[TestPoolSize] create pool failed")
+	}
+	if pool.GetConnector(1).GetConnectionName() != "pool-1" || pool.GetConnectionName() != "pool" {
+		t.Error("[TestPoolSize] invalid connection names")
+	}
+}
+
+func TestPoolPick(t *testing.T) {
+	members := []*fakeMember{newFakeMember("a", true), newFakeMember("b", false), newFakeMember("c", true)}
+	pool, _ := NewPool([]Connector{members[0], members[1], members[2]})
+	for idx := 0; idx < 6; idx++ {
+		pool.SendMessage("receiver", []byte("content"), false, false)
+	}
+	if members[0].numberSent+members[2].numberSent != 6 || members[1].numberSent != 0 {
+		t.Error("[TestPoolPick] message is sent by a connection which is not activated")
+	}
+	if members[0].numberSent < 2 || members[2].numberSent < 2 {
+		t.Error("[TestPoolPick] messages are not balanced")
+	}
+
+	// The next connection is used if none is activated
+	idle, _ := NewPool([]Connector{newFakeMember("d", false)})
+	idle.SendMessage("receiver", []byte("content"), false, false)
+	if idle.GetConnector(0).(*fakeMember).numberSent != 1 {
+		t.Error("[TestPoolPick] message is dropped when no connection is activated")
+	}
+}
+
+func TestPoolPickConcurrent(t *testing.T) {
+	connector1, hub1 := newTestConnector(t, "pool-0")
+	connector2, hub2 := newTestConnector(t, "pool-1")
+	pool, _ := NewPool([]Connector{connector1, connector2})
+	go pool.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub1.activate()
+	waitActivated(t, connector1)
+
+	// Connections are picked by sending goroutines while the listening goroutines activate them
+	var wg sync.WaitGroup
+	chErr := make(chan error, 20)
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := 0; num < 5; num++ {
+				chErr <- pool.SendMessage("receiver", []byte("content"), false, false)
+			}
+		}()
+	}
+	hub2.activate()
+	wg.Wait()
+	close(chErr)
+	for err := range chErr {
+		if err != nil {
+			t.Fatal("[TestPoolPickConcurrent] send failed")
+		}
+	}
+	waitActivated(t, pool)
+}
+
+func TestPoolGroup(t *testing.T) {
+	members := []*fakeMember{newFakeMember("a", true), newFakeMember("b", true), newFakeMember("c", true)}
+	members[1].joinErr = errTestGroup
+	pool, _ := NewPool([]Connector{members[0], members[1], members[2]})
+
+	// Joined connections leave again when any connection fails
+	err := pool.JoinGroup(context.Background(), "group")
+	groupErr, isOk := err.(*GroupError)
+	if !isOk || len(groupErr.Errors) != 1 || groupErr.Errors["b"] != errTestGroup {
+		t.Fatal("[TestPoolGroup] failed connection is not reported")
+	}
+	if members[0].groups["group"] || members[2].groups["group"] {
+		t.Error("[TestPoolGroup] join is not rolled back")
+	}
+
+	members[1].joinErr = nil
+	if pool.JoinGroup(context.Background(), "group") != nil {
+		t.Fatal("[TestPoolGroup] join failed")
+	}
+
+	// Every connection tries to leave
+	members[0].leaveErr = errTestGroup
+	err = pool.LeaveGroup(context.Background(), "group")
+	groupErr, isOk = err.(*GroupError)
+	if !isOk || len(groupErr.Errors) != 1 || groupErr.Errors["a"] == nil {
+		t.Error("[TestPoolGroup] failed connection is not reported")
+	}
+	if !members[0].groups["group"] || members[1].groups["group"] || members[2].groups["group"] {
+		t.Error("[TestPoolGroup] connections after a failed connection do not leave")
+	}
+}
@@ -0,0 +1,192 @@
+package csoconnector
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoconnection"
+	"github.com/gecosys/cso-client-golang/csoparser"
+	"github.com/gecosys/cso-client-golang/csoproxy"
+)
+
+// keyRotation tracks usage of the session key and the ticket registered to replace it
+type keyRotation struct {
+	bytes    int64 // sent and received by the session key
+	messages int64
+
+	mutex       sync.Mutex
+	generation  uint64 // increased for every session key, a registration of an old key is discarded
+	issuedAt    time.Time
+	nextAttempt time.Time // registration is not retried before this time after an error
+	isRotating  bool
+	ticket      *csoproxy.ServerTicket // registered ticket which is not used yet
+	drainedAt   time.Time              // time which the ticket was registered, the connection is drained since then
+}
+
+func newKeyRotation() *keyRotation {
+	return &keyRotation{issuedAt: time.Now()}
+}
+
+// isKeyRotationEnabled checks if any limit of the session key is set
+func (connector *connectorImpl) isKeyRotationEnabled() bool {
+	return connector.options.KeyRotationInterval > 0 ||
+		connector.options.KeyRotationBytes > 0 ||
+		connector.options.KeyRotationMessages > 0
+}
+
+// countKeyUsage records a message of size bytes sent or received by the session key
+func (connector *connectorImpl) countKeyUsage(size int) {
+	if connector.rotation == nil {
+		return
+	}
+	atomic.AddInt64(&connector.rotation.bytes, int64(size))
+	atomic.AddInt64(&connector.rotation.messages, 1)
+}
+
+// startKeyUsage starts tracking the session key of serverTicket, it is invoked by loopReconnect only
+// Usage is kept when the key of a resumed session is reused
+func (connector *connectorImpl) startKeyUsage(serverTicket *csoproxy.ServerTicket, isResumed bool) {
+	rotation := connector.rotation
+	if rotation == nil {
+		return
+	}
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+	if isResumed {
+		return
+	}
+	rotation.generation++
+	rotation.issuedAt = serverTicket.IssuedAt
+	rotation.ticket = nil
+	atomic.StoreInt64(&rotation.bytes, 0)
+	atomic.StoreInt64(&rotation.messages, 0)
+}
+
+// isKeyExhausted checks if the session key reaches any limit
+func (connector *connectorImpl) isKeyExhausted() bool {
+	rotation := connector.rotation
+	if interval := time.Duration(connector.options.KeyRotationInterval); interval > 0 && time.Since(rotation.issuedAt) >= interval {
+		return true
+	}
+	if limit := connector.options.KeyRotationBytes; limit > 0 && atomic.LoadInt64(&rotation.bytes) >= limit {
+		return true
+	}
+	if limit := connector.options.KeyRotationMessages; limit > 0 && atomic.LoadInt64(&rotation.messages) >= limit {
+		return true
+	}
+	return false
+}
+
+// checkKeyRotation registers again in background when the session key reaches a limit
+// Once the new ticket is registered, the connection is drained: items of the retry queue are not sent,
+// and the connection switches to the new ticket when all sent items are acknowledged or a resend interval passes.
+// It returns true while the connection is drained.
+// Items which are not acknowledged are kept and resent by the new key, so receivers may get them twice.
+// It is invoked by the listening goroutine, so no handler is running when the connection switches
+func (connector *connectorImpl) checkKeyRotation() bool {
+	rotation := connector.rotation
+	if rotation == nil {
+		return false
+	}
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+	if rotation.ticket != nil {
+		if !connector.IsActivated() {
+			return true // the connection is switching to the new ticket
+		}
+		if !connector.hasSentItems() || time.Since(rotation.drainedAt) >= time.Duration(connector.options.ResendInterval) {
+			connector.switchKey(rotation.generation)
+		}
+		return true
+	}
+	if !connector.IsActivated() || rotation.isRotating || time.Now().Before(rotation.nextAttempt) || !connector.isKeyExhausted() {
+		return false
+	}
+	rotation.isRotating = true
+	go connector.rotateKey(rotation.generation)
+	return false
+}
+
+// switchKey stops sending by the current key and closes the connection to reconnect by the new ticket
+// The connector is not activated meanwhile, so new messages are handled as while it reconnects.
+// The connection keeps receiving until the Hub server closes it, so messages which the Hub server sent
+// by the current key are parsed by the previous key and handled after the new connection is activated.
+// The connection is closed after a resend interval if the Hub server does not close it
+func (connector *connectorImpl) switchKey(generation uint64) {
+	connector.setActivated(false)
+	conn, isOk := connector.conn.(csoconnection.HalfCloseConnection)
+	if !isOk || conn.CloseWrite() != nil {
+		connector.conn.Close()
+		return
+	}
+	rotation := connector.rotation
+	time.AfterFunc(time.Duration(connector.options.ResendInterval), func() {
+		rotation.mutex.Lock()
+		defer rotation.mutex.Unlock()
+		if rotation.generation == generation {
+			connector.conn.Close() // the new ticket is not used yet
+		}
+	})
+}
+
+// setSecretKey sets the session key of a new connection
+// The previous key is kept until the new connection is activated if the parser supports it
+func (connector *connectorImpl) setSecretKey(secretKey []byte) {
+	if parser, isOk := connector.parser.(csoparser.KeyRotationParser); isOk {
+		parser.RotateSecretKey(secretKey)
+		return
+	}
+	connector.parser.SetSecretKey(secretKey)
+}
+
+// dropPreviousKey stops accepting the previous session key after the Hub server activates the new one
+func (connector *connectorImpl) dropPreviousKey() {
+	if parser, isOk := connector.parser.(csoparser.KeyRotationParser); isOk {
+		parser.DropPreviousKey()
+	}
+}
+
+// rotateKey registers a new ticket while the current connection keeps working
+func (connector *connectorImpl) rotateKey(generation uint64) {
+	serverTicket, err := connector.prepare()
+
+	rotation := connector.rotation
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+	rotation.isRotating = false
+	if err != nil {
+		connector.logger.Printf("Error rotate key: %s", err.Error())
+		rotation.nextAttempt = time.Now().Add(time.Duration(connector.options.ReconnectDelay))
+		return
+	}
+	if rotation.generation != generation {
+		return // the connector reconnected by another key meanwhile
+	}
+	rotation.ticket = serverTicket
+	rotation.drainedAt = time.Now()
+}
+
+// takeRotatedTicket returns the ticket registered by rotation, it is invoked by loopReconnect only
+func (connector *connectorImpl) takeRotatedTicket() *csoproxy.ServerTicket {
+	rotation := connector.rotation
+	if rotation == nil {
+		return nil
+	}
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+	serverTicket := rotation.ticket
+	rotation.ticket = nil
+	return serverTicket
+}
+
+// hasRotatedTicket checks if a ticket registered by rotation is waiting to be used
+func (connector *connectorImpl) hasRotatedTicket() bool {
+	rotation := connector.rotation
+	if rotation == nil {
+		return false
+	}
+	rotation.mutex.Lock()
+	defer rotation.mutex.Unlock()
+	return rotation.ticket != nil
+}
@@ -0,0 +1,203 @@
+package csoconnector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoproxy"
+	"github.com/gecosys/cso-client-golang/message/cipher"
+)
+
+func TestKeyRotationTrigger(t *testing.T) {
+	cases := []struct {
+		name        string
+		interval    time.Duration
+		maxBytes    int64
+		maxMessages int64
+		use         func(connector *connectorImpl)
+		isExhausted bool
+	}{
+		{"unused", time.Hour, 100, 10, func(connector *connectorImpl) {}, false},
+		{"interval", time.Minute, 0, 0, func(connector *connectorImpl) {
+			connector.rotation.issuedAt = time.Now().Add(-time.Minute)
+		}, true},
+		{"bytes below", 0, 100, 0, func(connector *connectorImpl) { connector.countKeyUsage(99) }, false},
+		{"bytes", 0, 100, 0, func(connector *connectorImpl) { connector.countKeyUsage(60); connector.countKeyUsage(40) }, true},
+		{"messages below", 0, 0, 3, func(connector *connectorImpl) { connector.countKeyUsage(1); connector.countKeyUsage(1) }, false},
+		{"messages", 0, 0, 3, func(connector *connectorImpl) {
+			for idx := 0; idx < 3; idx++ {
+				connector.countKeyUsage(1)
+			}
+		}, true},
+	}
+	for _, c := range cases {
+		connector, _ := newTestConnector(t, "connection", WithKeyRotation(c.interval, c.maxBytes, c.maxMessages))
+		c.use(connector)
+		if connector.isKeyExhausted() != c.isExhausted {
+			t.Errorf("[TestKeyRotationTrigger] invalid result of %s", c.name)
+		}
+	}
+
+	connector, _ := newTestConnector(t, "connection")
+	if connector.rotation != nil {
+		t.Error("[TestKeyRotationTrigger] rotation is enabled without limits")
+	}
+}
+
+func TestKeyRotationGeneration(t *testing.T) {
+	connector, _ := newTestConnector(t, "connection", WithKeyRotation(0, 0, 1))
+	connector.startKeyUsage(&csoproxy.ServerTicket{IssuedAt: time.Now()}, false)
+	generation := connector.rotation.generation
+
+	connector.rotateKey(generation)
+	if !connector.hasRotatedTicket() {
+		t.Fatal("[TestKeyRotationGeneration] ticket of the current key is discarded")
+	}
+	if connector.takeRotatedTicket() == nil || connector.takeRotatedTicket() != nil || connector.hasRotatedTicket() {
+		t.Error("[TestKeyRotationGeneration] ticket must be taken once")
+	}
+
+	// The connector reconnected by another key during the registration
+	connector.countKeyUsage(10)
+	connector.startKeyUsage(&csoproxy.ServerTicket{IssuedAt: time.Now()}, false)
+	connector.rotateKey(generation)
+	if connector.hasRotatedTicket() {
+		t.Error("[TestKeyRotationGeneration] ticket of an old key is kept")
+	}
+	if connector.isKeyExhausted() {
+		t.Error("[TestKeyRotationGeneration] usage of a new key is not reset")
+	}
+
+	// Usage of a resumed session is kept
+	connector.countKeyUsage(10)
+	connector.startKeyUsage(&csoproxy.ServerTicket{IssuedAt: time.Now()}, true)
+	if connector.rotation.generation != generation+1 || !connector.isKeyExhausted() {
+		t.Error("[TestKeyRotationGeneration] resumed session changes the key")
+	}
+}
+
+// setRotatedTicket registers a ticket of secretKey as if the key reached a limit
+func setRotatedTicket(connector *connectorImpl, secretKey []byte) {
+	connector.rotation.mutex.Lock()
+	defer connector.rotation.mutex.Unlock()
+	connector.rotation.ticket = &csoproxy.ServerTicket{
+		HubAddress:      "hub",
+		TicketID:        100,
+		TicketBytes:     make([]byte, 34),
+		ServerSecretKey: secretKey,
+		IssuedAt:        time.Now(),
+	}
+	connector.rotation.drainedAt = time.Now()
+}
+
+func waitWriteClosed(t *testing.T, conn *fakeConn) {
+	deadline := time.Now().Add(testTimeout)
+	for !conn.writeClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("[waitWriteClosed] timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKeyRotationDrain(t *testing.T) {
+	connector, hub := newTestConnector(t, "sender", WithKeyRotation(time.Hour, 0, 0), WithResendInterval(time.Second))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	err := connector.SendMessageAndRetry("receiver", []byte("content"), false, 3)
+	if err != nil {
+		t.Fatal("[TestKeyRotationDrain] send failed")
+	}
+	msg := hub.nextData()
+
+	// A new ticket is registered while the message waits for its response
+	setRotatedTicket(connector, testSecretKey)
+
+	// Nothing is sent and the connection is kept until the response arrives
+	hub.noMessage(100 * time.Millisecond)
+	if hub.conn.writeClosed() {
+		t.Fatal("[TestKeyRotationDrain] connection is closed before the response")
+	}
+	data, err := hub.parser.BuildMessage(msg.MessageID, msg.MessageTag, "receiver", []byte{}, false, false, true, true, false)
+	if err != nil {
+		t.Fatal("[TestKeyRotationDrain] build response failed")
+	}
+	hub.conn.chRead <- data
+
+	// The connector stops sending and switches to the new ticket without registering again after the Hub server closes the connection
+	waitWriteClosed(t, hub.conn)
+	hub.conn.Close()
+	activation := hub.nextMessage()
+	if activation.MessageType != cipher.TypeActivation || hub.numberConnect() != 2 {
+		t.Error("[TestKeyRotationDrain] connection does not switch to the new ticket")
+	}
+	if connector.proxy.(*fakeProxy).numberRegister() != 1 {
+		t.Error("[TestKeyRotationDrain] connection registers again")
+	}
+}
+
+func TestKeyRotationSwitch(t *testing.T) {
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	connector, hub := newTestConnector(t, "receiver", WithKeyRotation(time.Hour, 0, 0), WithResendInterval(time.Minute))
+	chHandled := make(chan string, 4)
+	go connector.Listen(func(sender string, data []byte) error {
+		chHandled <- string(data)
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	setRotatedTicket(connector, newKey)
+	waitWriteClosed(t, hub.conn)
+	if connector.IsActivated() || hub.numberConnect() != 1 {
+		t.Fatal("[TestKeyRotationSwitch] connection is not kept until the Hub server closes it")
+	}
+
+	// The Hub server delivers a message by the old key before it closes the connection
+	hub.deliver(7, 1, "sender", []byte("old key"))
+	hub.conn.Close()
+	hub.setSecretKey(newKey)
+	hub.activate()
+	select {
+	case data := <-chHandled:
+		if data != "old key" {
+			t.Error("[TestKeyRotationSwitch] invalid content")
+		}
+	case <-hub.timeout():
+		t.Fatal("[TestKeyRotationSwitch] message of the old key is lost")
+	}
+	msg := hub.nextData()
+	if msg.MessageID != 7 || msg.IsRequest {
+		t.Errorf("[TestKeyRotationSwitch] expected response of message 7 by the new key, got message %d", msg.MessageID)
+	}
+
+	// The old key is not accepted after the new one is activated
+	hub.setSecretKey(testSecretKey)
+	hub.deliver(8, 2, "sender", []byte("dropped key"))
+	select {
+	case <-chHandled:
+		t.Error("[TestKeyRotationSwitch] message of the dropped key is handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestKeyRotationCloseTimeout(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver", WithKeyRotation(time.Hour, 0, 0), WithResendInterval(50*time.Millisecond))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	// The connection is closed if the Hub server keeps it after the connector stops sending
+	setRotatedTicket(connector, testSecretKey)
+	waitWriteClosed(t, hub.conn)
+	activation := hub.nextMessage()
+	if activation.MessageType != cipher.TypeActivation || hub.numberConnect() != 2 {
+		t.Error("[TestKeyRotationCloseTimeout] connection does not switch to the new ticket")
+	}
+}
@@ -0,0 +1,55 @@
+package csoconnector
+
+import (
+	"errors"
+
+	"github.com/gecosys/cso-client-golang/csosignature"
+)
+
+// ErrSignatureRejected is returned when a received message is not accepted by the signature policy
+// Rejected messages are acknowledged, so their senders do not resend them
+var ErrSignatureRejected = errors.New("Signature is rejected")
+
+// signContent signs content for the receiver if a signer is set
+func (connector *connectorImpl) signContent(name string, isGroup bool, content []byte) ([]byte, error) {
+	if connector.signer == nil {
+		return content, nil
+	}
+	return connector.signer.Sign(name, isGroup, content)
+}
+
+// verifyContent removes the signature from content and records the result in info
+// The signer of a single message must be its sender, a group message must be signed for a group of the connection
+func (connector *connectorImpl) verifyContent(info *MessageInfo, content []byte) ([]byte, error) {
+	content, sig, status := connector.verifier.Verify(content, connector.GetConnectionName(), info.IsGroup)
+	if status == csosignature.StatusValid {
+		if info.IsGroup {
+			isMember, isLoaded := connector.groups.contains(sig.Recipient)
+			if isLoaded && !isMember {
+				status = csosignature.StatusInvalid
+			}
+		} else if sig.Signer != info.Sender {
+			status = csosignature.StatusInvalid
+		}
+	}
+	if sig != nil {
+		info.Signer = sig.Signer
+	}
+	info.SignatureStatus = status
+	if status == csosignature.StatusValid {
+		info.signature = sig
+	}
+
+	if !connector.signaturePolicy.IsAccepted(status) {
+		connector.logger.Printf("Rejected %s message from %s", status.String(), info.Sender)
+		return nil, ErrSignatureRejected
+	}
+	return content, nil
+}
+
+// markSignatureUsed remembers the nonce of a handled message, so its replays are detected
+func (connector *connectorImpl) markSignatureUsed(info *MessageInfo) {
+	if info.signature != nil {
+		connector.verifier.MarkUsed(info.signature)
+	}
+}
@@ -0,0 +1,493 @@
+package csoconnector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+	"github.com/gecosys/cso-client-golang/csoconnection"
+	"github.com/gecosys/cso-client-golang/csolimiter"
+	"github.com/gecosys/cso-client-golang/csoparser"
+	"github.com/gecosys/cso-client-golang/csoproxy"
+	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/csosignature"
+	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/utils"
+)
+
+const testTimeout = 2 * time.Second
+
+var testSecretKey = []byte("0123456789abcdef0123456789abcdef")
+
+// fakeConn is a Connection whose messages are written and read by tests
+type fakeConn struct {
+	mutex         sync.Mutex
+	status        csoconnection.Status
+	done          chan struct{}
+	chRead        chan []byte
+	chSent        chan []byte
+	connect       int
+	isWriteClosed bool
+	readErr       error // returned by GetReadChannel
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		status: csoconnection.StatusPrepare,
+		chRead: make(chan []byte, 64),
+		chSent: make(chan []byte, 64),
+	}
+}
+
+func (conn *fakeConn) Connect(address string) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.status = csoconnection.StatusConnected
+	conn.done = make(chan struct{})
+	conn.connect++
+	conn.isWriteClosed = false
+	return nil
+}
+
+func (conn *fakeConn) numberConnect() int {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.connect
+}
+
+func (conn *fakeConn) LoopListen() error {
+	conn.mutex.Lock()
+	done := conn.done
+	conn.mutex.Unlock()
+	<-done
+	return nil
+}
+
+func (conn *fakeConn) SendMessage(data []byte) error {
+	conn.mutex.Lock()
+	isWriteClosed := conn.isWriteClosed
+	conn.mutex.Unlock()
+	if isWriteClosed {
+		return errors.New("connection is closed for sending")
+	}
+	conn.chSent <- data
+	return nil
+}
+
+// CloseWrite keeps the connection until the test closes it as the Hub server
+func (conn *fakeConn) CloseWrite() error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.isWriteClosed = true
+	return nil
+}
+
+func (conn *fakeConn) writeClosed() bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.isWriteClosed
+}
+
+func (conn *fakeConn) GetReadChannel() (<-chan []byte, error) {
+	if conn.readErr != nil {
+		return nil, conn.readErr
+	}
+	return conn.chRead, nil
+}
+
+func (conn *fakeConn) GetStatus() csoconnection.Status {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.status
+}
+
+func (conn *fakeConn) Close() error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	if conn.status == csoconnection.StatusConnected {
+		conn.status = csoconnection.StatusDisconnected
+		close(conn.done)
+	}
+	return nil
+}
+
+// fakeProxy registers every connection with testSecretKey
+type fakeProxy struct {
+	mutex     sync.Mutex
+	register  int
+	groups    []string
+	groupErrs map[string]error // returned by group APIs for a group name
+}
+
+func (proxy *fakeProxy) ExchangeKey() (*csoproxy.ServerKey, error) {
+	return proxy.ExchangeKeyContext(context.Background())
+}
+
+func (proxy *fakeProxy) RegisterConnection(serverKey *csoproxy.ServerKey) (*csoproxy.ServerTicket, error) {
+	return proxy.RegisterConnectionContext(context.Background(), serverKey)
+}
+
+func (proxy *fakeProxy) ExchangeKeyContext(ctx context.Context) (*csoproxy.ServerKey, error) {
+	return &csoproxy.ServerKey{}, nil
+}
+
+func (proxy *fakeProxy) RegisterConnectionContext(ctx context.Context, serverKey *csoproxy.ServerKey) (*csoproxy.ServerTicket, error) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	proxy.register++
+	return &csoproxy.ServerTicket{
+		HubAddress:      "hub",
+		TicketID:        uint32(proxy.register),
+		TicketBytes:     make([]byte, 34),
+		ServerSecretKey: testSecretKey,
+		IssuedAt:        time.Now(),
+	}, nil
+}
+
+func (proxy *fakeProxy) numberRegister() int {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	return proxy.register
+}
+
+func (proxy *fakeProxy) SetConfig(conf config.Config) {}
+
+func (proxy *fakeProxy) JoinGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	if err := proxy.groupErrs[groupName]; err != nil {
+		return nil, err
+	}
+	proxy.groups = append(proxy.groups, groupName)
+	return append([]string{}, proxy.groups...), nil
+}
+
+func (proxy *fakeProxy) LeaveGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	groups := proxy.groups[:0]
+	for _, group := range proxy.groups {
+		if group != groupName {
+			groups = append(groups, group)
+		}
+	}
+	proxy.groups = groups
+	return append([]string{}, proxy.groups...), nil
+}
+
+func (proxy *fakeProxy) GetGroupsContext(ctx context.Context) ([]string, error) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	return append([]string{}, proxy.groups...), nil
+}
+
+// testHub plays the Hub server for a connector on a fakeConn
+type testHub struct {
+	t         *testing.T
+	conn      *fakeConn
+	parser    csoparser.Parser
+	secretKey []byte
+}
+
+func newTestConnector(t *testing.T, name string, opts ...Option) (*connectorImpl, *testHub) {
+	conf := config.NewConfig("project", "dG9rZW4=", name, "key", "http://proxy")
+	opts = append([]Option{
+		WithTickInterval(5 * time.Millisecond),
+		WithActivationInterval(20 * time.Millisecond),
+		WithReconnectDelay(10 * time.Millisecond),
+		WithLogger(nil),
+	}, opts...)
+	connector := NewConnector(16, csoqueue.NewQueueWithInterval(16, 50*time.Millisecond), csoparser.NewParser(), &fakeProxy{}, conf, opts...).(*connectorImpl)
+	conn := newFakeConn()
+	connector.conn = conn
+
+	parser := csoparser.NewParser()
+	parser.SetSecretKey(testSecretKey)
+	return connector, &testHub{t: t, conn: conn, parser: parser, secretKey: testSecretKey}
+}
+
+// activate waits for the activation message and accepts it
+func (hub *testHub) activate() {
+	msg := hub.nextMessage()
+	if msg.MessageType != cipher.TypeActivation {
+		hub.t.Fatalf("[activate] expected activation, got type %d", msg.MessageType)
+	}
+	hub.accept()
+}
+
+// accept accepts the activation which is read already
+func (hub *testHub) accept() {
+	hub.deliverRaw(0, 0, cipher.TypeActivation, "hub", make([]byte, 21), func(data []byte) {
+		data[0] = 1  // is ready
+		data[13] = 1 // IdxWrite, messages of the connector start at ID 1
+	})
+}
+
+// deliver sends a request from sender to the connector
+func (hub *testHub) deliver(msgID, msgTag uint64, sender string, content []byte) {
+	data, err := hub.parser.BuildMessage(msgID, msgTag, sender, content, false, false, true, true, true)
+	if err != nil {
+		hub.t.Fatal("[deliver] build message failed")
+	}
+	hub.conn.chRead <- data
+}
+
+func (hub *testHub) deliverRaw(msgID, msgTag uint64, msgType cipher.MessageType, name string, content []byte, modify func(data []byte)) {
+	if modify != nil {
+		modify(content)
+	}
+	raw, err := cipher.BuildRawBytes(msgID, msgTag, msgType, false, true, true, true, name, content)
+	if err != nil {
+		hub.t.Fatal("[deliverRaw] build raw bytes failed")
+	}
+	sign, _ := utils.CalcHMAC(hub.secretKey, raw)
+	data, err := cipher.BuildNoCipherBytes(msgID, msgTag, msgType, true, true, true, name, content, sign)
+	if err != nil {
+		hub.t.Fatal("[deliverRaw] build bytes failed")
+	}
+	hub.conn.chRead <- data
+}
+
+// nextMessage returns the next message sent by the connector, activation messages are skipped unless none was accepted
+func (hub *testHub) nextMessage() *cipher.Cipher {
+	select {
+	case data := <-hub.conn.chSent:
+		msg, err := hub.parser.ParseReceivedMessage(data)
+		if err != nil {
+			hub.t.Fatal("[nextMessage] parse message failed")
+		}
+		return msg
+	case <-time.After(testTimeout):
+		hub.t.Fatal("[nextMessage] timeout")
+	}
+	return nil
+}
+
+// nextData returns the next message which is not an activation
+func (hub *testHub) nextData() *cipher.Cipher {
+	for {
+		msg := hub.nextMessage()
+		if msg.MessageType != cipher.TypeActivation {
+			return msg
+		}
+	}
+}
+
+// noMessage checks that the connector sends nothing but activations for duration
+func (hub *testHub) noMessage(duration time.Duration) {
+	timer := time.After(duration)
+	for {
+		select {
+		case data := <-hub.conn.chSent:
+			msg, _ := hub.parser.ParseReceivedMessage(data)
+			if msg == nil || msg.MessageType != cipher.TypeActivation {
+				hub.t.Fatal("[noMessage] unexpected message")
+			}
+		case <-timer:
+			return
+		}
+	}
+}
+
+// setSecretKey switches the session key of the Hub server
+func (hub *testHub) setSecretKey(secretKey []byte) {
+	hub.secretKey = secretKey
+	hub.parser.SetSecretKey(secretKey)
+}
+
+func (hub *testHub) numberConnect() int {
+	return hub.conn.numberConnect()
+}
+
+func (hub *testHub) timeout() <-chan time.Time {
+	return time.After(testTimeout)
+}
+
+func waitActivated(t *testing.T, connector Connector) {
+	deadline := time.Now().Add(testTimeout)
+	for !connector.IsActivated() {
+		if time.Now().After(deadline) {
+			t.Fatal("[waitActivated] timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var errTestHandler = errors.New("handler failed")
+
+func TestRejectedMessageIsAcknowledged(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver", WithTrustStore(csosignature.NewTrustStore(), csosignature.PolicyRejectUnverified))
+	chHandled := make(chan []byte, 4)
+	go connector.Listen(func(sender string, data []byte) error {
+		chHandled <- data
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	for idx := 0; idx < 2; idx++ {
+		// The resent message is acknowledged again without handling
+		hub.deliver(7, 1, "sender", []byte("unsigned"))
+		msg := hub.nextData()
+		if msg.MessageID != 7 || msg.IsRequest {
+			t.Fatalf("[TestRejectedMessageIsAcknowledged] expected response of message 7, got message %d", msg.MessageID)
+		}
+	}
+	select {
+	case <-chHandled:
+		t.Fatal("[TestRejectedMessageIsAcknowledged] rejected message was handled")
+	default:
+	}
+
+	// A message which fails in the handler stays unacknowledged
+	connector2, hub2 := newTestConnector(t, "receiver")
+	go connector2.Listen(func(sender string, data []byte) error {
+		return errTestHandler
+	})
+	hub2.activate()
+	waitActivated(t, connector2)
+	hub2.deliver(8, 1, "sender", []byte("content"))
+	hub2.noMessage(50 * time.Millisecond)
+}
+
+// plainParser implements only csoparser.Parser
+type plainParser struct {
+	csoparser.Parser
+}
+
+func TestCompressionOptionalParser(t *testing.T) {
+	conf := config.NewConfig("project", "dG9rZW4=", "receiver", "key", "http://proxy")
+	cases := []struct {
+		name   string
+		parser csoparser.Parser
+		isErr  bool
+	}{
+		{"compression parser", csoparser.NewParser(), false},
+		{"plain parser", &plainParser{Parser: csoparser.NewParser()}, true},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		logger := log.New(&buf, "", 0)
+		NewConnector(16, csoqueue.NewQueue(16), c.parser, &fakeProxy{}, conf, WithLogger(logger), WithCompression(utils.CompressionGzip, 0))
+		if strings.Contains(buf.String(), "Error compression") != c.isErr {
+			t.Errorf("[TestCompressionOptionalParser] invalid log of %s: %q", c.name, buf.String())
+		}
+	}
+}
+
+func TestCanResume(t *testing.T) {
+	cases := []struct {
+		name     string
+		lifetime time.Duration
+		ticket   *csoproxy.ServerTicket
+		isResume bool
+	}{
+		{"disabled", 0, &csoproxy.ServerTicket{IssuedAt: time.Now()}, false},
+		{"no ticket", time.Minute, nil, false},
+		{"valid ticket", time.Minute, &csoproxy.ServerTicket{IssuedAt: time.Now()}, true},
+		{"expired ticket", time.Minute, &csoproxy.ServerTicket{IssuedAt: time.Now().Add(-time.Minute)}, false},
+	}
+	for _, c := range cases {
+		connector, _ := newTestConnector(t, "connection", WithSessionResumption(c.lifetime))
+		connector.serverTicket = c.ticket
+		if connector.canResume() != c.isResume {
+			t.Errorf("[TestCanResume] invalid result of %s", c.name)
+		}
+	}
+}
+
+// reconnect closes the activated connection after stale activations are read
+func (hub *testHub) reconnect() {
+	hub.noMessage(50 * time.Millisecond)
+	hub.conn.Close()
+}
+
+func TestResumeSession(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver", WithSessionResumption(time.Minute))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	// The connection is activated again by the cached ticket
+	hub.reconnect()
+	activation := hub.nextMessage()
+	if activation.MessageType != cipher.TypeActivation || activation.Name != "1" {
+		t.Fatal("[TestResumeSession] cached ticket is not used")
+	}
+	hub.accept()
+	waitActivated(t, connector)
+	if connector.proxy.(*fakeProxy).numberRegister() != 1 || hub.numberConnect() != 2 {
+		t.Error("[TestResumeSession] connection registers again")
+	}
+}
+
+func TestResumeRejected(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver", WithSessionResumption(time.Minute))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	// The Hub server rejects the cached ticket
+	hub.reconnect()
+	activation := hub.nextMessage()
+	if activation.MessageType != cipher.TypeActivation || activation.Name != "1" {
+		t.Fatal("[TestResumeRejected] cached ticket is not used")
+	}
+	hub.deliverRaw(0, 0, cipher.TypeActivation, "hub", make([]byte, 21), nil)
+
+	// The connector falls back to a full registration immediately
+	for activation.Name == "1" {
+		activation = hub.nextMessage()
+	}
+	if activation.MessageType != cipher.TypeActivation || activation.Name != "2" {
+		t.Fatal("[TestResumeRejected] connection does not register again")
+	}
+	hub.accept()
+	waitActivated(t, connector)
+	if connector.proxy.(*fakeProxy).numberRegister() != 2 || hub.numberConnect() != 3 {
+		t.Error("[TestResumeRejected] invalid number of registrations or connections")
+	}
+}
+
+func TestRateLimitDropped(t *testing.T) {
+	limiter := csolimiter.NewLimiter(csolimiter.ModeDrop, csolimiter.Limit{Rate: 0.001, Burst: 1}, csolimiter.Limit{}, csolimiter.Limit{})
+	connector, hub := newTestConnector(t, "sender", WithRateLimiter(limiter))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	if connector.SendMessage("receiver", []byte("content"), false, false) != nil {
+		t.Fatal("[TestRateLimitDropped] message below the limit is not sent")
+	}
+	hub.nextData()
+
+	ctx := context.Background()
+	sends := map[string]func() error{
+		"SendMessage":                 func() error { return connector.SendMessage("receiver", []byte("content"), false, false) },
+		"SendGroupMessage":            func() error { return connector.SendGroupMessage("group", []byte("content"), false, false) },
+		"SendMessageAndRetry":         func() error { return connector.SendMessageAndRetry("receiver", []byte("content"), false, 3) },
+		"SendGroupMessageAndRetryCtx": func() error { return connector.SendGroupMessageAndRetryCtx(ctx, "group", []byte("content"), false, 3) },
+	}
+	for name, send := range sends {
+		if send() != csolimiter.ErrDropped {
+			t.Errorf("[TestRateLimitDropped] %s does not report the dropped message", name)
+		}
+	}
+	msgID, err := connector.SendMessageAndRetryWithTTL(ctx, "receiver", []byte("content"), false, 3, time.Minute)
+	if msgID != 0 || err != csolimiter.ErrDropped {
+		t.Error("[TestRateLimitDropped] SendMessageAndRetryWithTTL does not report the dropped message")
+	}
+	hub.noMessage(50 * time.Millisecond)
+}
@@ -0,0 +1,168 @@
+package csoconnector
+
+import (
+	"context"
+
+	"github.com/gecosys/cso-client-golang/csoqueue"
+	"github.com/gecosys/cso-client-golang/csotracing"
+	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+// AllPeers is a name for WithTracePeers which matches all connections and groups
+const AllPeers = "*"
+
+// wrapContent encrypts content end-to-end if ctx requires it, signs it and injects trace context of ctx into content
+// Trace context is only injected for peers set by WithTracePeers
+// Content is unchanged when the tracer does not propagate anything
+// Sealed content is not compressed by the parser afterwards because ciphertext does not compress
+func (connector *connectorImpl) wrapContent(ctx context.Context, name string, isGroup bool, content []byte) ([]byte, error) {
+	content, err := connector.sealContent(ctx, name, isGroup, content)
+	if err != nil {
+		return nil, err
+	}
+	content, err = connector.signContent(name, isGroup, content)
+	if err != nil {
+		return nil, err
+	}
+	if !connector.isTracePeer(name) {
+		return content, nil
+	}
+
+	env := parseEnvelope(content)
+	carrier := make(map[string]string)
+	connector.tracer.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		if env == nil {
+			// Escape raw content which looks like an envelope, so the peer does not misparse it
+			return (&envelope.Envelope{Data: content}).IntoBytes()
+		}
+		return content, nil
+	}
+	if env == nil {
+		env = &envelope.Envelope{Data: content}
+	}
+	env.TraceParent = carrier[csotracing.KeyTraceParent]
+	env.TraceState = carrier[csotracing.KeyTraceState]
+	return env.Wrap()
+}
+
+// unwrapContent strips trace context from content sent by peer and extracts it into ctx
+// Other fields of the envelope are kept for upper layers
+// Content of peers which are not set by WithTracePeers, or which is not a valid envelope, is returned as is
+func (connector *connectorImpl) unwrapContent(ctx context.Context, peer string, content []byte) (context.Context, []byte) {
+	if !connector.isTracePeer(peer) || !envelope.IsEnvelope(content) {
+		return ctx, content
+	}
+	env, err := envelope.ParseBytes(content)
+	if err != nil {
+		return ctx, content
+	}
+	if env.TraceParent != "" {
+		carrier := map[string]string{
+			csotracing.KeyTraceParent: env.TraceParent,
+		}
+		if env.TraceState != "" {
+			carrier[csotracing.KeyTraceState] = env.TraceState
+		}
+		ctx = connector.tracer.Extract(ctx, carrier)
+	}
+	env.TraceParent = ""
+	env.TraceState = ""
+	// An envelope without other fields is escaped raw content
+	data, err := env.Wrap()
+	if err != nil {
+		return ctx, content
+	}
+	return ctx, data
+}
+
+// isTracePeer checks if trace context is propagated to/from the connection or group name
+func (connector *connectorImpl) isTracePeer(name string) bool {
+	return connector.tracePeers[name] || connector.tracePeers[AllPeers]
+}
+
+// parseEnvelope returns the envelope of content, raw content is the data of an envelope without fields
+// It returns nil for raw content which starts with magic of an envelope
+// An envelope built by this library always has fields
+func parseEnvelope(content []byte) *envelope.Envelope {
+	if !envelope.IsEnvelope(content) {
+		return &envelope.Envelope{Data: content}
+	}
+	env, err := envelope.ParseBytes(content)
+	if err != nil || !env.HasFields() {
+		return nil
+	}
+	return env
+}
+
+func (connector *connectorImpl) handleMessage(cb func(ctx context.Context, sender string, data []byte) ([]byte, error), msg *cipher.Cipher) (response []byte, err error) {
+	info := newMessageInfo(msg)
+	ctx := context.WithValue(context.Background(), messageInfoKey{}, info)
+	ctx, data := connector.unwrapContent(ctx, msg.Name, msg.Data)
+	ctx, span := connector.startSpan(ctx, "cso.handle", msg.Name, info.IsGroup)
+	span.SetAttribute("cso.message_id", msg.MessageID)
+	defer endSpan(span, &err)
+
+	data, err = connector.verifyContent(info, data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = connector.openContent(ctx, info, data)
+	if err != nil {
+		connector.logger.Printf("Error decryption: %s", err.Error())
+		return nil, err
+	}
+	response, err = cb(ctx, msg.Name, data)
+	if err == nil {
+		connector.markSignatureUsed(info)
+	}
+	return response, err
+}
+
+func (connector *connectorImpl) startRetrySpan(item *csoqueue.ItemQueue) csotracing.Span {
+	ctx, _ := connector.unwrapContent(context.Background(), item.RecvName, item.Content)
+	_, span := connector.startSpan(ctx, "cso.retry", item.RecvName, item.IsGroup)
+	span.SetAttribute("cso.message_id", item.MsgID)
+	span.SetAttribute("cso.number_sent", item.NumberSent)
+	return span
+}
+
+func (connector *connectorImpl) startSpan(ctx context.Context, spanName, name string, isGroup bool) (context.Context, csotracing.Span) {
+	ctx, span := connector.tracer.Start(ctx, spanName)
+	if isGroup {
+		span.SetAttribute("cso.group", name)
+	} else {
+		span.SetAttribute("cso.connection", name)
+	}
+	return ctx, span
+}
+
+func (connector *connectorImpl) startActivationSpan(hubAddress string) {
+	_, span := connector.tracer.Start(context.Background(), "cso.activate")
+	span.SetAttribute("cso.hub_address", hubAddress)
+
+	connector.mutexSpan.Lock()
+	if connector.activationSpan != nil {
+		connector.activationSpan.End()
+	}
+	connector.activationSpan = span
+	connector.mutexSpan.Unlock()
+}
+
+func (connector *connectorImpl) endActivationSpan(err error) {
+	connector.mutexSpan.Lock()
+	span := connector.activationSpan
+	connector.activationSpan = nil
+	connector.mutexSpan.Unlock()
+	if span != nil {
+		endSpan(span, &err)
+	}
+}
+
+func endSpan(span csotracing.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+	}
+	span.End()
+}
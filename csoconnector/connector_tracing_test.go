@@ -0,0 +1,150 @@
+package csoconnector
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/csotracing"
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+const testTraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+type traceKey struct{}
+
+// fakeTracer propagates a trace parent kept in context
+type fakeTracer struct{}
+
+type fakeSpan struct{}
+
+func (fakeTracer) Start(ctx context.Context, spanName string) (context.Context, csotracing.Span) {
+	return ctx, fakeSpan{}
+}
+
+func (fakeTracer) Inject(ctx context.Context, carrier map[string]string) {
+	if traceParent, isOk := ctx.Value(traceKey{}).(string); isOk {
+		carrier[csotracing.KeyTraceParent] = traceParent
+	}
+}
+
+func (fakeTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return context.WithValue(ctx, traceKey{}, carrier[csotracing.KeyTraceParent])
+}
+
+func (fakeSpan) SetAttribute(key string, value interface{}) {}
+func (fakeSpan) RecordError(err error)                      {}
+func (fakeSpan) End()                                       {}
+
+func TestTraceToPlainPeer(t *testing.T) {
+	connector, hub := newTestConnector(t, "sender", WithTracer(fakeTracer{}), WithTracePeers("traced"))
+	go connector.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	ctx := context.WithValue(context.Background(), traceKey{}, testTraceParent)
+	contents := [][]byte{
+		[]byte("plain"),
+		{0x00, 'C', 'S', 'E', 0x01, 0x00, 'r', 'a', 'w'},
+	}
+	for _, content := range contents {
+		err := connector.SendMessageCtx(ctx, "plain", content, false, false)
+		if err != nil {
+			t.Fatal("[TestTraceToPlainPeer] send failed")
+		}
+		msg := hub.nextData()
+		if !bytes.Equal(msg.Data, content) {
+			t.Error("[TestTraceToPlainPeer] content of a plain peer is changed")
+		}
+	}
+
+	err := connector.SendMessageCtx(ctx, "traced", []byte("traced"), false, false)
+	if err != nil {
+		t.Fatal("[TestTraceToPlainPeer] send failed")
+	}
+	env, err := envelope.Unwrap(hub.nextData().Data)
+	if err != nil || env.TraceParent != testTraceParent || string(env.Data) != "traced" {
+		t.Error("[TestTraceToPlainPeer] trace context is not propagated to a traced peer")
+	}
+}
+
+func TestTraceFromPlainPeer(t *testing.T) {
+	connector, hub := newTestConnector(t, "receiver", WithTracer(fakeTracer{}), WithTracePeers("traced"))
+	type received struct {
+		data        []byte
+		traceParent interface{}
+	}
+	chReceived := make(chan received, 4)
+	go connector.ListenWithContext(func(ctx context.Context, sender string, data []byte) error {
+		chReceived <- received{data: data, traceParent: ctx.Value(traceKey{})}
+		return nil
+	})
+	hub.activate()
+	waitActivated(t, connector)
+
+	traced, _ := (&envelope.Envelope{TraceParent: testTraceParent, Data: []byte("traced")}).IntoBytes()
+	cases := []struct {
+		sender      string
+		content     []byte
+		data        []byte
+		traceParent interface{}
+	}{
+		{"plain", []byte("plain"), []byte("plain"), nil},
+		// Raw content of a plain peer is never parsed as an envelope
+		{"plain", traced, traced, nil},
+		{"traced", traced, []byte("traced"), testTraceParent},
+	}
+	for idx, c := range cases {
+		hub.deliver(uint64(idx+1), uint64(idx+1), c.sender, c.content)
+		select {
+		case recv := <-chReceived:
+			if !bytes.Equal(recv.data, c.data) || recv.traceParent != c.traceParent {
+				t.Errorf("[TestTraceFromPlainPeer] invalid content of case %d", idx)
+			}
+		case <-hub.timeout():
+			t.Fatal("[TestTraceFromPlainPeer] timeout")
+		}
+		hub.nextData()
+	}
+}
+
+func TestTraceEscape(t *testing.T) {
+	sender, hubSender := newTestConnector(t, "sender", WithTracer(fakeTracer{}), WithTracePeers(AllPeers))
+	receiver, hubReceiver := newTestConnector(t, "receiver", WithTracer(fakeTracer{}), WithTracePeers(AllPeers))
+	chReceived := make(chan []byte, 4)
+	go sender.Listen(func(sender string, data []byte) error {
+		return nil
+	})
+	go receiver.Listen(func(sender string, data []byte) error {
+		chReceived <- data
+		return nil
+	})
+	hubSender.activate()
+	hubReceiver.activate()
+	waitActivated(t, sender)
+	waitActivated(t, receiver)
+
+	// Raw content which looks like an envelope is escaped when no trace context is propagated
+	contents := [][]byte{
+		{0x00, 'C', 'S', 'E', 0x01, 0x00, 'r', 'a', 'w'},
+		{0x00, 'C', 'S', 'E', 0x01, 0x05},
+	}
+	for idx, content := range contents {
+		err := sender.SendMessageCtx(context.Background(), "receiver", content, false, false)
+		if err != nil {
+			t.Fatal("[TestTraceEscape] send failed")
+		}
+		hubReceiver.deliver(uint64(idx+1), uint64(idx+1), "sender", hubSender.nextData().Data)
+		select {
+		case data := <-chReceived:
+			if !bytes.Equal(data, content) {
+				t.Errorf("[TestTraceEscape] invalid content %d", idx)
+			}
+		case <-hubReceiver.timeout():
+			t.Fatal("[TestTraceEscape] timeout")
+		}
+		hubReceiver.nextData()
+	}
+}
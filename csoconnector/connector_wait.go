@@ -0,0 +1,115 @@
+package csoconnector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gecosys/cso-client-golang/csoqueue"
+)
+
+// signal wakes up all goroutines waiting for a state change
+type signal struct {
+	mutex sync.Mutex
+	ch    chan struct{}
+}
+
+func newSignal() *signal {
+	return &signal{ch: make(chan struct{})}
+}
+
+// wait returns a channel which is closed at the next broadcast
+// The channel must be taken before checking the state to not miss a broadcast
+func (s *signal) wait() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ch
+}
+
+func (s *signal) broadcast() {
+	s.mutex.Lock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+	s.mutex.Unlock()
+}
+
+func (connector *connectorImpl) setActivated(isActivated bool) {
+	if isActivated {
+		atomic.StoreInt32(&connector.isActivated, 1)
+		connector.activation.broadcast()
+		return
+	}
+	atomic.StoreInt32(&connector.isActivated, 0)
+}
+
+// waitActivated waits until the connector is activated or ctx is done
+// A ctx which is never done (e.g. context.Background) does not wait
+func (connector *connectorImpl) waitActivated(ctx context.Context) error {
+	for {
+		ch := connector.activation.wait()
+		if connector.IsActivated() {
+			return nil
+		}
+		if ctx.Done() == nil {
+			return errors.New("Connection is not ready")
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// takeIndex waits until the retry queue has capacity for priority or ctx is done
+// A ctx which is never done (e.g. context.Background) does not wait
+func (connector *connectorImpl) takeIndex(ctx context.Context, priority csoqueue.Priority) error {
+	for {
+		ch := connector.queueSpace.wait()
+		if connector.takeQueueIndex(priority) {
+			return nil
+		}
+		if ctx.Done() == nil {
+			return errors.New("Queue is full")
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// takeQueueIndex takes an index of the retry queue for priority
+// Queues which do not implement csoqueue.PriorityQueue ignore the priority
+func (connector *connectorImpl) takeQueueIndex(priority csoqueue.Priority) bool {
+	if queue, isOk := connector.queueMessages.(csoqueue.PriorityQueue); isOk {
+		return queue.TakeIndexWithPriority(priority)
+	}
+	return connector.queueMessages.TakeIndex()
+}
+
+// releaseQueueIndex releases an index of the retry queue which is not used
+// Queues which do not implement csoqueue.PriorityQueue keep the index, so their capacity shrinks by one
+func (connector *connectorImpl) releaseQueueIndex(priority csoqueue.Priority) {
+	queue, isOk := connector.queueMessages.(csoqueue.PriorityQueue)
+	if !isOk {
+		connector.logger.Printf("Error queue: an index of the retry queue cannot be released")
+		return
+	}
+	queue.ReleaseIndex(priority)
+	connector.queueSpace.broadcast()
+}
+
+// pushItem hands item to the listening goroutine
+// The index taken for item is released if ctx is done first, so a stopped listening loop never blocks forever
+func (connector *connectorImpl) pushItem(ctx context.Context, item *csoqueue.ItemQueue) error {
+	select {
+	case connector.chWriteMessage <- item:
+		return nil
+	case <-ctx.Done():
+		connector.releaseQueueIndex(item.Priority)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package csoconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/csoqueue"
+)
+
+// waitResult runs wait on a new goroutine and returns a channel of its result
+func waitResult(wait func() error) <-chan error {
+	chResult := make(chan error, 1)
+	go func() {
+		chResult <- wait()
+	}()
+	return chResult
+}
+
+func TestWaitActivated(t *testing.T) {
+	connector, _ := newTestConnector(t, "sender")
+	if connector.waitActivated(context.Background()) == nil {
+		t.Error("[TestWaitActivated] a context without deadline waits")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if connector.waitActivated(ctx) != context.DeadlineExceeded {
+		t.Error("[TestWaitActivated] waiting does not time out")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	chResult := waitResult(func() error { return connector.waitActivated(ctx) })
+	select {
+	case <-chResult:
+		t.Fatal("[TestWaitActivated] returned before activation")
+	case <-time.After(20 * time.Millisecond):
+	}
+	connector.setActivated(true)
+	select {
+	case err := <-chResult:
+		if err != nil {
+			t.Error("[TestWaitActivated] activation is not noticed")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("[TestWaitActivated] timeout")
+	}
+
+	connector.setActivated(false)
+	if connector.IsActivated() {
+		t.Error("[TestWaitActivated] connector is still activated")
+	}
+}
+
+func TestTakeIndex(t *testing.T) {
+	connector, _ := newTestConnector(t, "sender")
+	connector.queueMessages = csoqueue.NewQueueWithInterval(1, time.Second)
+	if connector.takeIndex(context.Background(), csoqueue.PriorityNormal) != nil {
+		t.Fatal("[TestTakeIndex] take index failed")
+	}
+	if connector.takeIndex(context.Background(), csoqueue.PriorityNormal) == nil {
+		t.Error("[TestTakeIndex] full queue gives an index")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if connector.takeIndex(ctx, csoqueue.PriorityNormal) != context.DeadlineExceeded {
+		t.Error("[TestTakeIndex] waiting does not time out")
+	}
+
+	// A waiting sender takes the index released by the listening goroutine
+	ctx, cancel = context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	chResult := waitResult(func() error { return connector.takeIndex(ctx, csoqueue.PriorityNormal) })
+	select {
+	case <-chResult:
+		t.Fatal("[TestTakeIndex] returned while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	connector.releaseQueueIndex(csoqueue.PriorityNormal)
+	select {
+	case err := <-chResult:
+		if err != nil {
+			t.Error("[TestTakeIndex] released index is not taken")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("[TestTakeIndex] timeout")
+	}
+}
+
+func TestTakeIndexPriority(t *testing.T) {
+	connector, _ := newTestConnector(t, "sender")
+	caps := [csoqueue.NumberPriorities]int32{1, 0, 0}
+	connector.queueMessages = csoqueue.NewPriorityQueue(2, caps, time.Second, 0)
+	if connector.takeIndex(context.Background(), csoqueue.PriorityLow) != nil {
+		t.Fatal("[TestTakeIndexPriority] take index failed")
+	}
+	if connector.takeIndex(context.Background(), csoqueue.PriorityLow) == nil {
+		t.Error("[TestTakeIndexPriority] full class gives an index")
+	}
+
+	// A queue without priority classes gives indices regardless of the priority
+	connector.queueMessages = &plainQueue{Queue: csoqueue.NewPriorityQueue(2, caps, time.Second, 0)}
+	for idx := 0; idx < 2; idx++ {
+		if connector.takeIndex(context.Background(), csoqueue.PriorityLow) != nil {
+			t.Error("[TestTakeIndexPriority] index of a plain queue is not taken")
+		}
+	}
+}
+
+func TestPushItemCancel(t *testing.T) {
+	connector, _ := newTestConnector(t, "sender")
+	connector.queueMessages = csoqueue.NewQueueWithInterval(1, time.Second)
+	connector.chWriteMessage = make(chan *csoqueue.ItemQueue) // nobody listens
+	if connector.takeIndex(context.Background(), csoqueue.PriorityNormal) != nil {
+		t.Fatal("[TestPushItemCancel] take index failed")
+	}
+
+	// Another sender waits for the index
+	ctxWait, cancelWait := context.WithTimeout(context.Background(), testTimeout)
+	defer cancelWait()
+	chResult := waitResult(func() error { return connector.takeIndex(ctxWait, csoqueue.PriorityNormal) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := connector.pushItem(ctx, &csoqueue.ItemQueue{MsgID: 1, Priority: csoqueue.PriorityNormal})
+	if err != context.DeadlineExceeded {
+		t.Error("[TestPushItemCancel] push does not time out")
+	}
+	select {
+	case err = <-chResult:
+		if err != nil {
+			t.Error("[TestPushItemCancel] index is not released on cancel")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("[TestPushItemCancel] waiting sender is not woken up")
+	}
+}
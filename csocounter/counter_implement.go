@@ -1,55 +1,163 @@
 package csocounter
 
 import (
+	"sync"
 	"sync/atomic"
 )
 
+// NumberBits is number of bits of mask which is received from the Hub server
 const NumberBits = 32
 
+// DefaultWindowSize is number of indices tracked by the read window
+const DefaultWindowSize = 1024
+
+// counterImpl tracks received indices in a sliding window [minReadIdx, minReadIdx + windowSize)
+// Bits of the window are stored in a ring buffer, bit of index idx is at position idx % windowSize
 type counterImpl struct {
-	writeIndex   uint64
-	minReadIdx   uint64
-	maskReadBits uint32
+	writeIndex uint64
+	mutex      sync.Mutex
+	minReadIdx uint64
+	windowSize uint64
+	readBits   []uint64
 }
 
-// NewCounter inits a new instance of Counter interface
+// NewCounter inits a new instance of Counter interface with the default window size
 func NewCounter(writeIndex, minReadIdx uint64, maskReadBits uint32) Counter {
-	return &counterImpl{
-		writeIndex:   writeIndex - 1,
-		minReadIdx:   minReadIdx,
-		maskReadBits: maskReadBits,
+	return NewCounterWithWindow(writeIndex, minReadIdx, maskReadBits, DefaultWindowSize)
+}
+
+// NewCounterWithWindow inits a new instance of Counter interface which tracks windowSize indices
+// windowSize is rounded up to a multiple of 64 and is at least NumberBits
+func NewCounterWithWindow(writeIndex, minReadIdx uint64, maskReadBits uint32, windowSize uint32) Counter {
+	size := uint64(windowSize)
+	if size < NumberBits {
+		size = NumberBits
+	}
+	size = (size + 63) &^ 63
+
+	c := &counterImpl{
+		writeIndex: writeIndex - 1,
+		minReadIdx: minReadIdx,
+		windowSize: size,
+		readBits:   make([]uint64, size/64),
 	}
+	for bit := uint64(0); bit < NumberBits; bit++ {
+		if maskReadBits&(uint32(1)<<bit) != 0 {
+			c.setBit(minReadIdx + bit)
+		}
+	}
+	return c
 }
 
 func (c *counterImpl) NextWriteIndex() uint64 {
 	return atomic.AddUint64(&c.writeIndex, 1)
 }
 
+// MarkReadUnused marks idx as not received, so it is accepted again
 func (c *counterImpl) MarkReadUnused(idx uint64) {
-	if idx < c.minReadIdx {
-		return
-	}
-	if idx >= (c.minReadIdx + NumberBits) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if idx < c.minReadIdx || idx-c.minReadIdx >= c.windowSize {
 		return
 	}
-	mask := uint32(1) << (idx - c.minReadIdx)
-	c.maskReadBits &= ^mask
+	c.clearBit(idx)
 }
 
+// MarkReadDone marks idx as received, it returns false if idx was received or is older than the window
+// The window slides forward when idx is beyond it, indices which leave the window are considered as received
 func (c *counterImpl) MarkReadDone(idx uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.markReadDone(idx)
+}
+
+// slide moves the window forward by shift indices and clears bits of indices leaving it
+func (c *counterImpl) slide(shift uint64) {
+	if shift >= c.windowSize {
+		for pos := range c.readBits {
+			c.readBits[pos] = 0
+		}
+	} else {
+		for idx := c.minReadIdx; idx < c.minReadIdx+shift; idx++ {
+			c.clearBit(idx)
+		}
+	}
+	c.minReadIdx += shift
+}
+
+func (c *counterImpl) isSet(idx uint64) bool {
+	pos := idx % c.windowSize
+	return c.readBits[pos/64]&(uint64(1)<<(pos%64)) != 0
+}
+
+func (c *counterImpl) setBit(idx uint64) {
+	pos := idx % c.windowSize
+	c.readBits[pos/64] |= uint64(1) << (pos % 64)
+}
+
+func (c *counterImpl) clearBit(idx uint64) {
+	pos := idx % c.windowSize
+	c.readBits[pos/64] &^= uint64(1) << (pos % 64)
+}
+
+// markReadDone is MarkReadDone without locking
+func (c *counterImpl) markReadDone(idx uint64) bool {
 	if idx < c.minReadIdx {
 		return false
 	}
-
-	if idx >= (c.minReadIdx + NumberBits) {
-		c.minReadIdx += NumberBits
-		c.maskReadBits = 0
+	if offset := idx - c.minReadIdx; offset >= c.windowSize {
+		c.slide(offset - c.windowSize + 1)
 	}
-
-	mask := uint32(1) << (idx - c.minReadIdx)
-	if (c.maskReadBits & mask) != 0 {
+	if c.isSet(idx) {
 		return false
 	}
-	c.maskReadBits |= mask
+	c.setBit(idx)
 	return true
 }
+
+// reconcile merges the state of the Hub server, all indices below idxRead are considered as received
+func (c *counterImpl) reconcile(idxWrite, idxRead uint64, maskRead uint32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for {
+		current := atomic.LoadUint64(&c.writeIndex)
+		if idxWrite <= current+1 || atomic.CompareAndSwapUint64(&c.writeIndex, current, idxWrite-1) {
+			break
+		}
+	}
+	if idxRead > c.minReadIdx {
+		c.slide(idxRead - c.minReadIdx)
+	}
+	for bit := uint64(0); bit < NumberBits; bit++ {
+		if maskRead&(uint32(1)<<bit) != 0 {
+			c.markReadDone(idxRead + bit)
+		}
+	}
+}
+
+// state returns the read window, bit k of readBits is index minReadIdx + k
+func (c *counterImpl) state() (minReadIdx uint64, readBits []uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	readBits = make([]uint64, len(c.readBits))
+	for offset := uint64(0); offset < c.windowSize; offset++ {
+		if c.isSet(c.minReadIdx + offset) {
+			readBits[offset/64] |= uint64(1) << (offset % 64)
+		}
+	}
+	return c.minReadIdx, readBits
+}
+
+// newCounterFromState restores a counter from its state, the window size may differ from the saved one
+func newCounterFromState(state *State, windowSize uint32) *counterImpl {
+	c := NewCounterWithWindow(state.WriteIndex, state.MinReadIdx, 0, windowSize).(*counterImpl)
+	for offset := uint64(0); offset < uint64(len(state.ReadBits))*64; offset++ {
+		if state.ReadBits[offset/64]&(uint64(1)<<(offset%64)) != 0 {
+			c.markReadDone(state.MinReadIdx + offset)
+		}
+	}
+	return c
+}
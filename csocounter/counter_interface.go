@@ -1,8 +1,42 @@
 package csocounter
 
+import "github.com/gecosys/cso-client-golang/message/readyticket"
+
 // Counter counts the number of messages (read/write)
 type Counter interface {
 	NextWriteIndex() uint64
 	MarkReadUnused(idx uint64)
 	MarkReadDone(idx uint64) bool
 }
+
+// PersistentCounter is Counter whose state survives restarts of the process
+// MarkReadDone only reserves an index in memory, the index is saved to the Store by Commit
+type PersistentCounter interface {
+	Counter
+
+	// Commit saves idx as processed, it is called after the message of idx is handled successfully
+	Commit(idx uint64) error
+
+	// IsCommitted returns true if idx was saved as processed (or is older than the window)
+	IsCommitted(idx uint64) bool
+
+	// Reconcile merges the state which the Hub server sends on activation
+	Reconcile(ticket *readyticket.ReadyTicket) error
+}
+
+// State is a snapshot of Counter which is saved to a Store
+type State struct {
+	// Write indices below WriteIndex must not be reused
+	WriteIndex uint64
+	// Indices below MinReadIdx are considered as processed
+	MinReadIdx uint64
+	// Bit k is set if index MinReadIdx + k was processed
+	ReadBits []uint64
+}
+
+// Store saves State of PersistentCounter durably
+type Store interface {
+	// Load returns nil State if nothing was saved
+	Load() (*State, error)
+	Save(state *State) error
+}
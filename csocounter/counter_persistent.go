@@ -0,0 +1,128 @@
+package csocounter
+
+import (
+	"sync"
+
+	"github.com/gecosys/cso-client-golang/message/readyticket"
+)
+
+// WriteIndexReserve is number of write indices which are reserved by one save
+// Reserved indices which are not used before a restart are skipped
+const WriteIndexReserve = 64
+
+type persistentCounter struct {
+	mutex      sync.Mutex
+	store      Store
+	reserved   *counterImpl // indices being handled or processed
+	committed  *counterImpl // indices saved to the store
+	writeLimit uint64       // write indices below writeLimit are saved as used
+}
+
+// NewPersistentCounter inits a new instance of PersistentCounter interface
+// The saved state is loaded from store and merged with ticket which is received on activation
+func NewPersistentCounter(store Store, ticket *readyticket.ReadyTicket, windowSize uint32) (PersistentCounter, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var counter *persistentCounter
+	if state == nil {
+		counter = &persistentCounter{
+			store:      store,
+			reserved:   NewCounterWithWindow(ticket.IdxWrite, ticket.IdxRead, ticket.MaskRead, windowSize).(*counterImpl),
+			committed:  NewCounterWithWindow(ticket.IdxWrite, ticket.IdxRead, ticket.MaskRead, windowSize).(*counterImpl),
+			writeLimit: ticket.IdxWrite,
+		}
+	} else {
+		counter = &persistentCounter{
+			store:      store,
+			reserved:   newCounterFromState(state, windowSize),
+			committed:  newCounterFromState(state, windowSize),
+			writeLimit: state.WriteIndex,
+		}
+	}
+	err = counter.Reconcile(ticket)
+	if err != nil {
+		return nil, err
+	}
+	return counter, nil
+}
+
+func (counter *persistentCounter) NextWriteIndex() uint64 {
+	idx := counter.reserved.NextWriteIndex()
+
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if idx >= counter.writeLimit {
+		// On failure, the limit is kept, so the next call tries again
+		counter.saveWithLimit(idx + WriteIndexReserve)
+	}
+	return idx
+}
+
+func (counter *persistentCounter) MarkReadUnused(idx uint64) {
+	counter.reserved.MarkReadUnused(idx)
+}
+
+func (counter *persistentCounter) MarkReadDone(idx uint64) bool {
+	return counter.reserved.MarkReadDone(idx)
+}
+
+func (counter *persistentCounter) Commit(idx uint64) error {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	if !counter.committed.MarkReadDone(idx) {
+		return nil
+	}
+	err := counter.saveWithLimit(counter.writeLimit)
+	if err != nil {
+		counter.committed.MarkReadUnused(idx)
+	}
+	return err
+}
+
+func (counter *persistentCounter) IsCommitted(idx uint64) bool {
+	counter.committed.mutex.Lock()
+	defer counter.committed.mutex.Unlock()
+
+	if idx < counter.committed.minReadIdx {
+		return true
+	}
+	if idx-counter.committed.minReadIdx >= counter.committed.windowSize {
+		return false
+	}
+	return counter.committed.isSet(idx)
+}
+
+func (counter *persistentCounter) Reconcile(ticket *readyticket.ReadyTicket) error {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.reserved.reconcile(ticket.IdxWrite, ticket.IdxRead, ticket.MaskRead)
+	counter.committed.reconcile(ticket.IdxWrite, ticket.IdxRead, ticket.MaskRead)
+
+	// Continue after the write indices which were reserved before the restart
+	counter.reserved.reconcile(counter.writeLimit, 0, 0)
+	limit := counter.writeLimit
+	if ticket.IdxWrite > limit {
+		limit = ticket.IdxWrite
+	}
+	return counter.saveWithLimit(limit)
+}
+
+// saveWithLimit saves the committed state, writeLimit is updated only if saving succeeds
+func (counter *persistentCounter) saveWithLimit(writeLimit uint64) error {
+	minReadIdx, readBits := counter.committed.state()
+	err := counter.store.Save(&State{
+		WriteIndex: writeLimit,
+		MinReadIdx: minReadIdx,
+		ReadBits:   readBits,
+	})
+	if err != nil {
+		return err
+	}
+	counter.writeLimit = writeLimit
+	return nil
+}
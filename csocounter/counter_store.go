@@ -0,0 +1,127 @@
+package csocounter
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var storeMagic = [4]byte{'C', 'S', 'O', 'C'}
+
+const storeVersion = 1
+
+// ErrCorruptedState is returned when the saved state is damaged
+var ErrCorruptedState = errors.New("Corrupted counter state")
+
+type fileStore struct {
+	mutex    sync.Mutex
+	filePath string
+}
+
+// NewFileStore inits a new instance of Store interface which saves State to filePath
+// A State is written to a temporary file and renamed, so a crash never leaves a partial file
+func NewFileStore(filePath string) Store {
+	return &fileStore{filePath: filePath}
+}
+
+func (store *fileStore) Load() (*State, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	buffer, err := ioutil.ReadFile(store.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseState(buffer)
+}
+
+func (store *fileStore) Save(state *State) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	dir := filepath.Dir(store.filePath)
+	file, err := ioutil.TempFile(dir, filepath.Base(store.filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = file.Write(buildState(state))
+	if err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, store.filePath)
+	if err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename survives a power failure
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+	return nil
+}
+
+// buildState converts State to bytes
+// Magic: 4 bytes
+// Version: 1 byte
+// Write Index: 8 bytes
+// Min Read Index: 8 bytes
+// Number of words: 4 bytes
+// Read Bits: 8 bytes per word
+// CRC32 of the above: 4 bytes
+func buildState(state *State) []byte {
+	lenBuffer := 25 + 8*len(state.ReadBits) + 4
+	buffer := make([]byte, lenBuffer)
+	copy(buffer, storeMagic[:])
+	buffer[4] = storeVersion
+	binary.LittleEndian.PutUint64(buffer[5:], state.WriteIndex)
+	binary.LittleEndian.PutUint64(buffer[13:], state.MinReadIdx)
+	binary.LittleEndian.PutUint32(buffer[21:], uint32(len(state.ReadBits)))
+	for idx, word := range state.ReadBits {
+		binary.LittleEndian.PutUint64(buffer[25+8*idx:], word)
+	}
+	binary.LittleEndian.PutUint32(buffer[lenBuffer-4:], crc32.ChecksumIEEE(buffer[:lenBuffer-4]))
+	return buffer
+}
+
+// parseState converts bytes to State
+func parseState(buffer []byte) (*State, error) {
+	lenBuffer := len(buffer)
+	if lenBuffer < 29 || string(buffer[:4]) != string(storeMagic[:]) || buffer[4] != storeVersion {
+		return nil, ErrCorruptedState
+	}
+	if binary.LittleEndian.Uint32(buffer[lenBuffer-4:]) != crc32.ChecksumIEEE(buffer[:lenBuffer-4]) {
+		return nil, ErrCorruptedState
+	}
+
+	numberWords := int(binary.LittleEndian.Uint32(buffer[21:]))
+	if lenBuffer != 29+8*numberWords {
+		return nil, ErrCorruptedState
+	}
+	state := &State{
+		WriteIndex: binary.LittleEndian.Uint64(buffer[5:]),
+		MinReadIdx: binary.LittleEndian.Uint64(buffer[13:]),
+		ReadBits:   make([]uint64, numberWords),
+	}
+	for idx := range state.ReadBits {
+		state.ReadBits[idx] = binary.LittleEndian.Uint64(buffer[25+8*idx:])
+	}
+	return state, nil
+}
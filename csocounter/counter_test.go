@@ -0,0 +1,282 @@
+package csocounter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/message/readyticket"
+)
+
+func TestNextWriteIndex(t *testing.T) {
+	counter := NewCounter(5, 0, 0)
+	for idx := uint64(5); idx < 10; idx++ {
+		if counter.NextWriteIndex() != idx {
+			t.Error("[TestNextWriteIndex] invalid write index")
+		}
+	}
+}
+
+func TestInitMask(t *testing.T) {
+	counter := NewCounter(0, 100, 0x5)
+	if counter.MarkReadDone(100) {
+		t.Error("[TestInitMask] index 100 is marked by mask")
+	}
+	if counter.MarkReadDone(101) == false {
+		t.Error("[TestInitMask] index 101 is not marked by mask")
+	}
+	if counter.MarkReadDone(102) {
+		t.Error("[TestInitMask] index 102 is marked by mask")
+	}
+	if counter.MarkReadDone(99) {
+		t.Error("[TestInitMask] index 99 is older than the window")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	counter := NewCounter(0, 0, 0)
+	for idx := uint64(0); idx < 2000; idx++ {
+		if counter.MarkReadDone(idx) == false {
+			t.Errorf("[TestDuplicate] index %d is rejected", idx)
+		}
+		if counter.MarkReadDone(idx) {
+			t.Errorf("[TestDuplicate] index %d is accepted twice", idx)
+		}
+	}
+}
+
+func TestOutOfOrder(t *testing.T) {
+	counter := NewCounterWithWindow(0, 0, 0, 1024)
+
+	// Receive odd indices first, then even indices in reverse order
+	for idx := uint64(1); idx < 1024; idx += 2 {
+		if counter.MarkReadDone(idx) == false {
+			t.Errorf("[TestOutOfOrder] index %d is rejected", idx)
+		}
+	}
+	for idx := int64(1022); idx >= 0; idx -= 2 {
+		if counter.MarkReadDone(uint64(idx)) == false {
+			t.Errorf("[TestOutOfOrder] index %d is rejected", idx)
+		}
+	}
+	for idx := uint64(0); idx < 1024; idx++ {
+		if counter.MarkReadDone(idx) {
+			t.Errorf("[TestOutOfOrder] index %d is accepted twice", idx)
+		}
+	}
+}
+
+func TestSlide(t *testing.T) {
+	counter := NewCounterWithWindow(0, 0, 0, 64)
+
+	// Index 0 is lost, index 1 is received
+	counter.MarkReadDone(1)
+	// Index 64 slides the window by 1, so index 0 leaves the window
+	if counter.MarkReadDone(64) == false {
+		t.Error("[TestSlide] index 64 is rejected")
+	}
+	if counter.MarkReadDone(0) {
+		t.Error("[TestSlide] index 0 is older than the window")
+	}
+	// Unreceived indices which are still in the window keep their state
+	for idx := uint64(2); idx < 64; idx++ {
+		if counter.MarkReadDone(idx) == false {
+			t.Errorf("[TestSlide] index %d is rejected after sliding", idx)
+		}
+	}
+	if counter.MarkReadDone(1) {
+		t.Error("[TestSlide] index 1 is accepted twice after sliding")
+	}
+}
+
+func TestSlideFarAway(t *testing.T) {
+	counter := NewCounterWithWindow(0, 0, 0, 128)
+	for idx := uint64(0); idx < 128; idx++ {
+		counter.MarkReadDone(idx)
+	}
+
+	// Jump beyond the whole window, all old bits must be cleared
+	if counter.MarkReadDone(1000) == false {
+		t.Error("[TestSlideFarAway] index 1000 is rejected")
+	}
+	if counter.MarkReadDone(872) {
+		t.Error("[TestSlideFarAway] index 872 is older than the window")
+	}
+	for idx := uint64(873); idx < 1000; idx++ {
+		if counter.MarkReadDone(idx) == false {
+			t.Errorf("[TestSlideFarAway] index %d is rejected", idx)
+		}
+	}
+}
+
+func TestWrapAround(t *testing.T) {
+	counter := NewCounterWithWindow(0, 0, 0, 64)
+
+	// Positions of the ring buffer are reused many times
+	for round := uint64(0); round < 10; round++ {
+		base := round * 64
+		for offset := int64(63); offset >= 0; offset-- {
+			if counter.MarkReadDone(base+uint64(offset)) == false {
+				t.Errorf("[TestWrapAround] index %d is rejected", base+uint64(offset))
+			}
+		}
+		if counter.MarkReadDone(base + 10) {
+			t.Errorf("[TestWrapAround] index %d is accepted twice", base+10)
+		}
+	}
+
+	// Indices near the maximum value of uint64
+	max := ^uint64(0)
+	counter = NewCounterWithWindow(0, max-100, 0, 64)
+	if counter.MarkReadDone(max) == false {
+		t.Error("[TestWrapAround] max index is rejected")
+	}
+	if counter.MarkReadDone(max) {
+		t.Error("[TestWrapAround] max index is accepted twice")
+	}
+	if counter.MarkReadDone(max-63) == false {
+		t.Error("[TestWrapAround] index max-63 is rejected")
+	}
+	if counter.MarkReadDone(max - 64) {
+		t.Error("[TestWrapAround] index max-64 is older than the window")
+	}
+}
+
+func TestMarkReadUnused(t *testing.T) {
+	counter := NewCounter(0, 0, 0)
+	counter.MarkReadDone(10)
+	counter.MarkReadUnused(10)
+	if counter.MarkReadDone(10) == false {
+		t.Error("[TestMarkReadUnused] index 10 is rejected after unused")
+	}
+
+	// Out of the window, nothing changes
+	counter.MarkReadUnused(5000)
+	if counter.MarkReadDone(10) {
+		t.Error("[TestMarkReadUnused] index 10 is accepted twice")
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	// Size is rounded up to a multiple of 64
+	counter := NewCounterWithWindow(0, 0, 0, 100)
+	counter.MarkReadDone(0)
+	counter.MarkReadDone(127)
+	if counter.MarkReadDone(0) {
+		t.Error("[TestWindowSize] index 0 must stay in the window of 128")
+	}
+	counter.MarkReadDone(128)
+	if counter.MarkReadDone(1) == false {
+		t.Error("[TestWindowSize] index 1 must stay in the window of 128")
+	}
+
+	// Size is at least NumberBits, so the initial mask is kept
+	counter = NewCounterWithWindow(0, 0, 0xFFFFFFFF, 1)
+	for idx := uint64(0); idx < NumberBits; idx++ {
+		if counter.MarkReadDone(idx) {
+			t.Errorf("[TestWindowSize] index %d is marked by mask", idx)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	counter := NewCounterWithWindow(0, 0, 0, 4096)
+	var accepted int32
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := uint64(0); idx < 4096; idx++ {
+				if counter.MarkReadDone(idx) {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 4096 {
+		t.Errorf("[TestConcurrency] %d indices are accepted, expected 4096", accepted)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "counter")
+	store := NewFileStore(filePath)
+
+	state, err := store.Load()
+	if err != nil || state != nil {
+		t.Error("[TestFileStore] empty store must return nil state")
+	}
+
+	expected := &State{WriteIndex: 100, MinReadIdx: 50, ReadBits: []uint64{0x5, 0, 1 << 63}}
+	err = store.Save(expected)
+	if err != nil {
+		t.Error("[TestFileStore] save failed")
+	}
+	state, err = store.Load()
+	if err != nil || reflect.DeepEqual(state, expected) == false {
+		t.Error("[TestFileStore] invalid loaded state")
+	}
+
+	buffer, _ := ioutil.ReadFile(filePath)
+	buffer[10] ^= 0xFF
+	ioutil.WriteFile(filePath, buffer, 0600)
+	_, err = store.Load()
+	if err != ErrCorruptedState {
+		t.Error("[TestFileStore] corrupted state is not detected")
+	}
+}
+
+func TestPersistentCounter(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "counter"))
+	ticket := &readyticket.ReadyTicket{IsReady: true, IdxRead: 10, MaskRead: 0, IdxWrite: 20}
+
+	counter, err := NewPersistentCounter(store, ticket, 1024)
+	if err != nil {
+		t.Fatal("[TestPersistentCounter] init failed")
+	}
+	if counter.NextWriteIndex() != 20 || counter.NextWriteIndex() != 21 {
+		t.Error("[TestPersistentCounter] invalid write index")
+	}
+	counter.MarkReadDone(12)
+	counter.Commit(12)
+	// Index 13 is handled but not committed before the crash
+	counter.MarkReadDone(13)
+	if counter.IsCommitted(13) {
+		t.Error("[TestPersistentCounter] index 13 is not committed")
+	}
+
+	// Restart with an outdated ticket
+	counter, err = NewPersistentCounter(store, ticket, 1024)
+	if err != nil {
+		t.Fatal("[TestPersistentCounter] restart failed")
+	}
+	if counter.MarkReadDone(12) || counter.IsCommitted(12) == false {
+		t.Error("[TestPersistentCounter] index 12 is handled again after restart")
+	}
+	if counter.MarkReadDone(13) == false {
+		t.Error("[TestPersistentCounter] index 13 must be handled again after restart")
+	}
+	if counter.NextWriteIndex() < 22 {
+		t.Error("[TestPersistentCounter] write index is reused after restart")
+	}
+
+	// The Hub server confirms all indices below 100
+	err = counter.Reconcile(&readyticket.ReadyTicket{IsReady: true, IdxRead: 100, MaskRead: 0x1, IdxWrite: 500})
+	if err != nil {
+		t.Error("[TestPersistentCounter] reconcile failed")
+	}
+	if counter.MarkReadDone(99) || counter.MarkReadDone(100) {
+		t.Error("[TestPersistentCounter] indices confirmed by the Hub server are accepted")
+	}
+	if counter.MarkReadDone(101) == false {
+		t.Error("[TestPersistentCounter] index 101 is rejected")
+	}
+	if counter.NextWriteIndex() != 500 {
+		t.Error("[TestPersistentCounter] write index of the Hub server is ignored")
+	}
+}
@@ -0,0 +1,204 @@
+package csoe2e
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const headerVersion = 1
+
+const (
+	modePeer  = 1
+	modeGroup = 2
+)
+
+const saltSize = 16
+
+// hkdfInfo is prefix of HKDF info, it separates keys of this layer from other uses of the same secrets
+var hkdfInfo = []byte("cso-e2e-v1")
+
+type encryptorImpl struct {
+	privateKey []byte
+	publicKey  []byte
+	registry   Registry
+}
+
+// GenerateKey returns a new X25519 private key
+func GenerateKey() ([]byte, error) {
+	privateKey := make([]byte, KeySize)
+	_, err := io.ReadFull(rand.Reader, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// NewEncryptor inits a new instance of Encryptor interface with an X25519 private key
+// Public keys of peers (see PublicKey) must be shared out of band or discovered by the resolver of registry
+func NewEncryptor(privateKey []byte, registry Registry) (Encryptor, error) {
+	if len(privateKey) != KeySize {
+		return nil, errors.New("Invalid key size")
+	}
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		registry = NewRegistry(nil)
+	}
+	key := make([]byte, KeySize)
+	copy(key, privateKey)
+	return &encryptorImpl{
+		privateKey: key,
+		publicKey:  publicKey,
+		registry:   registry,
+	}, nil
+}
+
+func (e *encryptorImpl) PublicKey() []byte {
+	return e.publicKey
+}
+
+func (e *encryptorImpl) GetRegistry() Registry {
+	return e.registry
+}
+
+// Seal builds header of the envelope
+// Version: 1 byte
+// Mode: 1 byte (1: peer, 2: group)
+// Peer mode: public key of sender: 32 bytes
+// Group mode: length of group name (nName): 1 byte, group name: nName bytes
+// Salt of HKDF: 16 bytes
+// Nonce of ChaCha20-Poly1305: 12 bytes
+// The header is authenticated as additional data
+func (e *encryptorImpl) Seal(ctx context.Context, recvName string, isGroup bool, content []byte) ([]byte, error) {
+	var (
+		header []byte
+		secret []byte
+		info   []byte
+	)
+	if isGroup {
+		if len(recvName) > 0xFF {
+			return nil, errors.New("Invalid length of group name")
+		}
+		key, err := e.registry.GetGroupKey(ctx, recvName)
+		if err != nil {
+			return nil, err
+		}
+		header = append([]byte{headerVersion, modeGroup, byte(len(recvName))}, recvName...)
+		secret = key
+		info = append(append([]byte{}, hkdfInfo...), recvName...)
+	} else {
+		peerKey, err := e.registry.GetPeerKey(ctx, recvName)
+		if err != nil {
+			return nil, err
+		}
+		secret, err = curve25519.X25519(e.privateKey, peerKey)
+		if err != nil {
+			return nil, err
+		}
+		header = append([]byte{headerVersion, modePeer}, e.publicKey...)
+		info = append(append(append([]byte{}, hkdfInfo...), e.publicKey...), peerKey...)
+	}
+
+	random := make([]byte, saltSize+chacha20poly1305.NonceSize)
+	_, err := io.ReadFull(rand.Reader, random)
+	if err != nil {
+		return nil, err
+	}
+	header = append(header, random...)
+	salt := random[:saltSize]
+	nonce := random[saltSize:]
+
+	aead, err := newAEAD(secret, salt, info)
+	if err != nil {
+		return nil, err
+	}
+	env := &envelope.Envelope{
+		Encryption: header,
+		Data:       aead.Seal(nil, nonce, content, header),
+	}
+	return env.IntoBytes()
+}
+
+func (e *encryptorImpl) Open(ctx context.Context, sender string, header, ciphertext []byte) ([]byte, error) {
+	if len(header) < 2 || header[0] != headerVersion {
+		return nil, errors.New("Unsupported encryption header")
+	}
+
+	var (
+		secret []byte
+		info   []byte
+		pos    int
+		err    error
+	)
+	switch header[1] {
+	case modePeer:
+		pos = 2 + KeySize
+		if len(header) != pos+saltSize+chacha20poly1305.NonceSize {
+			return nil, errors.New("Invalid encryption header")
+		}
+		senderKey := header[2:pos]
+		trustedKey, err := e.registry.GetPeerKey(ctx, sender)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(senderKey, trustedKey) != 1 {
+			return nil, ErrUntrustedKey
+		}
+		secret, err = curve25519.X25519(e.privateKey, senderKey)
+		if err != nil {
+			return nil, err
+		}
+		info = append(append(append([]byte{}, hkdfInfo...), senderKey...), e.publicKey...)
+	case modeGroup:
+		if len(header) < 3 {
+			return nil, errors.New("Invalid encryption header")
+		}
+		lenName := int(header[2])
+		pos = 3 + lenName
+		if len(header) != pos+saltSize+chacha20poly1305.NonceSize {
+			return nil, errors.New("Invalid encryption header")
+		}
+		groupName := string(header[3:pos])
+		secret, err = e.registry.GetGroupKey(ctx, groupName)
+		if err != nil {
+			return nil, err
+		}
+		info = append(append([]byte{}, hkdfInfo...), groupName...)
+	default:
+		return nil, errors.New("Unsupported encryption mode")
+	}
+
+	salt := header[pos : pos+saltSize]
+	nonce := header[pos+saltSize:]
+	aead, err := newAEAD(secret, salt, info)
+	if err != nil {
+		return nil, err
+	}
+	content, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return content, nil
+}
+
+// newAEAD derives a ChaCha20-Poly1305 key from secret by HKDF-SHA256
+func newAEAD(secret, salt, info []byte) (cipher.AEAD, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
@@ -0,0 +1,46 @@
+package csoe2e
+
+import (
+	"context"
+	"errors"
+)
+
+// KeySize is size of X25519 keys and pre-shared group keys
+const KeySize = 32
+
+var (
+	// ErrUnknownPeer is returned when the public key of a peer is not known
+	ErrUnknownPeer = errors.New("Unknown peer key")
+	// ErrUntrustedKey is returned when a message is encrypted by a key which does not belong to its sender
+	ErrUntrustedKey = errors.New("Untrusted peer key")
+	// ErrDecryption is returned when a message can not be decrypted
+	ErrDecryption = errors.New("Decryption failed")
+)
+
+// Registry keeps public keys of peers and pre-shared keys of groups
+type Registry interface {
+	SetPeerKey(name string, publicKey []byte) error
+	RemovePeerKey(name string)
+	// GetPeerKey returns the public key of a peer, it asks the resolver if the key is not registered
+	GetPeerKey(ctx context.Context, name string) ([]byte, error)
+
+	SetGroupKey(name string, key []byte) error
+	RemoveGroupKey(name string)
+	GetGroupKey(ctx context.Context, name string) ([]byte, error)
+}
+
+// Resolver discovers keys which are not registered (e.g. from a directory service)
+// The returned key is registered for later messages
+type Resolver func(ctx context.Context, name string, isGroup bool) ([]byte, error)
+
+// Encryptor encrypts contents between peers, the Hub server can not read them
+// Messages to a connection use X25519 between static keys of both peers, messages to a group use its pre-shared key
+type Encryptor interface {
+	PublicKey() []byte
+	GetRegistry() Registry
+
+	// Seal encrypts content for recvName and returns an envelope
+	Seal(ctx context.Context, recvName string, isGroup bool, content []byte) ([]byte, error)
+	// Open decrypts an envelope which is sent by sender
+	Open(ctx context.Context, sender string, header, ciphertext []byte) ([]byte, error)
+}
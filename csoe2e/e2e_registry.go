@@ -0,0 +1,86 @@
+package csoe2e
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type registryImpl struct {
+	mutex     sync.RWMutex
+	peerKeys  map[string][]byte
+	groupKeys map[string][]byte
+	resolver  Resolver
+}
+
+// NewRegistry inits a new instance of Registry interface, resolver can be nil
+func NewRegistry(resolver Resolver) Registry {
+	return &registryImpl{
+		peerKeys:  make(map[string][]byte),
+		groupKeys: make(map[string][]byte),
+		resolver:  resolver,
+	}
+}
+
+func (registry *registryImpl) SetPeerKey(name string, publicKey []byte) error {
+	return registry.set(registry.peerKeys, name, publicKey)
+}
+
+func (registry *registryImpl) RemovePeerKey(name string) {
+	registry.mutex.Lock()
+	delete(registry.peerKeys, name)
+	registry.mutex.Unlock()
+}
+
+func (registry *registryImpl) GetPeerKey(ctx context.Context, name string) ([]byte, error) {
+	return registry.get(ctx, registry.peerKeys, name, false)
+}
+
+func (registry *registryImpl) SetGroupKey(name string, key []byte) error {
+	return registry.set(registry.groupKeys, name, key)
+}
+
+func (registry *registryImpl) RemoveGroupKey(name string) {
+	registry.mutex.Lock()
+	delete(registry.groupKeys, name)
+	registry.mutex.Unlock()
+}
+
+func (registry *registryImpl) GetGroupKey(ctx context.Context, name string) ([]byte, error) {
+	return registry.get(ctx, registry.groupKeys, name, true)
+}
+
+func (registry *registryImpl) set(keys map[string][]byte, name string, key []byte) error {
+	if len(key) != KeySize {
+		return errors.New("Invalid key size")
+	}
+	value := make([]byte, KeySize)
+	copy(value, key)
+
+	registry.mutex.Lock()
+	keys[name] = value
+	registry.mutex.Unlock()
+	return nil
+}
+
+func (registry *registryImpl) get(ctx context.Context, keys map[string][]byte, name string, isGroup bool) ([]byte, error) {
+	registry.mutex.RLock()
+	key, isExisted := keys[name]
+	registry.mutex.RUnlock()
+	if isExisted {
+		return key, nil
+	}
+	if registry.resolver == nil {
+		return nil, ErrUnknownPeer
+	}
+
+	key, err := registry.resolver(ctx, name, isGroup)
+	if err != nil {
+		return nil, err
+	}
+	err = registry.set(keys, name, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,111 @@
+package csoe2e
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+func newPeer(t *testing.T) Encryptor {
+	privateKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal("[newPeer] generate key failed")
+	}
+	encryptor, err := NewEncryptor(privateKey, nil)
+	if err != nil {
+		t.Fatal("[newPeer] init encryptor failed")
+	}
+	return encryptor
+}
+
+func open(encryptor Encryptor, sender string, buffer []byte) ([]byte, error) {
+	env, err := envelope.ParseBytes(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return encryptor.Open(context.Background(), sender, env.Encryption, env.Data)
+}
+
+func TestPeer(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := newPeer(t), newPeer(t)
+	alice.GetRegistry().SetPeerKey("bob", bob.PublicKey())
+	bob.GetRegistry().SetPeerKey("alice", alice.PublicKey())
+
+	buffer, err := alice.Seal(ctx, "bob", false, []byte("open the valve"))
+	if err != nil {
+		t.Fatal("[TestPeer] seal failed")
+	}
+	content, err := open(bob, "alice", buffer)
+	if err != nil || reflect.DeepEqual(content, []byte("open the valve")) == false {
+		t.Error("[TestPeer] invalid content")
+	}
+
+	// The key of the sender does not belong to the claimed name
+	mallory := newPeer(t)
+	bob.GetRegistry().SetPeerKey("mallory", mallory.PublicKey())
+	_, err = open(bob, "mallory", buffer)
+	if err != ErrUntrustedKey {
+		t.Error("[TestPeer] message from untrusted key is accepted")
+	}
+
+	// Tampered ciphertext
+	buffer[len(buffer)-1] ^= 0x01
+	_, err = open(bob, "alice", buffer)
+	if err != ErrDecryption {
+		t.Error("[TestPeer] tampered message is accepted")
+	}
+
+	_, err = alice.Seal(ctx, "carol", false, []byte("data"))
+	if err != ErrUnknownPeer {
+		t.Error("[TestPeer] message to unknown peer is sealed")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	ctx := context.Background()
+	key := make([]byte, KeySize)
+	for idx := range key {
+		key[idx] = byte(idx)
+	}
+	alice, bob := newPeer(t), newPeer(t)
+	alice.GetRegistry().SetGroupKey("pumps", key)
+	bob.GetRegistry().SetGroupKey("pumps", key)
+
+	buffer, err := alice.Seal(ctx, "pumps", true, []byte("stop"))
+	if err != nil {
+		t.Fatal("[TestGroup] seal failed")
+	}
+	content, err := open(bob, "alice", buffer)
+	if err != nil || string(content) != "stop" {
+		t.Error("[TestGroup] invalid content")
+	}
+
+	key[0] = 0xFF
+	bob.GetRegistry().SetGroupKey("pumps", key)
+	_, err = open(bob, "alice", buffer)
+	if err != ErrDecryption {
+		t.Error("[TestGroup] message is opened by a wrong key")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	bob := newPeer(t)
+	privateKey, _ := GenerateKey()
+	alice, _ := NewEncryptor(privateKey, NewRegistry(func(ctx context.Context, name string, isGroup bool) ([]byte, error) {
+		if name == "bob" && !isGroup {
+			return bob.PublicKey(), nil
+		}
+		return nil, ErrUnknownPeer
+	}))
+	_, err := alice.Seal(context.Background(), "bob", false, []byte("data"))
+	if err != nil {
+		t.Error("[TestResolver] key is not discovered")
+	}
+	key, err := alice.GetRegistry().GetPeerKey(context.Background(), "bob")
+	if err != nil || reflect.DeepEqual(key, bob.PublicKey()) == false {
+		t.Error("[TestResolver] discovered key is not registered")
+	}
+}
@@ -0,0 +1,92 @@
+package csoidempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is number of responses kept by the cache
+const DefaultCapacity = 4096
+
+type entry struct {
+	key       Key
+	response  []byte
+	expiredAt int64 // unix nanoseconds, 0 means never
+}
+
+type cacheImpl struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[Key]*list.Element
+	order    *list.List // front is the most recently used
+}
+
+// NewCache inits a new instance of Cache interface
+// The least recently used response is evicted when the cache is full
+// Responses older than ttl are ignored, 0 keeps them until evicted
+func NewCache(capacity int, ttl time.Duration) Cache {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &cacheImpl{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[Key]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (cache *cacheImpl) Get(key Key) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	elem, isExisted := cache.items[key]
+	if !isExisted {
+		return nil, false
+	}
+	item := elem.Value.(*entry)
+	if item.expiredAt != 0 && item.expiredAt <= time.Now().UnixNano() {
+		cache.order.Remove(elem)
+		delete(cache.items, key)
+		return nil, false
+	}
+	cache.order.MoveToFront(elem)
+	return item.response, true
+}
+
+func (cache *cacheImpl) Put(key Key, response []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	var expiredAt int64
+	if cache.ttl > 0 {
+		expiredAt = time.Now().Add(cache.ttl).UnixNano()
+	}
+
+	if elem, isExisted := cache.items[key]; isExisted {
+		item := elem.Value.(*entry)
+		item.response = response
+		item.expiredAt = expiredAt
+		cache.order.MoveToFront(elem)
+		return
+	}
+
+	cache.items[key] = cache.order.PushFront(&entry{
+		key:       key,
+		response:  response,
+		expiredAt: expiredAt,
+	})
+	for cache.order.Len() > cache.capacity {
+		elem := cache.order.Back()
+		cache.order.Remove(elem)
+		delete(cache.items, elem.Value.(*entry).key)
+	}
+}
+
+func (cache *cacheImpl) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.order.Len()
+}
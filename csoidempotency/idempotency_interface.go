@@ -0,0 +1,17 @@
+package csoidempotency
+
+// Key identifies a received message
+type Key struct {
+	Sender     string
+	MessageID  uint64
+	MessageTag uint64
+}
+
+// Cache keeps responses of handled messages, so a duplicate is answered without running the handler again
+type Cache interface {
+	// Get returns the response of a handled message
+	Get(key Key) ([]byte, bool)
+	// Put saves the response of a message which was handled successfully
+	Put(key Key, response []byte)
+	Len() int
+}
@@ -0,0 +1,54 @@
+package csoidempotency
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetPut(t *testing.T) {
+	cache := NewCache(2, 0)
+	key := Key{Sender: "sender", MessageID: 1, MessageTag: 10}
+	if _, ok := cache.Get(key); ok {
+		t.Error("[TestGetPut] empty cache returns a response")
+	}
+	cache.Put(key, []byte("response"))
+	response, ok := cache.Get(key)
+	if !ok || reflect.DeepEqual(response, []byte("response")) == false {
+		t.Error("[TestGetPut] invalid response")
+	}
+	if _, ok = cache.Get(Key{Sender: "other", MessageID: 1, MessageTag: 10}); ok {
+		t.Error("[TestGetPut] response of other sender is returned")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	cache := NewCache(2, 0)
+	cache.Put(Key{MessageID: 1}, nil)
+	cache.Put(Key{MessageID: 2}, nil)
+	// Use the first key, so the second key is the least recently used
+	cache.Get(Key{MessageID: 1})
+	cache.Put(Key{MessageID: 3}, nil)
+
+	if cache.Len() != 2 {
+		t.Error("[TestEviction] cache exceeds its capacity")
+	}
+	if _, ok := cache.Get(Key{MessageID: 2}); ok {
+		t.Error("[TestEviction] least recently used response is not evicted")
+	}
+	if _, ok := cache.Get(Key{MessageID: 1}); !ok {
+		t.Error("[TestEviction] recently used response is evicted")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	cache := NewCache(2, 10*time.Millisecond)
+	cache.Put(Key{MessageID: 1}, nil)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get(Key{MessageID: 1}); ok {
+		t.Error("[TestTTL] expired response is returned")
+	}
+	if cache.Len() != 0 {
+		t.Error("[TestTTL] expired response is not removed")
+	}
+}
@@ -0,0 +1,138 @@
+package csolimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepThreshold is number of per-name buckets which triggers removing idle buckets
+const sweepThreshold = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiterImpl struct {
+	mutex       sync.Mutex
+	mode        Mode
+	global      Limit
+	perReceiver Limit
+	perGroup    Limit
+	globalState bucket
+	receivers   map[string]*bucket
+	groups      map[string]*bucket
+}
+
+// NewLimiter inits a new instance of Limiter interface
+// global limits all messages, perReceiver limits messages to each connection and perGroup limits messages to each group
+func NewLimiter(mode Mode, global, perReceiver, perGroup Limit) Limiter {
+	now := time.Now()
+	return &limiterImpl{
+		mode:        mode,
+		global:      global,
+		perReceiver: perReceiver,
+		perGroup:    perGroup,
+		globalState: bucket{tokens: burstOf(global), last: now},
+		receivers:   make(map[string]*bucket),
+		groups:      make(map[string]*bucket),
+	}
+}
+
+func (limiter *limiterImpl) Allow(ctx context.Context, name string, isGroup bool) (bool, error) {
+	for {
+		delay := limiter.take(name, isGroup)
+		if delay == 0 {
+			return true, nil
+		}
+		switch limiter.mode {
+		case ModeDrop:
+			return false, nil
+		case ModeError:
+			return false, ErrRateLimited
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take takes a token of all related buckets, or returns the delay until all of them have a token
+func (limiter *limiterImpl) take(name string, isGroup bool) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	limit, buckets := limiter.perReceiver, limiter.receivers
+	if isGroup {
+		limit, buckets = limiter.perGroup, limiter.groups
+	}
+
+	var state *bucket
+	if limit.Rate > 0 {
+		state = buckets[name]
+		if state == nil {
+			if len(buckets) >= sweepThreshold {
+				sweep(buckets, limit, now)
+			}
+			state = &bucket{tokens: burstOf(limit), last: now}
+			buckets[name] = state
+		}
+	}
+
+	delay := refill(&limiter.globalState, limiter.global, now)
+	if state != nil {
+		if d := refill(state, limit, now); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	if limiter.global.Rate > 0 {
+		limiter.globalState.tokens--
+	}
+	if state != nil {
+		state.tokens--
+	}
+	return 0
+}
+
+// refill adds tokens since the last refill and returns the delay until a token is available
+func refill(state *bucket, limit Limit, now time.Time) time.Duration {
+	if limit.Rate <= 0 {
+		return 0
+	}
+	state.tokens = math.Min(burstOf(limit), state.tokens+now.Sub(state.last).Seconds()*limit.Rate)
+	state.last = now
+	if state.tokens >= 1 {
+		return 0
+	}
+	delay := time.Duration((1 - state.tokens) / limit.Rate * float64(time.Second))
+	if delay <= 0 {
+		delay = time.Nanosecond
+	}
+	return delay
+}
+
+// sweep removes buckets which are full again, they are the same as new buckets
+func sweep(buckets map[string]*bucket, limit Limit, now time.Time) {
+	for name, state := range buckets {
+		if state.tokens+now.Sub(state.last).Seconds()*limit.Rate >= burstOf(limit) {
+			delete(buckets, name)
+		}
+	}
+}
+
+// burstOf returns capacity of a bucket, a bucket holds at least one token
+func burstOf(limit Limit) float64 {
+	return math.Max(float64(limit.Burst), 1)
+}
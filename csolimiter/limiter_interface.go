@@ -0,0 +1,38 @@
+package csolimiter
+
+import (
+	"context"
+	"errors"
+)
+
+// Mode is behavior of Limiter when a limit is exceeded
+type Mode uint8
+
+const (
+	// ModeBlock waits until the message is allowed or ctx is done
+	ModeBlock Mode = iota
+	// ModeDrop discards the message, send methods of the connector return ErrDropped
+	ModeDrop
+	// ModeError returns ErrRateLimited
+	ModeError
+)
+
+// ErrRateLimited is returned in ModeError when a limit is exceeded
+var ErrRateLimited = errors.New("Rate limit exceeded")
+
+// ErrDropped is returned by send methods of the connector when Allow drops the message
+var ErrDropped = errors.New("Message is dropped by rate limit")
+
+// Limit is a token bucket which refills Rate tokens per second up to Burst tokens
+// A Limit with zero Rate does not limit anything
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limiter limits rate of sending messages
+type Limiter interface {
+	// Allow takes a token of the global bucket and the bucket of name
+	// It returns false without error when the message must be dropped
+	Allow(ctx context.Context, name string, isGroup bool) (bool, error)
+}
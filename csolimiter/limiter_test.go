@@ -0,0 +1,54 @@
+package csolimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestModeError(t *testing.T) {
+	limiter := NewLimiter(ModeError, Limit{}, Limit{Rate: 1, Burst: 2}, Limit{})
+	for idx := 0; idx < 2; idx++ {
+		if ok, err := limiter.Allow(context.Background(), "receiver", false); !ok || err != nil {
+			t.Error("[TestModeError] message within burst is not allowed")
+		}
+	}
+	if _, err := limiter.Allow(context.Background(), "receiver", false); err != ErrRateLimited {
+		t.Error("[TestModeError] message over burst is allowed")
+	}
+	// Other receivers and groups have their own buckets
+	if ok, _ := limiter.Allow(context.Background(), "other", false); !ok {
+		t.Error("[TestModeError] message to other receiver is not allowed")
+	}
+	if ok, _ := limiter.Allow(context.Background(), "receiver", true); !ok {
+		t.Error("[TestModeError] message to group is limited by the receiver bucket")
+	}
+}
+
+func TestModeDrop(t *testing.T) {
+	limiter := NewLimiter(ModeDrop, Limit{Rate: 1, Burst: 1}, Limit{}, Limit{})
+	limiter.Allow(context.Background(), "a", false)
+	ok, err := limiter.Allow(context.Background(), "b", true)
+	if ok || err != nil {
+		t.Error("[TestModeDrop] message over the global limit is not dropped")
+	}
+}
+
+func TestModeBlock(t *testing.T) {
+	limiter := NewLimiter(ModeBlock, Limit{Rate: 50, Burst: 1}, Limit{}, Limit{})
+	begin := time.Now()
+	for idx := 0; idx < 3; idx++ {
+		if ok, err := limiter.Allow(context.Background(), "receiver", false); !ok || err != nil {
+			t.Error("[TestModeBlock] message is not allowed")
+		}
+	}
+	if time.Since(begin) < 30*time.Millisecond {
+		t.Error("[TestModeBlock] messages are not delayed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Allow(ctx, "receiver", false); err != context.DeadlineExceeded {
+		t.Error("[TestModeBlock] waiting does not stop at the deadline")
+	}
+}
@@ -0,0 +1,25 @@
+package csometrics
+
+import "time"
+
+type noopMetrics struct{}
+
+// NewNoopMetrics inits a new instance of Metrics interface which discards all values
+func NewNoopMetrics() Metrics {
+	return noopMetrics{}
+}
+
+func (noopMetrics) MessageSent()                           {}
+func (noopMetrics) MessageRetried()                        {}
+func (noopMetrics) MessageExpired()                        {}
+func (noopMetrics) MessageReceived()                       {}
+func (noopMetrics) MessageDuplicated()                     {}
+func (noopMetrics) MessageInvalidSignature()               {}
+func (noopMetrics) MessageRateLimited()                    {}
+func (noopMetrics) Reconnect()                             {}
+func (noopMetrics) KeyRotated()                            {}
+func (noopMetrics) SetQueueDepth(depth int32)              {}
+func (noopMetrics) SetConnectionStatus(status uint8)       {}
+func (noopMetrics) ObserveActivationLatency(time.Duration) {}
+func (noopMetrics) ObserveSendLatency(time.Duration)       {}
+func (noopMetrics) ObserveProxyCall(string, time.Duration) {}
@@ -0,0 +1,37 @@
+package csometrics
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Metrics records statistics of connector, queue and connection
+type Metrics interface {
+	// Counters
+	MessageSent()
+	MessageRetried()
+	MessageExpired()
+	MessageReceived()
+	MessageDuplicated()
+	MessageInvalidSignature()
+	MessageRateLimited()
+	Reconnect()
+	KeyRotated()
+
+	// Gauges
+	SetQueueDepth(depth int32)
+	SetConnectionStatus(status uint8)
+
+	// Histograms
+	ObserveActivationLatency(duration time.Duration)
+	ObserveSendLatency(duration time.Duration)
+	ObserveProxyCall(api string, duration time.Duration)
+}
+
+// PrometheusMetrics is a Metrics which exposes values in Prometheus text format
+type PrometheusMetrics interface {
+	Metrics
+	http.Handler
+	WriteTo(w io.Writer) (int64, error)
+}
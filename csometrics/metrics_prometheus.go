@@ -0,0 +1,228 @@
+package csometrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are upper bounds (in seconds) of histogram buckets
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets), len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mutex.Lock()
+	for idx, bound := range h.buckets {
+		if value <= bound {
+			h.counts[idx]++
+		}
+	}
+	h.count++
+	h.sum += value
+	h.mutex.Unlock()
+}
+
+func (h *histogram) write(buf *bytes.Buffer, name, labels string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for idx, bound := range h.buckets {
+		fmt.Fprintf(buf, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), h.counts[idx])
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, h.count)
+}
+
+type prometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	messagesSent             atomic.Uint64
+	messagesRetried          atomic.Uint64
+	messagesExpired          atomic.Uint64
+	messagesReceived         atomic.Uint64
+	messagesDuplicated       atomic.Uint64
+	messagesInvalidSignature atomic.Uint64
+	messagesRateLimited      atomic.Uint64
+	reconnects               atomic.Uint64
+	keyRotations             atomic.Uint64
+
+	queueDepth       int32
+	connectionStatus uint32
+
+	activationLatency *histogram
+	sendLatency       *histogram
+	mutexProxyCalls   sync.Mutex
+	proxyCalls        map[string]*histogram
+}
+
+// NewPrometheusMetrics inits a new instance of PrometheusMetrics interface
+// All metric names are prefixed by namespace (default is "cso")
+func NewPrometheusMetrics(namespace string) PrometheusMetrics {
+	if namespace == "" {
+		namespace = "cso"
+	}
+	return &prometheusMetrics{
+		namespace:         namespace,
+		buckets:           DefaultBuckets,
+		activationLatency: newHistogram(DefaultBuckets),
+		sendLatency:       newHistogram(DefaultBuckets),
+		proxyCalls:        make(map[string]*histogram),
+	}
+}
+
+func (m *prometheusMetrics) MessageSent() {
+	m.messagesSent.Add(1)
+}
+
+func (m *prometheusMetrics) MessageRetried() {
+	m.messagesRetried.Add(1)
+}
+
+func (m *prometheusMetrics) MessageExpired() {
+	m.messagesExpired.Add(1)
+}
+
+func (m *prometheusMetrics) MessageReceived() {
+	m.messagesReceived.Add(1)
+}
+
+func (m *prometheusMetrics) MessageDuplicated() {
+	m.messagesDuplicated.Add(1)
+}
+
+func (m *prometheusMetrics) MessageInvalidSignature() {
+	m.messagesInvalidSignature.Add(1)
+}
+
+func (m *prometheusMetrics) MessageRateLimited() {
+	m.messagesRateLimited.Add(1)
+}
+
+func (m *prometheusMetrics) Reconnect() {
+	m.reconnects.Add(1)
+}
+
+func (m *prometheusMetrics) KeyRotated() {
+	m.keyRotations.Add(1)
+}
+
+func (m *prometheusMetrics) SetQueueDepth(depth int32) {
+	atomic.StoreInt32(&m.queueDepth, depth)
+}
+
+func (m *prometheusMetrics) SetConnectionStatus(status uint8) {
+	atomic.StoreUint32(&m.connectionStatus, uint32(status))
+}
+
+func (m *prometheusMetrics) ObserveActivationLatency(duration time.Duration) {
+	m.activationLatency.observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) ObserveSendLatency(duration time.Duration) {
+	m.sendLatency.observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) ObserveProxyCall(api string, duration time.Duration) {
+	m.mutexProxyCalls.Lock()
+	h, isExisted := m.proxyCalls[api]
+	if !isExisted {
+		h = newHistogram(m.buckets)
+		m.proxyCalls[api] = h
+	}
+	m.mutexProxyCalls.Unlock()
+	h.observe(duration.Seconds())
+}
+
+// ServeHTTP writes all metrics in Prometheus text format
+func (m *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes all metrics in Prometheus text format
+func (m *prometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	buf := new(bytes.Buffer)
+
+	m.writeCounter(buf, "messages_sent_total", "Number of messages sent.", &m.messagesSent)
+	m.writeCounter(buf, "messages_retried_total", "Number of messages resent from the retry queue.", &m.messagesRetried)
+	m.writeCounter(buf, "messages_expired_total", "Number of messages removed from the retry queue without response.", &m.messagesExpired)
+	m.writeCounter(buf, "messages_received_total", "Number of messages received.", &m.messagesReceived)
+	m.writeCounter(buf, "messages_duplicated_total", "Number of received messages dropped by the counter as duplicates.", &m.messagesDuplicated)
+	m.writeCounter(buf, "messages_invalid_signature_total", "Number of received messages rejected for invalid HMAC or AES-GCM authentication tag.", &m.messagesInvalidSignature)
+	m.writeCounter(buf, "messages_rate_limited_total", "Number of messages dropped or rejected by the rate limiter.", &m.messagesRateLimited)
+	m.writeCounter(buf, "reconnects_total", "Number of attempts to connect again after the first one.", &m.reconnects)
+	m.writeCounter(buf, "key_rotations_total", "Number of session keys rotated.", &m.keyRotations)
+
+	m.writeHeader(buf, "queue_depth", "Number of messages in the retry queue.", "gauge")
+	fmt.Fprintf(buf, "%s_queue_depth %d\n", m.namespace, atomic.LoadInt32(&m.queueDepth))
+	m.writeHeader(buf, "connection_status", "Status of connection (0: prepare, 1: connecting, 2: connected, 3: disconnected).", "gauge")
+	fmt.Fprintf(buf, "%s_connection_status %d\n", m.namespace, atomic.LoadUint32(&m.connectionStatus))
+
+	m.writeHeader(buf, "activation_latency_seconds", "Duration from connecting to the Hub server until activated.", "histogram")
+	m.activationLatency.write(buf, m.namespace+"_activation_latency_seconds", "")
+	m.writeHeader(buf, "send_latency_seconds", "Duration of writing a message to the connection.", "histogram")
+	m.sendLatency.write(buf, m.namespace+"_send_latency_seconds", "")
+
+	m.mutexProxyCalls.Lock()
+	apis := make([]string, 0, len(m.proxyCalls))
+	for api := range m.proxyCalls {
+		apis = append(apis, api)
+	}
+	m.mutexProxyCalls.Unlock()
+	sort.Strings(apis)
+	m.writeHeader(buf, "proxy_call_duration_seconds", "Duration of calls to the Proxy server.", "histogram")
+	for _, api := range apis {
+		m.mutexProxyCalls.Lock()
+		h := m.proxyCalls[api]
+		m.mutexProxyCalls.Unlock()
+		h.write(buf, m.namespace+"_proxy_call_duration_seconds", "api="+strconv.Quote(api))
+	}
+	return buf.WriteTo(w)
+}
+
+func (m *prometheusMetrics) writeHeader(buf *bytes.Buffer, name, help, metricType string) {
+	fmt.Fprintf(buf, "# HELP %s_%s %s\n", m.namespace, name, help)
+	fmt.Fprintf(buf, "# TYPE %s_%s %s\n", m.namespace, name, metricType)
+}
+
+func (m *prometheusMetrics) writeCounter(buf *bytes.Buffer, name, help string, value *atomic.Uint64) {
+	m.writeHeader(buf, name, help, "counter")
+	fmt.Fprintf(buf, "%s_%s %d\n", m.namespace, name, value.Load())
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
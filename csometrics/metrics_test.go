@@ -0,0 +1,142 @@
+package csometrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exposition(t *testing.T, metrics PrometheusMetrics) []string {
+	buf := new(bytes.Buffer)
+	n, err := metrics.WriteTo(buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatal("[exposition] write metrics failed")
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func hasLine(lines []string, line string) bool {
+	for _, val := range lines {
+		if val == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPrometheusCounters(t *testing.T) {
+	metrics := NewPrometheusMetrics("")
+	metrics.MessageSent()
+	metrics.MessageSent()
+	metrics.MessageRetried()
+	metrics.MessageExpired()
+	metrics.MessageReceived()
+	metrics.MessageDuplicated()
+	metrics.MessageInvalidSignature()
+	metrics.MessageRateLimited()
+	metrics.Reconnect()
+	metrics.KeyRotated()
+	metrics.SetQueueDepth(7)
+	metrics.SetConnectionStatus(2)
+
+	lines := exposition(t, metrics)
+	expected := []string{
+		"# HELP cso_messages_sent_total Number of messages sent.",
+		"# TYPE cso_messages_sent_total counter",
+		"cso_messages_sent_total 2",
+		"cso_messages_retried_total 1",
+		"cso_messages_expired_total 1",
+		"cso_messages_received_total 1",
+		"cso_messages_duplicated_total 1",
+		"cso_messages_invalid_signature_total 1",
+		"cso_messages_rate_limited_total 1",
+		"cso_reconnects_total 1",
+		"cso_key_rotations_total 1",
+		"# TYPE cso_queue_depth gauge",
+		"cso_queue_depth 7",
+		"# TYPE cso_connection_status gauge",
+		"cso_connection_status 2",
+	}
+	for _, line := range expected {
+		if !hasLine(lines, line) {
+			t.Errorf("[TestPrometheusCounters] missing line %q", line)
+		}
+	}
+
+	// Every sample has HELP and TYPE lines before it
+	for idx, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "cso_") || len(strings.Fields(line)) != 2 {
+			t.Errorf("[TestPrometheusCounters] invalid sample %q", line)
+		}
+		if idx < 2 {
+			t.Error("[TestPrometheusCounters] sample without header")
+		}
+	}
+}
+
+func TestPrometheusHistograms(t *testing.T) {
+	metrics := NewPrometheusMetrics("app")
+	metrics.ObserveActivationLatency(20 * time.Millisecond)
+	metrics.ObserveActivationLatency(300 * time.Millisecond)
+	metrics.ObserveActivationLatency(time.Minute)
+	metrics.ObserveProxyCall("register-connection", time.Second)
+	metrics.ObserveProxyCall("exchange-key", 5*time.Millisecond)
+
+	lines := exposition(t, metrics)
+	expected := []string{
+		"# TYPE app_activation_latency_seconds histogram",
+		`app_activation_latency_seconds_bucket{le="0.005"} 0`,
+		`app_activation_latency_seconds_bucket{le="0.025"} 1`,
+		`app_activation_latency_seconds_bucket{le="0.25"} 1`,
+		`app_activation_latency_seconds_bucket{le="0.5"} 2`,
+		`app_activation_latency_seconds_bucket{le="10"} 2`,
+		`app_activation_latency_seconds_bucket{le="+Inf"} 3`,
+		"app_activation_latency_seconds_sum 60.32",
+		"app_activation_latency_seconds_count 3",
+		`app_send_latency_seconds_bucket{le="+Inf"} 0`,
+		"app_send_latency_seconds_count 0",
+		`app_proxy_call_duration_seconds_bucket{api="exchange-key",le="0.005"} 1`,
+		`app_proxy_call_duration_seconds_bucket{api="register-connection",le="0.5"} 0`,
+		`app_proxy_call_duration_seconds_bucket{api="register-connection",le="1"} 1`,
+		`app_proxy_call_duration_seconds_sum{api="register-connection"} 1`,
+		`app_proxy_call_duration_seconds_count{api="exchange-key"} 1`,
+	}
+	for _, line := range expected {
+		if !hasLine(lines, line) {
+			t.Errorf("[TestPrometheusHistograms] missing line %q", line)
+		}
+	}
+
+	// APIs are written in order
+	exchange, register := -1, -1
+	for idx, line := range lines {
+		if strings.HasPrefix(line, `app_proxy_call_duration_seconds_count{api="exchange-key"}`) {
+			exchange = idx
+		}
+		if strings.HasPrefix(line, `app_proxy_call_duration_seconds_count{api="register-connection"}`) {
+			register = idx
+		}
+	}
+	if exchange < 0 || register < exchange {
+		t.Error("[TestPrometheusHistograms] APIs are not sorted")
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	metrics := NewPrometheusMetrics("")
+	metrics.MessageSent()
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Error("[TestPrometheusHandler] invalid content type")
+	}
+	if !strings.Contains(recorder.Body.String(), "\ncso_messages_sent_total 1\n") {
+		t.Error("[TestPrometheusHandler] invalid body")
+	}
+}
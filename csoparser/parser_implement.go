@@ -1,15 +1,25 @@
 package csoparser
 
 import (
+	"bytes"
 	"errors"
 	"strconv"
+	"sync"
 
 	"github.com/gecosys/cso-client-golang/message/cipher"
+	"github.com/gecosys/cso-client-golang/message/envelope"
 	"github.com/gecosys/cso-client-golang/utils"
 )
 
+// ErrInvalidSignature is returned when HMAC or AES-GCM authentication tag of a received message is not valid
+var ErrInvalidSignature = errors.New("Invalid signature")
+
 type parserImpl struct {
-	secretKey []byte
+	mutexKey             sync.RWMutex
+	secretKey            []byte
+	previousKey          []byte // received messages are still parsed by this key until DropPreviousKey
+	compression          string
+	compressionThreshold int
 }
 
 // NewParser inits a new instance of Parser interface
@@ -18,10 +28,60 @@ func NewParser() Parser {
 }
 
 func (p *parserImpl) SetSecretKey(secretKey []byte) {
+	p.mutexKey.Lock()
+	defer p.mutexKey.Unlock()
+	p.secretKey = secretKey
+	p.previousKey = nil
+}
+
+// RotateSecretKey replaces the secret key and keeps the previous one for received messages
+func (p *parserImpl) RotateSecretKey(secretKey []byte) {
+	p.mutexKey.Lock()
+	defer p.mutexKey.Unlock()
+	if !bytes.Equal(p.secretKey, secretKey) {
+		p.previousKey = p.secretKey
+	}
 	p.secretKey = secretKey
 }
 
+// DropPreviousKey stops parsing received messages by the previous secret key
+func (p *parserImpl) DropPreviousKey() {
+	p.mutexKey.Lock()
+	defer p.mutexKey.Unlock()
+	p.previousKey = nil
+}
+
+func (p *parserImpl) getSecretKey() []byte {
+	p.mutexKey.RLock()
+	defer p.mutexKey.RUnlock()
+	return p.secretKey
+}
+
+// SetCompression sets algorithm which compresses content before encryption
+// Content smaller than threshold (bytes) or encrypted end-to-end is not compressed
+func (p *parserImpl) SetCompression(algorithm string, threshold int) error {
+	if !utils.IsSupportedCompression(algorithm) {
+		return errors.New("Unsupported compression")
+	}
+	p.compression = algorithm
+	p.compressionThreshold = threshold
+	return nil
+}
+
 func (p *parserImpl) ParseReceivedMessage(content []byte) (*cipher.Cipher, error) {
+	p.mutexKey.RLock()
+	secretKey, previousKey := p.secretKey, p.previousKey
+	p.mutexKey.RUnlock()
+
+	msg, err := p.parse(content, secretKey)
+	if err == ErrInvalidSignature && previousKey != nil {
+		// The Hub server sent the message before it switched to the new key
+		msg, err = p.parse(content, previousKey)
+	}
+	return msg, err
+}
+
+func (p *parserImpl) parse(content []byte, secretKey []byte) (*cipher.Cipher, error) {
 	var (
 		aad []byte
 		msg *cipher.Cipher
@@ -37,8 +97,12 @@ func (p *parserImpl) ParseReceivedMessage(content []byte) (*cipher.Cipher, error
 		if err != nil {
 			return nil, err
 		}
-		if utils.ValidateHMAC(p.secretKey, rawBytes, msg.Sign) == false {
-			return nil, errors.New("Invalid signature")
+		if utils.ValidateHMAC(secretKey, rawBytes, msg.Sign) == false {
+			return nil, ErrInvalidSignature
+		}
+		msg.Data, err = p.decompress(msg.Data)
+		if err != nil {
+			return nil, err
 		}
 		return msg, nil
 	}
@@ -49,12 +113,17 @@ func (p *parserImpl) ParseReceivedMessage(content []byte) (*cipher.Cipher, error
 	}
 
 	msg.Data, err = utils.DecryptAES(
-		p.secretKey,
+		secretKey,
 		msg.IV,
 		msg.AuthenTag,
 		msg.Data,
 		aad,
 	)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	msg.Data, err = p.decompress(msg.Data)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +140,7 @@ func (p *parserImpl) BuildActivateMessage(ticketID uint32, ticketBytes []byte) (
 	if err != nil {
 		return nil, err
 	}
-	iv, authenTag, data, err := utils.EncryptAES(p.secretKey, ticketBytes, aad)
+	iv, authenTag, data, err := utils.EncryptAES(p.getSecretKey(), ticketBytes, aad)
 	if err != nil {
 		return nil, err
 	}
@@ -80,12 +149,16 @@ func (p *parserImpl) BuildActivateMessage(ticketID uint32, ticketBytes []byte) (
 
 func (p *parserImpl) BuildMessage(msgID, msgTag uint64, recvName string, content []byte, encrypted, cached, first, last, request bool) ([]byte, error) {
 	msgType := p.getMessagetype(false, cached)
+	content, err := p.compress(content)
+	if err != nil {
+		return nil, err
+	}
 	if !encrypted {
 		rawBytes, err := cipher.BuildRawBytes(msgID, msgTag, msgType, false, first, last, request, recvName, content)
 		if err != nil {
 			return nil, err
 		}
-		sign, err := utils.CalcHMAC(p.secretKey, rawBytes)
+		sign, err := utils.CalcHMAC(p.getSecretKey(), rawBytes)
 		if err != nil {
 			return nil, err
 		}
@@ -97,7 +170,7 @@ func (p *parserImpl) BuildMessage(msgID, msgTag uint64, recvName string, content
 		return nil, err
 	}
 
-	iv, authenTag, data, err := utils.EncryptAES(p.secretKey, content, aad)
+	iv, authenTag, data, err := utils.EncryptAES(p.getSecretKey(), content, aad)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +180,16 @@ func (p *parserImpl) BuildMessage(msgID, msgTag uint64, recvName string, content
 
 func (p *parserImpl) BuildGroupMessage(msgID, msgTag uint64, groupName string, content []byte, encrypted, cached, first, last, request bool) ([]byte, error) {
 	msgType := p.getMessagetype(true, cached)
+	content, err := p.compress(content)
+	if err != nil {
+		return nil, err
+	}
 	if !encrypted {
 		rawBytes, err := cipher.BuildRawBytes(msgID, msgTag, msgType, false, first, last, request, groupName, content)
 		if err != nil {
 			return nil, err
 		}
-		sign, err := utils.CalcHMAC(p.secretKey, rawBytes)
+		sign, err := utils.CalcHMAC(p.getSecretKey(), rawBytes)
 		if err != nil {
 			return nil, err
 		}
@@ -124,7 +201,7 @@ func (p *parserImpl) BuildGroupMessage(msgID, msgTag uint64, groupName string, c
 		return nil, err
 	}
 
-	iv, authenTag, data, err := utils.EncryptAES(p.secretKey, content, aad)
+	iv, authenTag, data, err := utils.EncryptAES(p.getSecretKey(), content, aad)
 	if err != nil {
 		return nil, err
 	}
@@ -144,3 +221,47 @@ func (p *parserImpl) getMessagetype(isGroup, isCached bool) cipher.MessageType {
 	}
 	return cipher.TypeSingle
 }
+
+// compress compresses data of content and marks the algorithm in its envelope
+// Content is unchanged when it is small, sealed end-to-end or compression does not reduce its size
+// Ciphertext of a sealed envelope does not compress, so it is not tried
+func (p *parserImpl) compress(content []byte) ([]byte, error) {
+	if p.compression == utils.CompressionNone {
+		return content, nil
+	}
+	env, err := envelope.Unwrap(content)
+	if err != nil {
+		return nil, err
+	}
+	if env.Compression != "" || len(env.Encryption) > 0 || len(env.Data) < p.compressionThreshold {
+		return content, nil
+	}
+	data, err := utils.Compress(p.compression, env.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= len(env.Data) {
+		return content, nil
+	}
+	env.Compression = p.compression
+	env.Data = data
+	return env.IntoBytes()
+}
+
+// decompress restores data compressed by the sender
+// Fields of envelope except compression are kept for upper layers
+func (p *parserImpl) decompress(data []byte) ([]byte, error) {
+	if !envelope.IsEnvelope(data) {
+		return data, nil
+	}
+	env, err := envelope.ParseBytes(data)
+	if err != nil || env.Compression == "" {
+		return data, nil
+	}
+	env.Data, err = utils.Decompress(env.Compression, env.Data)
+	if err != nil {
+		return nil, err
+	}
+	env.Compression = ""
+	return env.Wrap()
+}
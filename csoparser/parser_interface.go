@@ -10,3 +10,15 @@ type Parser interface {
 	BuildMessage(msgID, msgTag uint64, recvName string, content []byte, encrypted, cached, first, last, request bool) ([]byte, error)
 	BuildGroupMessage(msgID, msgTag uint64, groupName string, content []byte, encrypted, cached, first, last, request bool) ([]byte, error)
 }
+
+// CompressionParser is implemented by parsers which compress content before encryption
+type CompressionParser interface {
+	SetCompression(algorithm string, threshold int) error
+}
+
+// KeyRotationParser is implemented by parsers which keep parsing received messages by the previous secret key
+// after the key is replaced, so messages sent by the Hub server before it switched keys are not rejected
+type KeyRotationParser interface {
+	RotateSecretKey(secretKey []byte)
+	DropPreviousKey()
+}
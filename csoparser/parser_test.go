@@ -0,0 +1,166 @@
+package csoparser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+	"github.com/gecosys/cso-client-golang/utils"
+)
+
+var testSecretKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestParser(t *testing.T, algorithm string, threshold int) Parser {
+	parser := NewParser()
+	parser.SetSecretKey(testSecretKey)
+	if err := parser.(CompressionParser).SetCompression(algorithm, threshold); err != nil {
+		t.Fatalf("[newTestParser] set compression %q failed", algorithm)
+	}
+	return parser
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte("cloud socket "), 200)
+	traced, _ := (&envelope.Envelope{TraceParent: "00-trace-span-01", Data: large}).IntoBytes()
+	sealed, _ := (&envelope.Envelope{Encryption: []byte{1, 2}, Data: large}).IntoBytes()
+	cases := []struct {
+		name       string
+		algorithm  string
+		threshold  int
+		content    []byte
+		compressed bool
+	}{
+		{"gzip", utils.CompressionGzip, 64, large, true},
+		{"zstd", utils.CompressionZstd, 64, large, true},
+		{"snappy", utils.CompressionSnappy, 64, large, true},
+		{"none", utils.CompressionNone, 64, large, false},
+		{"below threshold", utils.CompressionZstd, len(large) + 1, large, false},
+		{"incompressible", utils.CompressionGzip, 0, []byte("abc"), false},
+		{"envelope", utils.CompressionSnappy, 64, traced, true},
+		{"sealed", utils.CompressionZstd, 64, sealed, false},
+	}
+
+	receiver := newTestParser(t, utils.CompressionNone, 0)
+	for _, c := range cases {
+		sender := newTestParser(t, c.algorithm, c.threshold)
+		for _, encrypted := range []bool{false, true} {
+			data, err := sender.BuildMessage(1, 2, "receiver", c.content, encrypted, false, true, true, true)
+			if err != nil {
+				t.Errorf("[TestCompressionRoundTrip] build %s message failed", c.name)
+				continue
+			}
+			if !encrypted && bytes.Contains(data, c.content) == c.compressed {
+				t.Errorf("[TestCompressionRoundTrip] invalid compression of %s message", c.name)
+			}
+
+			msg, err := receiver.ParseReceivedMessage(data)
+			if err != nil || !bytes.Equal(msg.Data, c.content) {
+				t.Errorf("[TestCompressionRoundTrip] invalid content of %s message (encrypted: %v)", c.name, encrypted)
+			}
+		}
+	}
+
+	if err := NewParser().(CompressionParser).SetCompression("lz4", 0); err == nil {
+		t.Error("[TestCompressionRoundTrip] unsupported compression is accepted")
+	}
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	cases := []struct {
+		name string
+		size int
+	}{
+		{"over max size", utils.MaxDecompressedSize + 1},
+		{"bomb", 64 << 20},
+	}
+
+	sender := newTestParser(t, utils.CompressionNone, 0)
+	receiver := newTestParser(t, utils.CompressionNone, 0)
+	for _, algorithm := range []string{utils.CompressionGzip, utils.CompressionZstd, utils.CompressionSnappy} {
+		for _, c := range cases {
+			data, err := utils.Compress(algorithm, make([]byte, c.size))
+			if err != nil {
+				t.Fatalf("[TestDecompressionBomb] compress by %q failed", algorithm)
+			}
+			content, _ := (&envelope.Envelope{Compression: algorithm, Data: data}).IntoBytes()
+			for _, encrypted := range []bool{false, true} {
+				data, err = sender.BuildMessage(1, 2, "receiver", content, encrypted, false, true, true, true)
+				if err != nil {
+					t.Fatalf("[TestDecompressionBomb] build message failed")
+				}
+				if _, err = receiver.ParseReceivedMessage(data); err == nil {
+					t.Errorf("[TestDecompressionBomb] %s message compressed by %q is accepted (encrypted: %v)", c.name, algorithm, encrypted)
+				}
+			}
+		}
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	sender := NewParser()
+	sender.SetSecretKey([]byte("fedcba9876543210fedcba9876543210"))
+	receiver := newTestParser(t, utils.CompressionNone, 0)
+	for _, encrypted := range []bool{false, true} {
+		data, err := sender.BuildMessage(1, 2, "receiver", []byte("content"), encrypted, false, true, true, true)
+		if err != nil {
+			t.Fatal("[TestInvalidSignature] build message failed")
+		}
+		if _, err = receiver.ParseReceivedMessage(data); err != ErrInvalidSignature {
+			t.Errorf("[TestInvalidSignature] invalid error of message with another key (encrypted: %v)", encrypted)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	oldSender := newTestParser(t, utils.CompressionNone, 0)
+	newSender := NewParser()
+	newSender.SetSecretKey(newKey)
+
+	receiver := newTestParser(t, utils.CompressionNone, 0)
+	rotator, isOk := receiver.(KeyRotationParser)
+	if !isOk {
+		t.Fatal("[TestKeyRotation] parser does not support key rotation")
+	}
+	rotator.RotateSecretKey(newKey)
+
+	parse := func(sender Parser, encrypted bool) error {
+		data, err := sender.BuildMessage(1, 2, "receiver", []byte("content"), encrypted, false, true, true, true)
+		if err != nil {
+			t.Fatal("[TestKeyRotation] build message failed")
+		}
+		msg, err := receiver.ParseReceivedMessage(data)
+		if err == nil && !bytes.Equal(msg.Data, []byte("content")) {
+			t.Error("[TestKeyRotation] invalid content")
+		}
+		return err
+	}
+	for _, encrypted := range []bool{false, true} {
+		if parse(oldSender, encrypted) != nil || parse(newSender, encrypted) != nil {
+			t.Errorf("[TestKeyRotation] message is rejected before the previous key is dropped (encrypted: %v)", encrypted)
+		}
+	}
+
+	// Messages are built by the new key only
+	data, err := receiver.BuildMessage(1, 2, "sender", []byte("content"), true, false, true, true, true)
+	if err != nil {
+		t.Fatal("[TestKeyRotation] build message failed")
+	}
+	if _, err = newSender.ParseReceivedMessage(data); err != nil {
+		t.Error("[TestKeyRotation] message is not built by the new key")
+	}
+
+	rotator.DropPreviousKey()
+	for _, encrypted := range []bool{false, true} {
+		if parse(oldSender, encrypted) != ErrInvalidSignature || parse(newSender, encrypted) != nil {
+			t.Errorf("[TestKeyRotation] previous key is accepted after it is dropped (encrypted: %v)", encrypted)
+		}
+	}
+
+	// SetSecretKey does not keep the previous key
+	rotator.RotateSecretKey(testSecretKey)
+	receiver.SetSecretKey(newKey)
+	if parse(oldSender, true) != ErrInvalidSignature {
+		t.Error("[TestKeyRotation] previous key is kept by SetSecretKey")
+	}
+}
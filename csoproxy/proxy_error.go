@@ -0,0 +1,60 @@
+package csoproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrInvalidResponse is returned when response of the Proxy server has unexpected format
+var ErrInvalidResponse = errors.New("Invalid response")
+
+// ErrResponseTooLarge is returned when response of the Proxy server is larger than MaxResponseSize
+var ErrResponseTooLarge = errors.New("Response is too large")
+
+// Error is returned when the Proxy server rejects a request (ReturnCode is not 1)
+type Error struct {
+	API        string
+	ReturnCode int32
+	Message    string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s failed (returncode %d): %s", err.API, err.ReturnCode, err.Message)
+}
+
+// HTTPError is returned when the Proxy server responds with a non-2xx status
+type HTTPError struct {
+	API        string
+	StatusCode int
+	Body       string
+}
+
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("%s failed (status %d): %s", err.API, err.StatusCode, err.Body)
+}
+
+// IsTransient checks if the request may succeed when it is sent again
+func (err *HTTPError) IsTransient() bool {
+	return err.StatusCode >= http.StatusInternalServerError ||
+		err.StatusCode == http.StatusTooManyRequests ||
+		err.StatusCode == http.StatusRequestTimeout
+}
+
+func newError(api string, resp *response) error {
+	message, isOk := resp.Data.(string)
+	if !isOk {
+		data, err := jsoniter.ConfigFastest.Marshal(resp.Data)
+		if err != nil {
+			data = nil
+		}
+		message = string(data)
+	}
+	return &Error{
+		API:        api,
+		ReturnCode: resp.ReturnCode,
+		Message:    message,
+	}
+}
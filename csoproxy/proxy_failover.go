@@ -0,0 +1,199 @@
+package csoproxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+// DefaultCooldown is duration which an unhealthy endpoint is skipped
+const DefaultCooldown = time.Minute
+
+// EndpointStatus is health information of a Proxy server
+type EndpointStatus struct {
+	Address     string
+	Priority    int32
+	IsHealthy   bool
+	LastError   error
+	UnhealthyAt time.Time
+}
+
+type endpoint struct {
+	status EndpointStatus
+	proxy  *proxyImpl
+}
+
+// failoverProxy is thread-safe
+type failoverProxy struct {
+	mutex     sync.Mutex
+	cooldown  time.Duration
+	opts      []Option
+	endpoints []*endpoint
+	current   *endpoint // endpoint of the last exchanged key
+}
+
+// NewFailoverProxy inits a new instance of FailoverProxy interface
+// Requests are sent to endpoints of conf by priority, an endpoint failing by network or HTTP errors
+// is skipped for cooldown unless all endpoints are unhealthy
+func NewFailoverProxy(conf config.Config, cooldown time.Duration, opts ...Option) FailoverProxy {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	proxy := &failoverProxy{
+		cooldown: cooldown,
+		opts:     opts,
+	}
+	proxy.SetConfig(conf)
+	return proxy
+}
+
+// SetConfig replaces config and endpoints, health of endpoints with unchanged addresses is kept
+func (proxy *failoverProxy) SetConfig(conf config.Config) {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	previous := make(map[string]*endpoint, len(proxy.endpoints))
+	for _, endpoint := range proxy.endpoints {
+		previous[endpoint.status.Address] = endpoint
+	}
+
+	addresses := config.GetEndpoints(conf)
+	endpoints := make([]*endpoint, len(addresses))
+	for idx, addr := range addresses {
+		impl := NewProxy(conf, proxy.opts...).(*proxyImpl)
+		impl.address = addr.Address
+		status := EndpointStatus{
+			Address:   addr.Address,
+			Priority:  addr.Priority,
+			IsHealthy: true,
+		}
+		if old, isExisted := previous[addr.Address]; isExisted {
+			status = old.status
+			status.Priority = addr.Priority
+		}
+		endpoints[idx] = &endpoint{
+			status: status,
+			proxy:  impl,
+		}
+	}
+	proxy.endpoints = endpoints
+	proxy.current = nil
+}
+
+func (proxy *failoverProxy) ExchangeKey() (*ServerKey, error) {
+	return proxy.ExchangeKeyContext(context.Background())
+}
+
+func (proxy *failoverProxy) RegisterConnection(serverKey *ServerKey) (*ServerTicket, error) {
+	return proxy.RegisterConnectionContext(context.Background(), serverKey)
+}
+
+// ExchangeKeyContext tries endpoints by priority until one of them responds
+func (proxy *failoverProxy) ExchangeKeyContext(ctx context.Context) (*ServerKey, error) {
+	var lastErr error
+	for _, endpoint := range proxy.candidates() {
+		serverKey, err := endpoint.proxy.ExchangeKeyContext(ctx)
+		if err == nil {
+			proxy.markHealthy(endpoint)
+			return serverKey, nil
+		}
+		lastErr = err
+		if !isEndpointFailure(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		proxy.markUnhealthy(endpoint, err)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("No endpoint")
+	}
+	return nil, lastErr
+}
+
+// RegisterConnectionContext registers connection on the endpoint which exchanged serverKey
+func (proxy *failoverProxy) RegisterConnectionContext(ctx context.Context, serverKey *ServerKey) (*ServerTicket, error) {
+	proxy.mutex.Lock()
+	endpoint := proxy.current
+	proxy.mutex.Unlock()
+	if endpoint == nil {
+		return nil, errors.New("Key is not exchanged")
+	}
+
+	serverTicket, err := endpoint.proxy.RegisterConnectionContext(ctx, serverKey)
+	if err != nil {
+		if isEndpointFailure(err) && ctx.Err() == nil {
+			proxy.markUnhealthy(endpoint, err)
+		}
+		return nil, err
+	}
+	return serverTicket, nil
+}
+
+func (proxy *failoverProxy) GetCurrentEndpoint() string {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	if proxy.current == nil {
+		return ""
+	}
+	return proxy.current.status.Address
+}
+
+func (proxy *failoverProxy) GetEndpoints() []EndpointStatus {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+	result := make([]EndpointStatus, len(proxy.endpoints))
+	for idx, endpoint := range proxy.endpoints {
+		result[idx] = endpoint.status
+	}
+	return result
+}
+
+// candidates returns healthy endpoints (or endpoints whose cooldown passed) by priority
+// All endpoints are returned when none of them is healthy
+func (proxy *failoverProxy) candidates() []*endpoint {
+	proxy.mutex.Lock()
+	defer proxy.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]*endpoint, 0, len(proxy.endpoints))
+	for _, endpoint := range proxy.endpoints {
+		if endpoint.status.IsHealthy || now.Sub(endpoint.status.UnhealthyAt) >= proxy.cooldown {
+			result = append(result, endpoint)
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, proxy.endpoints...)
+	}
+	return result
+}
+
+func (proxy *failoverProxy) markHealthy(endpoint *endpoint) {
+	proxy.mutex.Lock()
+	endpoint.status.IsHealthy = true
+	endpoint.status.LastError = nil
+	proxy.current = endpoint
+	proxy.mutex.Unlock()
+}
+
+func (proxy *failoverProxy) markUnhealthy(endpoint *endpoint, err error) {
+	proxy.mutex.Lock()
+	endpoint.status.IsHealthy = false
+	endpoint.status.LastError = err
+	endpoint.status.UnhealthyAt = time.Now()
+	if proxy.current == endpoint {
+		proxy.current = nil
+	}
+	proxy.mutex.Unlock()
+}
+
+// isEndpointFailure checks if err is caused by the endpoint (network or HTTP errors)
+// rather than being rejected by the Cloud Socket system
+func isEndpointFailure(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return true
+	}
+	return isTransient(err)
+}
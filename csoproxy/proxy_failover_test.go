@@ -0,0 +1,147 @@
+package csoproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
+func newTestFailoverProxy(t *testing.T, cooldown time.Duration, addresses ...string) *failoverProxy {
+	_, pubKey := testRSA(t)
+	endpoints := make([]config.Endpoint, len(addresses))
+	for idx, addr := range addresses {
+		endpoints[idx] = config.Endpoint{Address: addr, Priority: int32(idx)}
+	}
+	conf := config.NewConfigWithEndpoints(testProjectID, base64.StdEncoding.EncodeToString(testToken), testConnName, pubKey, endpoints)
+	return NewFailoverProxy(conf, cooldown, WithKeyExchange(KeyExchangeX25519, false)).(*failoverProxy)
+}
+
+func candidateAddresses(proxy *failoverProxy) []string {
+	var result []string
+	for _, endpoint := range proxy.candidates() {
+		result = append(result, endpoint.status.Address)
+	}
+	return result
+}
+
+func isSameAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFailoverCandidates(t *testing.T) {
+	proxy := newTestFailoverProxy(t, 50*time.Millisecond, "http://a", "http://b", "http://c")
+	endpoints := proxy.endpoints
+	if !isSameAddresses(candidateAddresses(proxy), []string{"http://a", "http://b", "http://c"}) {
+		t.Error("[TestFailoverCandidates] candidates are not sorted by priority")
+	}
+
+	// Unhealthy endpoints are skipped for cooldown
+	errFailed := errors.New("failed")
+	proxy.markUnhealthy(endpoints[0], errFailed)
+	proxy.markUnhealthy(endpoints[2], errFailed)
+	if !isSameAddresses(candidateAddresses(proxy), []string{"http://b"}) {
+		t.Error("[TestFailoverCandidates] unhealthy endpoints are not skipped")
+	}
+	status := proxy.GetEndpoints()[0]
+	if status.IsHealthy || status.LastError != errFailed || status.UnhealthyAt.IsZero() {
+		t.Error("[TestFailoverCandidates] invalid status of unhealthy endpoint")
+	}
+
+	// All endpoints are tried when none of them is healthy
+	proxy.markUnhealthy(endpoints[1], errFailed)
+	if !isSameAddresses(candidateAddresses(proxy), []string{"http://a", "http://b", "http://c"}) {
+		t.Error("[TestFailoverCandidates] endpoints are not tried when all are unhealthy")
+	}
+
+	// Endpoints are tried again after cooldown
+	proxy.markHealthy(endpoints[1])
+	if !isSameAddresses(candidateAddresses(proxy), []string{"http://b"}) {
+		t.Error("[TestFailoverCandidates] healthy endpoint is skipped")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !isSameAddresses(candidateAddresses(proxy), []string{"http://a", "http://b", "http://c"}) {
+		t.Error("[TestFailoverCandidates] endpoints are skipped after cooldown")
+	}
+
+	// The current endpoint is reset when it becomes unhealthy
+	if proxy.GetCurrentEndpoint() != "http://b" {
+		t.Error("[TestFailoverCandidates] invalid current endpoint")
+	}
+	proxy.markUnhealthy(endpoints[1], errFailed)
+	if proxy.GetCurrentEndpoint() != "" {
+		t.Error("[TestFailoverCandidates] unhealthy endpoint is current")
+	}
+
+	// Health of unchanged addresses is kept when config changes
+	_, pubKey := testRSA(t)
+	proxy.SetConfig(config.NewConfigWithEndpoints(testProjectID, "", testConnName, pubKey, []config.Endpoint{
+		{Address: "http://d", Priority: 0},
+		{Address: "http://b", Priority: 1},
+	}))
+	statuses := proxy.GetEndpoints()
+	if len(statuses) != 2 || !statuses[0].IsHealthy || statuses[1].IsHealthy || statuses[1].Priority != 1 {
+		t.Error("[TestFailoverCandidates] invalid endpoints after config changes")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	failedServer, failedHTTPServer := newTestServer(t)
+	failedServer.handlers["exchange-key"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	server, httpServer := newTestServer(t)
+	proxy := newTestFailoverProxy(t, time.Minute, failedHTTPServer.URL, httpServer.URL)
+
+	serverKey, err := proxy.ExchangeKeyContext(context.Background())
+	if err != nil {
+		t.Fatalf("[TestFailover] exchange key failed: %s", err.Error())
+	}
+	if proxy.GetCurrentEndpoint() != httpServer.URL {
+		t.Error("[TestFailover] invalid current endpoint")
+	}
+	statuses := proxy.GetEndpoints()
+	if statuses[0].IsHealthy || !statuses[1].IsHealthy {
+		t.Error("[TestFailover] invalid health of endpoints")
+	}
+	if _, err = proxy.RegisterConnectionContext(context.Background(), serverKey); err != nil {
+		t.Errorf("[TestFailover] register connection failed: %s", err.Error())
+	}
+	if server.numberHit["register-connection"] != 1 || failedServer.numberHit["register-connection"] != 0 {
+		t.Error("[TestFailover] connection is not registered on the current endpoint")
+	}
+
+	// The unhealthy endpoint is skipped for cooldown
+	_, err = proxy.ExchangeKeyContext(context.Background())
+	if err != nil || failedServer.numberHit["exchange-key"] != 1 || server.numberHit["exchange-key"] != 2 {
+		t.Error("[TestFailover] unhealthy endpoint is not skipped")
+	}
+
+	// Rejections of the Cloud Socket system do not fail over
+	server.handlers["exchange-key"] = func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, 0, "rejected")
+	}
+	proxy = newTestFailoverProxy(t, time.Minute, httpServer.URL, failedHTTPServer.URL)
+	_, err = proxy.ExchangeKeyContext(context.Background())
+	var proxyErr *Error
+	if !errors.As(err, &proxyErr) || failedServer.numberHit["exchange-key"] != 1 || !proxy.GetEndpoints()[0].IsHealthy {
+		t.Error("[TestFailover] rejected request fails over")
+	}
+
+	// Registration without an exchanged key
+	if _, err = proxy.RegisterConnectionContext(context.Background(), serverKey); err == nil {
+		t.Error("[TestFailover] connection is registered without exchanged key")
+	}
+}
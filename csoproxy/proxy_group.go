@@ -0,0 +1,116 @@
+package csoproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/utils"
+)
+
+// JoinGroupContext adds the connection to a group and returns groups of the connection
+func (proxy *proxyImpl) JoinGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	if groupName == "" {
+		return nil, errors.New("Invalid group name")
+	}
+	return proxy.invokeGroupAPI(ctx, "join-group", groupName)
+}
+
+// LeaveGroupContext removes the connection from a group and returns groups of the connection
+func (proxy *proxyImpl) LeaveGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	if groupName == "" {
+		return nil, errors.New("Invalid group name")
+	}
+	return proxy.invokeGroupAPI(ctx, "leave-group", groupName)
+}
+
+// GetGroupsContext returns groups of the connection
+func (proxy *proxyImpl) GetGroupsContext(ctx context.Context) ([]string, error) {
+	return proxy.invokeGroupAPI(ctx, "get-groups", "")
+}
+
+// invokeGroupAPI invokes a group API, the request is signed by HMAC with the project's token
+// Signed data: project ID, connection name, group name and timestamp (8 bytes, little endian, unix milliseconds)
+func (proxy *proxyImpl) invokeGroupAPI(ctx context.Context, api string, groupName string) ([]string, error) {
+	decodedToken, err := base64.StdEncoding.DecodeString(proxy.conf.GetProjectToken())
+	if err != nil {
+		return nil, err
+	}
+	projectID := proxy.conf.GetProjectID()
+	connName := proxy.conf.GetConnectionName()
+	timestamp := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	buffer := make([]byte, 0, len(projectID)+len(connName)+len(groupName)+8)
+	buffer = append(buffer, projectID...)
+	buffer = append(buffer, connName...)
+	buffer = append(buffer, groupName...)
+	buffer = binary.LittleEndian.AppendUint64(buffer, timestamp)
+	sign, err := utils.CalcHMAC(decodedToken, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	req := make(map[string]interface{})
+	req["project_id"] = projectID
+	req["unique_name"] = connName
+	if groupName != "" {
+		req["group_name"] = groupName
+	}
+	req["timestamp"] = timestamp
+	req["sign"] = base64.StdEncoding.EncodeToString(sign)
+
+	resp := new(respGroups)
+	err = proxy.invokeAPI(ctx, api, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Groups == nil {
+		return []string{}, nil
+	}
+	return resp.Groups, nil
+}
+
+func (proxy *failoverProxy) JoinGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	return proxy.invokeGroupAPI(ctx, func(impl *proxyImpl) ([]string, error) {
+		return impl.JoinGroupContext(ctx, groupName)
+	})
+}
+
+func (proxy *failoverProxy) LeaveGroupContext(ctx context.Context, groupName string) ([]string, error) {
+	return proxy.invokeGroupAPI(ctx, func(impl *proxyImpl) ([]string, error) {
+		return impl.LeaveGroupContext(ctx, groupName)
+	})
+}
+
+func (proxy *failoverProxy) GetGroupsContext(ctx context.Context) ([]string, error) {
+	return proxy.invokeGroupAPI(ctx, func(impl *proxyImpl) ([]string, error) {
+		return impl.GetGroupsContext(ctx)
+	})
+}
+
+// invokeGroupAPI tries endpoints by priority until one of them responds
+// The endpoint of the last exchanged key is not changed
+func (proxy *failoverProxy) invokeGroupAPI(ctx context.Context, call func(impl *proxyImpl) ([]string, error)) ([]string, error) {
+	var lastErr error
+	for _, endpoint := range proxy.candidates() {
+		groups, err := call(endpoint.proxy)
+		if err == nil {
+			proxy.mutex.Lock()
+			endpoint.status.IsHealthy = true
+			endpoint.status.LastError = nil
+			proxy.mutex.Unlock()
+			return groups, nil
+		}
+		lastErr = err
+		if !isEndpointFailure(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		proxy.markUnhealthy(endpoint, err)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("No endpoint")
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,84 @@
+package csoproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGroupAPI(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	groups := []string{"group", "other"}
+	respond := func(w http.ResponseWriter, r *http.Request) {
+		req := make(map[string]interface{})
+		if jsoniter.ConfigFastest.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		server.mutex.Lock()
+		server.requests[r.URL.Path[1:]] = append(server.requests[r.URL.Path[1:]], req)
+		server.mutex.Unlock()
+		writeResponse(w, 1, map[string]interface{}{"groups": groups})
+	}
+	for _, api := range []string{"join-group", "leave-group", "get-groups"} {
+		server.handlers[api] = respond
+	}
+	proxy := NewProxy(newTestConfig(t, httpServer.URL))
+
+	cases := []struct {
+		api       string
+		groupName string
+		call      func() ([]string, error)
+	}{
+		{"join-group", "group", func() ([]string, error) { return proxy.JoinGroupContext(context.Background(), "group") }},
+		{"leave-group", "group", func() ([]string, error) { return proxy.LeaveGroupContext(context.Background(), "group") }},
+		{"get-groups", "", func() ([]string, error) { return proxy.GetGroupsContext(context.Background()) }},
+	}
+	for _, c := range cases {
+		result, err := c.call()
+		if err != nil || !reflect.DeepEqual(result, groups) {
+			t.Errorf("[TestGroupAPI] invalid groups of %s", c.api)
+			continue
+		}
+
+		// The request is signed by the project's token
+		req := server.requests[c.api][0]
+		groupName, hasGroup := req["group_name"]
+		if req["project_id"] != testProjectID || req["unique_name"] != testConnName || hasGroup != (c.groupName != "") ||
+			(hasGroup && groupName != c.groupName) {
+			t.Errorf("[TestGroupAPI] invalid request of %s", c.api)
+			continue
+		}
+		timestamp, _ := req["timestamp"].(float64)
+		buffer := []byte(testProjectID + testConnName + c.groupName)
+		buffer = binary.LittleEndian.AppendUint64(buffer, uint64(timestamp))
+		sign, _ := utils.CalcHMAC(testToken, buffer)
+		if req["sign"] != base64.StdEncoding.EncodeToString(sign) {
+			t.Errorf("[TestGroupAPI] invalid sign of %s", c.api)
+		}
+	}
+
+	// Empty group names are rejected without requests
+	if _, err := proxy.JoinGroupContext(context.Background(), ""); err == nil {
+		t.Error("[TestGroupAPI] empty group name is joined")
+	}
+	if _, err := proxy.LeaveGroupContext(context.Background(), ""); err == nil {
+		t.Error("[TestGroupAPI] empty group name is left")
+	}
+	if server.numberHit["join-group"] != 1 || server.numberHit["leave-group"] != 1 {
+		t.Error("[TestGroupAPI] request of an empty group name is sent")
+	}
+
+	// A response without groups is an empty list
+	groups = nil
+	result, err := proxy.GetGroupsContext(context.Background())
+	if err != nil || result == nil || len(result) != 0 {
+		t.Error("[TestGroupAPI] response without groups is not an empty list")
+	}
+}
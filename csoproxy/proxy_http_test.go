@@ -0,0 +1,154 @@
+package csoproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrorIsTransient(t *testing.T) {
+	cases := []struct {
+		statusCode  int
+		isTransient bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+	}
+	for _, c := range cases {
+		err := &HTTPError{API: "get-groups", StatusCode: c.statusCode}
+		if err.IsTransient() != c.isTransient || isTransient(err) != c.isTransient {
+			t.Errorf("[TestHTTPErrorIsTransient] invalid result of status %d", c.statusCode)
+		}
+	}
+	if isTransient(context.Canceled) || isTransient(context.DeadlineExceeded) {
+		t.Error("[TestHTTPErrorIsTransient] cancelled request is transient")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	cases := []struct {
+		name        string
+		statusCode  int
+		numberFail  int
+		numberRetry int
+		numberHit   int
+		isValid     bool
+	}{
+		{"transient status", http.StatusServiceUnavailable, 2, 3, 3, true},
+		{"too many requests", http.StatusTooManyRequests, 1, 1, 2, true},
+		{"retries exhausted", http.StatusBadGateway, 5, 2, 3, false},
+		{"permanent status", http.StatusBadRequest, 1, 3, 1, false},
+		{"no retry", http.StatusServiceUnavailable, 1, 0, 1, false},
+	}
+	for _, c := range cases {
+		server, httpServer := newTestServer(t)
+		numberFail := c.numberFail
+		server.handlers["get-groups"] = func(w http.ResponseWriter, r *http.Request) {
+			if numberFail > 0 {
+				numberFail--
+				w.WriteHeader(c.statusCode)
+				w.Write([]byte("failed"))
+				return
+			}
+			writeResponse(w, 1, map[string]interface{}{"groups": []string{"group"}})
+		}
+		proxy := NewProxy(newTestConfig(t, httpServer.URL), WithRetry(c.numberRetry, time.Millisecond))
+
+		groups, err := proxy.GetGroupsContext(context.Background())
+		if (err == nil) != c.isValid {
+			t.Errorf("[TestRetry] invalid result of %s", c.name)
+		}
+		if c.isValid && (len(groups) != 1 || groups[0] != "group") {
+			t.Errorf("[TestRetry] invalid groups of %s", c.name)
+		}
+		var httpErr *HTTPError
+		if !c.isValid && (!errors.As(err, &httpErr) || httpErr.StatusCode != c.statusCode || httpErr.Body != "failed") {
+			t.Errorf("[TestRetry] invalid error of %s", c.name)
+		}
+		if server.numberHit["get-groups"] != c.numberHit {
+			t.Errorf("[TestRetry] invalid number of requests of %s", c.name)
+		}
+	}
+}
+
+func TestResponseData(t *testing.T) {
+	cases := []struct {
+		name       string
+		returnCode int32
+		data       interface{}
+		message    string
+	}{
+		{"string error", 0, "invalid sign", "invalid sign"},
+		{"object error", 3, map[string]interface{}{"reason": "expired"}, `{"reason":"expired"}`},
+		{"number error", 4, 5, "5"},
+		{"string data", 1, "groups", ""},
+		{"list data", 1, []string{"group"}, ""},
+	}
+	for _, c := range cases {
+		server, httpServer := newTestServer(t)
+		server.handlers["get-groups"] = func(w http.ResponseWriter, r *http.Request) {
+			writeResponse(w, c.returnCode, c.data)
+		}
+		_, err := NewProxy(newTestConfig(t, httpServer.URL)).GetGroupsContext(context.Background())
+		if c.returnCode == 1 {
+			if err != ErrInvalidResponse {
+				t.Errorf("[TestResponseData] invalid error of %s", c.name)
+			}
+			continue
+		}
+		var proxyErr *Error
+		if !errors.As(err, &proxyErr) || proxyErr.ReturnCode != c.returnCode || proxyErr.Message != c.message {
+			t.Errorf("[TestResponseData] invalid error of %s", c.name)
+		}
+	}
+
+	// Body larger than MaxResponseSize
+	server, httpServer := newTestServer(t)
+	server.handlers["get-groups"] = func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, 1, map[string]interface{}{"groups": []string{strings.Repeat("a", MaxResponseSize)}})
+	}
+	_, err := NewProxy(newTestConfig(t, httpServer.URL)).GetGroupsContext(context.Background())
+	if err != ErrResponseTooLarge {
+		t.Error("[TestResponseData] large response is accepted")
+	}
+}
+
+func TestRequestHook(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	var headers http.Header
+	server.handlers["get-groups"] = func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		writeResponse(w, 1, map[string]interface{}{"groups": []string{}})
+	}
+	proxy := NewProxy(
+		newTestConfig(t, httpServer.URL),
+		WithUserAgent("test-agent"),
+		WithRequestHook(func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("User-Agent", req.Header.Get("User-Agent")+"/hooked")
+		}),
+	)
+
+	_, err := proxy.GetGroupsContext(context.Background())
+	if err != nil {
+		t.Fatalf("[TestRequestHook] request failed: %s", err.Error())
+	}
+	if headers.Get("Authorization") != "Bearer token" {
+		t.Error("[TestRequestHook] header of hook is not sent")
+	}
+	if headers.Get("User-Agent") != "test-agent/hooked" {
+		t.Error("[TestRequestHook] hook does not run after default headers")
+	}
+	if headers.Get("Content-Type") != "application/json" {
+		t.Error("[TestRequestHook] invalid content type")
+	}
+}
@@ -2,13 +2,17 @@ package csoproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gecosys/cso-client-golang/config"
 	"github.com/gecosys/cso-client-golang/message/ticket"
@@ -16,66 +20,69 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
+// MaxResponseSize is the maximum size (bytes) of a response body of the Proxy server
+const MaxResponseSize = 1 << 20
+
 // proxyImpl is not a thread-safe, just use it on a single thread
 type proxyImpl struct {
 	conf                       config.Config
-	respHTTP                   *response
+	address                    string // address of the Proxy server, CSOAddress of conf is used when it is empty
+	client                     *http.Client
+	userAgent                  string
+	numberRetry                int
+	retryDelay                 time.Duration
+	requestHook                func(req *http.Request)
+	keyExchange                KeyExchange
+	allowLegacy                bool // fall back to KeyExchangeDH if the server does not support keyExchange
 	respDataExchangeKey        *respExchangeKey
 	respDataRegisterConnection *respRegisterConnection
 }
 
 // NewProxy inits a new instance of Proxy interface
-func NewProxy(conf config.Config) Proxy {
-	return &proxyImpl{
+func NewProxy(conf config.Config, opts ...Option) Proxy {
+	proxy := &proxyImpl{
 		conf:                       conf,
-		respHTTP:                   new(response),
+		client:                     &http.Client{Timeout: DefaultTimeout},
+		userAgent:                  DefaultUserAgent,
+		numberRetry:                0,
+		retryDelay:                 time.Second,
+		keyExchange:                KeyExchangeDH,
+		allowLegacy:                true,
 		respDataExchangeKey:        new(respExchangeKey),
 		respDataRegisterConnection: new(respRegisterConnection),
 	}
+	for _, opt := range opts {
+		opt(proxy)
+	}
+	return proxy
 }
 
 // ExchangeKey gets the public keys of connection
 func (proxy *proxyImpl) ExchangeKey() (*ServerKey, error) {
-	url := fmt.Sprintf("%s/exchange-key", proxy.conf.GetCSOAddress())
+	return proxy.ExchangeKeyContext(context.Background())
+}
 
+// ExchangeKeyContext gets the public keys of connection, the request is canceled when ctx is done
+func (proxy *proxyImpl) ExchangeKeyContext(ctx context.Context) (*ServerKey, error) {
 	req := make(map[string]interface{})
 	req["project_id"] = proxy.conf.GetProjectID()
 	req["unique_name"] = proxy.conf.GetConnectionName()
-
-	buf, err := jsoniter.ConfigFastest.Marshal(&req)
-	if err != nil {
-		return nil, err
-	}
-
-	httpResp, err := http.Post(url, "application/json", bytes.NewBuffer(buf))
-	if err != nil {
-		return nil, err
-	}
-
-	defer httpResp.Body.Close()
-
-	body, err := ioutil.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, err
+	if proxy.keyExchange != KeyExchangeDH {
+		req["kex_version"] = proxy.keyExchange
 	}
 
-	err = jsoniter.ConfigFastest.Unmarshal(body, &proxy.respHTTP)
+	*proxy.respDataExchangeKey = respExchangeKey{}
+	err := proxy.invokeAPI(ctx, "exchange-key", req, proxy.respDataExchangeKey)
 	if err != nil {
 		return nil, err
 	}
-	if proxy.respHTTP.ReturnCode != 1 {
-		return nil, errors.New(proxy.respHTTP.Data.(string))
-	}
 
-	data, err := jsoniter.ConfigFastest.Marshal(proxy.respHTTP.Data.(map[string]interface{}))
-	if err != nil {
-		return nil, err
+	version := KeyExchange(proxy.respDataExchangeKey.Version)
+	if version == KeyExchangeX25519 && proxy.keyExchange == KeyExchangeX25519 {
+		return proxy.parseX25519Key()
 	}
-
-	// Parse response
-	err = jsoniter.ConfigFastest.Unmarshal(data, &proxy.respDataExchangeKey)
-	if err != nil {
-		return nil, err
+	if version > KeyExchangeDH || proxy.keyExchange != KeyExchangeDH && !proxy.allowLegacy {
+		return nil, errors.New("Unsupported key exchange")
 	}
 
 	// Parse signature base64
@@ -119,25 +126,50 @@ func (proxy *proxyImpl) ExchangeKey() (*ServerKey, error) {
 	}
 
 	return &ServerKey{
-		GKey:   gKey,
-		NKey:   nKey,
-		PubKey: serverPubKey,
+		Version: KeyExchangeDH,
+		GKey:    gKey,
+		NKey:    nKey,
+		PubKey:  serverPubKey,
 	}, nil
 }
 
-// RegisterConnection registers connection on a Hub server
-func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket, error) {
-	clientPrivKey, err := utils.GenerateDHPrivateKey()
+// parseX25519Key verifies public server-key of KeyExchangeX25519 with the signature
+// The signature covers the label of the version, so a legacy signature cannot be reused
+func (proxy *proxyImpl) parseX25519Key() (*ServerKey, error) {
+	sign, err := base64.StdEncoding.DecodeString(proxy.respDataExchangeKey.Sign)
+	if err != nil {
+		return nil, err
+	}
+	buffer := append([]byte("cso-kex-v2"), proxy.respDataExchangeKey.PublicKey...)
+	err = utils.VerifyRSASign(proxy.conf.GetCSOPublicKey(), sign, buffer)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate secret key (AES-GCM)
-	clientPubKey, err := utils.CalcDHKeys(serverKey.GKey, serverKey.NKey, clientPrivKey)
+	serverPubKey, err := base64.StdEncoding.DecodeString(proxy.respDataExchangeKey.PublicKey)
+	if err != nil || len(serverPubKey) != utils.X25519KeySize {
+		return nil, errors.New("Invalid public server-key")
+	}
+	return &ServerKey{
+		Version:      KeyExchangeX25519,
+		X25519PubKey: serverPubKey,
+	}, nil
+}
+
+// RegisterConnection registers connection on a Hub server
+func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket, error) {
+	return proxy.RegisterConnectionContext(context.Background(), serverKey)
+}
+
+// RegisterConnectionContext registers connection on a Hub server, the request is canceled when ctx is done
+func (proxy *proxyImpl) RegisterConnectionContext(ctx context.Context, serverKey *ServerKey) (*ServerTicket, error) {
+	agreement, err := newKeyAgreement(serverKey)
 	if err != nil {
 		return nil, err
 	}
-	clientSecretKey, err := utils.CalcSecretKey(serverKey.NKey, clientPrivKey, serverKey.PubKey)
+
+	// Calculate secret key (AES-GCM)
+	clientSecretKey, err := agreement.clientSecretKey()
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +181,7 @@ func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket,
 	}
 	projectID := proxy.conf.GetProjectID()
 	connName := proxy.conf.GetConnectionName()
-	strClientPubKey := clientPubKey.String()
+	strClientPubKey := agreement.publicKey()
 	lenProjectID := len(projectID)
 	lenProjectIDConnName := lenProjectID + len(connName)
 	lenAAD := lenProjectIDConnName + len(strClientPubKey)
@@ -163,8 +195,6 @@ func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket,
 	}
 
 	// Invoke API
-	url := fmt.Sprintf("%s/register-connection", proxy.conf.GetCSOAddress())
-
 	req := make(map[string]interface{})
 	req["project_id"] = projectID
 	req["project_token"] = base64.StdEncoding.EncodeToString(cipherProjectToken)
@@ -172,39 +202,11 @@ func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket,
 	req["public_key"] = strClientPubKey
 	req["iv"] = base64.StdEncoding.EncodeToString(cipherIV)
 	req["authen_tag"] = base64.StdEncoding.EncodeToString(cipherAuthenTag)
-
-	buf, err := jsoniter.ConfigFastest.Marshal(&req)
-	if err != nil {
-		return nil, err
-	}
-
-	httpResp, err := http.Post(url, "application/json", bytes.NewBuffer(buf))
-	if err != nil {
-		return nil, err
-	}
-
-	defer httpResp.Body.Close()
-
-	body, err := ioutil.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	err = jsoniter.ConfigFastest.Unmarshal(body, &proxy.respHTTP)
-	if err != nil {
-		return nil, err
-	}
-	if proxy.respHTTP.ReturnCode != 1 {
-		return nil, errors.New(proxy.respHTTP.Data.(string))
+	if serverKey.Version == KeyExchangeX25519 {
+		req["kex_version"] = KeyExchangeX25519
 	}
 
-	data, err := jsoniter.ConfigFastest.Marshal(proxy.respHTTP.Data.(map[string]interface{}))
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse response
-	err = jsoniter.ConfigFastest.Unmarshal(data, &proxy.respDataRegisterConnection)
+	err = proxy.invokeAPI(ctx, "register-connection", req, proxy.respDataRegisterConnection)
 	if err != nil {
 		return nil, err
 	}
@@ -216,12 +218,7 @@ func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket,
 	copy(serverAad[2:], proxy.respDataRegisterConnection.HubAddress)
 	copy(serverAad[lenAadAddress:], proxy.respDataRegisterConnection.PublicKey)
 
-	serverPubKey, isOk := new(big.Int).SetString(proxy.respDataRegisterConnection.PublicKey, 10)
-	if !isOk {
-		err = errors.New("Invalid public hub-key")
-		return nil, err
-	}
-	serverSecretKey, err := utils.CalcSecretKey(serverKey.NKey, clientPrivKey, serverPubKey)
+	serverSecretKey, err := agreement.hubSecretKey(proxy.respDataRegisterConnection.PublicKey)
 	if err != nil {
 		return nil, err
 	}
@@ -253,5 +250,123 @@ func (proxy *proxyImpl) RegisterConnection(serverKey *ServerKey) (*ServerTicket,
 		TicketID:        proxy.respDataRegisterConnection.TicketID,
 		TicketBytes:     ticketBytes,
 		ServerSecretKey: serverSecretKey,
+		ProxyAddress:    proxy.getAddress(),
+		IssuedAt:        time.Now(),
 	}, err
 }
+
+func (proxy *proxyImpl) SetConfig(conf config.Config) {
+	proxy.conf = conf
+}
+
+func (proxy *proxyImpl) getAddress() string {
+	if proxy.address != "" {
+		return proxy.address
+	}
+	return proxy.conf.GetCSOAddress()
+}
+
+// invokeAPI posts req to api of the Proxy server and parses data of the response into result
+func (proxy *proxyImpl) invokeAPI(ctx context.Context, api string, req map[string]interface{}, result interface{}) error {
+	buf, err := jsoniter.ConfigFastest.Marshal(&req)
+	if err != nil {
+		return err
+	}
+
+	var (
+		body  []byte
+		delay = proxy.retryDelay
+	)
+	for idx := 0; ; idx++ {
+		body, err = proxy.post(ctx, api, buf)
+		if err == nil || idx >= proxy.numberRetry || !isTransient(err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return err
+	}
+
+	resp := new(response)
+	err = jsoniter.ConfigFastest.Unmarshal(body, resp)
+	if err != nil {
+		return err
+	}
+	if resp.ReturnCode != 1 {
+		return newError(api, resp)
+	}
+
+	respData, isOk := resp.Data.(map[string]interface{})
+	if !isOk {
+		return ErrInvalidResponse
+	}
+	data, err := jsoniter.ConfigFastest.Marshal(respData)
+	if err != nil {
+		return err
+	}
+
+	// Parse response
+	return jsoniter.ConfigFastest.Unmarshal(data, result)
+}
+
+func (proxy *proxyImpl) post(ctx context.Context, api string, buf []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s", proxy.getAddress(), api)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if proxy.userAgent != "" {
+		httpReq.Header.Set("User-Agent", proxy.userAgent)
+	}
+	if proxy.requestHook != nil {
+		proxy.requestHook(httpReq)
+	}
+
+	httpResp, err := proxy.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	defer httpResp.Body.Close()
+
+	// Read one more byte to detect a body which is larger than the limit
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	isTooLarge := len(body) > MaxResponseSize
+	if isTooLarge {
+		body = body[:MaxResponseSize]
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return nil, &HTTPError{
+			API:        api,
+			StatusCode: httpResp.StatusCode,
+			Body:       string(body),
+		}
+	}
+	if isTooLarge {
+		return nil, ErrResponseTooLarge
+	}
+	return body, nil
+}
+
+// isTransient checks if err is a network error or a transient HTTP status
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.IsTransient()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
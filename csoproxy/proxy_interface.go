@@ -1,7 +1,33 @@
 package csoproxy
 
+import (
+	"context"
+
+	"github.com/gecosys/cso-client-golang/config"
+)
+
 // Proxy interacts with Proxy server
 type Proxy interface {
 	ExchangeKey() (*ServerKey, error)
 	RegisterConnection(serverKey *ServerKey) (*ServerTicket, error)
+
+	ExchangeKeyContext(ctx context.Context) (*ServerKey, error)
+	RegisterConnectionContext(ctx context.Context, serverKey *ServerKey) (*ServerTicket, error)
+
+	// Group APIs return groups of the connection after the request
+	JoinGroupContext(ctx context.Context, groupName string) ([]string, error)
+	LeaveGroupContext(ctx context.Context, groupName string) ([]string, error)
+	GetGroupsContext(ctx context.Context) ([]string, error)
+
+	// SetConfig replaces config which is used by next requests
+	SetConfig(conf config.Config)
+}
+
+// FailoverProxy is a Proxy which fails over between many Proxy servers
+type FailoverProxy interface {
+	Proxy
+
+	// GetCurrentEndpoint returns address of the endpoint which exchanged the last key
+	GetCurrentEndpoint() string
+	GetEndpoints() []EndpointStatus
 }
@@ -0,0 +1,111 @@
+package csoproxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/big"
+
+	"github.com/gecosys/cso-client-golang/utils"
+)
+
+// KeyExchange is version of the key exchange with the Proxy server
+type KeyExchange int32
+
+const (
+	// KeyExchangeDH is the legacy finite-field Diffie-Hellman, keys are decimal strings
+	KeyExchangeDH KeyExchange = 1
+	// KeyExchangeX25519 is ECDH on X25519 with HKDF-SHA256, keys are base64 strings
+	KeyExchangeX25519 KeyExchange = 2
+)
+
+// HKDF infos of secret keys in the X25519 key exchange
+var (
+	infoRegister = []byte("cso-register-v2")
+	infoHub      = []byte("cso-hub-v2")
+)
+
+// keyAgreement holds the client keys of a registration
+type keyAgreement interface {
+	// publicKey returns public client-key in format of the key exchange
+	publicKey() string
+	// clientSecretKey returns key which encrypts project's token
+	clientSecretKey() ([]byte, error)
+	// hubSecretKey returns key which decrypts ticket's token by public hub-key
+	hubSecretKey(hubPubKey string) ([]byte, error)
+}
+
+func newKeyAgreement(serverKey *ServerKey) (keyAgreement, error) {
+	if serverKey.Version == KeyExchangeX25519 {
+		privKey, err := utils.GenerateX25519PrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		pubKey, err := utils.CalcX25519PublicKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+		return &x25519Agreement{
+			serverPubKey: serverKey.X25519PubKey,
+			privKey:      privKey,
+			pubKey:       pubKey,
+		}, nil
+	}
+
+	privKey, err := utils.GenerateDHPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := utils.CalcDHKeys(serverKey.GKey, serverKey.NKey, privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &dhAgreement{
+		serverKey: serverKey,
+		privKey:   privKey,
+		pubKey:    pubKey,
+	}, nil
+}
+
+type dhAgreement struct {
+	serverKey *ServerKey
+	privKey   *big.Int
+	pubKey    *big.Int
+}
+
+func (agreement *dhAgreement) publicKey() string {
+	return agreement.pubKey.String()
+}
+
+func (agreement *dhAgreement) clientSecretKey() ([]byte, error) {
+	return utils.CalcSecretKey(agreement.serverKey.NKey, agreement.privKey, agreement.serverKey.PubKey)
+}
+
+func (agreement *dhAgreement) hubSecretKey(hubPubKey string) ([]byte, error) {
+	pubKey, isOk := new(big.Int).SetString(hubPubKey, 10)
+	if !isOk {
+		return nil, errors.New("Invalid public hub-key")
+	}
+	return utils.CalcSecretKey(agreement.serverKey.NKey, agreement.privKey, pubKey)
+}
+
+type x25519Agreement struct {
+	serverPubKey []byte
+	privKey      []byte
+	pubKey       []byte
+}
+
+func (agreement *x25519Agreement) publicKey() string {
+	return base64.StdEncoding.EncodeToString(agreement.pubKey)
+}
+
+func (agreement *x25519Agreement) clientSecretKey() ([]byte, error) {
+	return utils.CalcX25519SecretKey(agreement.privKey, agreement.serverPubKey, nil, infoRegister)
+}
+
+func (agreement *x25519Agreement) hubSecretKey(hubPubKey string) ([]byte, error) {
+	pubKey, err := base64.StdEncoding.DecodeString(hubPubKey)
+	if err != nil || len(pubKey) != utils.X25519KeySize {
+		return nil, errors.New("Invalid public hub-key")
+	}
+	return utils.CalcX25519SecretKey(agreement.privKey, pubKey, nil, infoHub)
+}
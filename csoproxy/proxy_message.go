@@ -1,13 +1,19 @@
 package csoproxy
 
-import "math/big"
+import (
+	"math/big"
+	"time"
+)
 
 type (
 	// ServerKey is a group of server keys
+	// GKey, NKey and PubKey are set by KeyExchangeDH, X25519PubKey is set by KeyExchangeX25519
 	ServerKey struct {
-		GKey   *big.Int
-		NKey   *big.Int
-		PubKey *big.Int
+		Version      KeyExchange
+		GKey         *big.Int
+		NKey         *big.Int
+		PubKey       *big.Int
+		X25519PubKey []byte
 	}
 
 	// ServerTicket is an activation ticket from the Hub server
@@ -16,6 +22,8 @@ type (
 		TicketID        uint32
 		TicketBytes     []byte
 		ServerSecretKey []byte
+		ProxyAddress    string // address of the Proxy server which issued the ticket
+		IssuedAt        time.Time
 	}
 
 	// response is format message of HTTP response from the Proxy server
@@ -27,6 +35,7 @@ type (
 
 	// respExchangeKey is response of exchange-key API from the Proxy server
 	respExchangeKey struct {
+		Version   int32  `json:"kex_version"` // 0 if the server only supports KeyExchangeDH
 		GKey      string `json:"g_key"`
 		NKey      string `json:"n_key"`
 		PublicKey string `json:"pub_key"`
@@ -42,4 +51,9 @@ type (
 		IV          string `json:"iv"`
 		AuthenTag   string `json:"auth_tag"`
 	}
+
+	// respGroups is response of group APIs (join-group, leave-group, get-groups) from the Proxy server
+	respGroups struct {
+		Groups []string `json:"groups"`
+	}
 )
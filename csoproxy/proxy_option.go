@@ -0,0 +1,74 @@
+package csoproxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout is timeout of HTTP requests when no client is given
+const DefaultTimeout = 30 * time.Second
+
+// DefaultUserAgent is value of User-Agent header of HTTP requests
+const DefaultUserAgent = "cso-client-golang"
+
+// Option configures HTTP requests of Proxy
+type Option func(proxy *proxyImpl)
+
+// WithHTTPClient sets the client which sends HTTP requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(proxy *proxyImpl) {
+		if client != nil {
+			proxy.client = client
+		}
+	}
+}
+
+// WithTransport sets the transport (proxy settings, TLS config...) of HTTP requests
+func WithTransport(transport http.RoundTripper) Option {
+	return func(proxy *proxyImpl) {
+		client := *proxy.client
+		client.Transport = transport
+		proxy.client = &client
+	}
+}
+
+// WithTimeout sets timeout of each HTTP request
+func WithTimeout(timeout time.Duration) Option {
+	return func(proxy *proxyImpl) {
+		client := *proxy.client
+		client.Timeout = timeout
+		proxy.client = &client
+	}
+}
+
+// WithUserAgent sets value of User-Agent header
+func WithUserAgent(userAgent string) Option {
+	return func(proxy *proxyImpl) {
+		proxy.userAgent = userAgent
+	}
+}
+
+// WithRetry resends a request up to numberRetry times on transient errors (network errors, 5xx, 408, 429)
+// Delay between attempts starts at delay and doubles after each attempt
+func WithRetry(numberRetry int, delay time.Duration) Option {
+	return func(proxy *proxyImpl) {
+		proxy.numberRetry = numberRetry
+		proxy.retryDelay = delay
+	}
+}
+
+// WithRequestHook sets a function which customizes every HTTP request before it is sent
+func WithRequestHook(hook func(req *http.Request)) Option {
+	return func(proxy *proxyImpl) {
+		proxy.requestHook = hook
+	}
+}
+
+// WithKeyExchange offers version of the key exchange to the Proxy server
+// Servers which do not support the version fall back to KeyExchangeDH unless allowLegacy is false
+func WithKeyExchange(version KeyExchange, allowLegacy bool) Option {
+	return func(proxy *proxyImpl) {
+		proxy.keyExchange = version
+		proxy.allowLegacy = allowLegacy
+	}
+}
@@ -0,0 +1,305 @@
+package csoproxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gecosys/cso-client-golang/config"
+	"github.com/gecosys/cso-client-golang/utils"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	testProjectID = "project"
+	testConnName  = "connection"
+	testHubAddr   = "hub:1234"
+	testTicketID  = 7
+)
+
+var (
+	testToken       = []byte("project-token")
+	testTicketToken = []byte("0123456789abcdef0123456789abcdef")
+)
+
+var (
+	testRSAOnce   sync.Once
+	testRSAKey    *rsa.PrivateKey
+	testRSAPubKey string
+)
+
+// testRSA returns the key which signs keys of the test server and its PEM public key
+func testRSA(t *testing.T) (*rsa.PrivateKey, string) {
+	testRSAOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			return
+		}
+		pubKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return
+		}
+		testRSAKey = key
+		testRSAPubKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKey}))
+	})
+	if testRSAKey == nil {
+		t.Fatal("[testRSA] generate key failed")
+	}
+	return testRSAKey, testRSAPubKey
+}
+
+func signRSA(t *testing.T, data []byte) string {
+	key, _ := testRSA(t)
+	hashed := sha256.Sum256(data)
+	sign, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal("[signRSA] sign failed")
+	}
+	return base64.StdEncoding.EncodeToString(sign)
+}
+
+// testServer is a Proxy server which supports KeyExchangeX25519
+type testServer struct {
+	t         *testing.T
+	mutex     sync.Mutex
+	version   int32 // kex_version of exchange-key responses, 0 responds as a legacy server
+	badSign   bool  // sign keys with a wrong label
+	privKey   []byte
+	pubKey    []byte
+	hubKey    string // overrides public hub-key of register-connection responses
+	requests  map[string][]map[string]interface{}
+	handlers  map[string]http.HandlerFunc // overrides APIs
+	numberHit map[string]int
+}
+
+func newTestServer(t *testing.T) (*testServer, *httptest.Server) {
+	privKey, _ := utils.GenerateX25519PrivateKey()
+	pubKey, _ := utils.CalcX25519PublicKey(privKey)
+	server := &testServer{
+		t:         t,
+		version:   int32(KeyExchangeX25519),
+		privKey:   privKey,
+		pubKey:    pubKey,
+		requests:  make(map[string][]map[string]interface{}),
+		handlers:  make(map[string]http.HandlerFunc),
+		numberHit: make(map[string]int),
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+func newTestConfig(t *testing.T, address string) config.Config {
+	_, pubKey := testRSA(t)
+	return config.NewConfig(testProjectID, base64.StdEncoding.EncodeToString(testToken), testConnName, pubKey, address)
+}
+
+func (server *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api := strings.TrimPrefix(r.URL.Path, "/")
+	server.mutex.Lock()
+	server.numberHit[api]++
+	handler := server.handlers[api]
+	server.mutex.Unlock()
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+
+	req := make(map[string]interface{})
+	if jsoniter.ConfigFastest.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	server.requests[api] = append(server.requests[api], req)
+	server.mutex.Unlock()
+
+	switch api {
+	case "exchange-key":
+		server.exchangeKey(w, req)
+	case "register-connection":
+		server.registerConnection(w, req)
+	default:
+		writeResponse(w, 1, map[string]interface{}{"groups": []string{}})
+	}
+}
+
+func (server *testServer) exchangeKey(w http.ResponseWriter, req map[string]interface{}) {
+	if server.version == 0 || req["kex_version"] == nil {
+		// Legacy Diffie-Hellman keys
+		gKey, nKey, pubKey := "2", "23", "8"
+		sign := signRSA(server.t, []byte(gKey+nKey+pubKey))
+		writeResponse(w, 1, map[string]interface{}{"g_key": gKey, "n_key": nKey, "pub_key": pubKey, "sign": sign})
+		return
+	}
+	pubKey := base64.StdEncoding.EncodeToString(server.pubKey)
+	label := "cso-kex-v2"
+	if server.badSign {
+		label = "cso-kex-v1"
+	}
+	writeResponse(w, 1, map[string]interface{}{
+		"kex_version": server.version,
+		"pub_key":     pubKey,
+		"sign":        signRSA(server.t, []byte(label+pubKey)),
+	})
+}
+
+func (server *testServer) registerConnection(w http.ResponseWriter, req map[string]interface{}) {
+	strClientPubKey, _ := req["public_key"].(string)
+	clientPubKey, err := base64.StdEncoding.DecodeString(strClientPubKey)
+	if err != nil {
+		writeResponse(w, 0, "invalid public key")
+		return
+	}
+
+	// Decrypt project's token
+	clientSecretKey, err := utils.CalcX25519SecretKey(server.privKey, clientPubKey, nil, infoRegister)
+	if err != nil {
+		writeResponse(w, 0, "invalid public key")
+		return
+	}
+	iv, _ := base64.StdEncoding.DecodeString(req["iv"].(string))
+	authenTag, _ := base64.StdEncoding.DecodeString(req["authen_tag"].(string))
+	cipherToken, _ := base64.StdEncoding.DecodeString(req["project_token"].(string))
+	token, err := utils.DecryptAES(clientSecretKey, iv, authenTag, cipherToken, []byte(testProjectID+testConnName+strClientPubKey))
+	if err != nil || string(token) != string(testToken) {
+		writeResponse(w, 0, "invalid project token")
+		return
+	}
+
+	// Encrypt ticket's token
+	hubPrivKey, _ := utils.GenerateX25519PrivateKey()
+	hubPubKey, _ := utils.CalcX25519PublicKey(hubPrivKey)
+	strHubPubKey := base64.StdEncoding.EncodeToString(hubPubKey)
+	if server.hubKey != "" {
+		strHubPubKey = server.hubKey
+	}
+	hubSecretKey, _ := utils.CalcX25519SecretKey(hubPrivKey, clientPubKey, nil, infoHub)
+	aad := make([]byte, 2)
+	binary.LittleEndian.PutUint16(aad, testTicketID)
+	aad = append(aad, testHubAddr+strHubPubKey...)
+	iv, authenTag, cipherTicket, _ := utils.EncryptAES(hubSecretKey, testTicketToken, aad)
+	writeResponse(w, 1, map[string]interface{}{
+		"hub_address":  testHubAddr,
+		"ticket_id":    testTicketID,
+		"ticket_token": base64.StdEncoding.EncodeToString(cipherTicket),
+		"pub_key":      strHubPubKey,
+		"iv":           base64.StdEncoding.EncodeToString(iv),
+		"auth_tag":     base64.StdEncoding.EncodeToString(authenTag),
+	})
+}
+
+func writeResponse(w http.ResponseWriter, returnCode int32, data interface{}) {
+	body, _ := jsoniter.ConfigFastest.Marshal(map[string]interface{}{
+		"returncode": returnCode,
+		"timestamp":  0,
+		"data":       data,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func TestExchangeKeyX25519(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	proxy := NewProxy(newTestConfig(t, httpServer.URL), WithKeyExchange(KeyExchangeX25519, false))
+
+	serverKey, err := proxy.ExchangeKeyContext(context.Background())
+	if err != nil {
+		t.Fatalf("[TestExchangeKeyX25519] exchange key failed: %s", err.Error())
+	}
+	if serverKey.Version != KeyExchangeX25519 || string(serverKey.X25519PubKey) != string(server.pubKey) {
+		t.Error("[TestExchangeKeyX25519] invalid server key")
+	}
+	if version, _ := server.requests["exchange-key"][0]["kex_version"].(float64); KeyExchange(version) != KeyExchangeX25519 {
+		t.Error("[TestExchangeKeyX25519] version is not offered")
+	}
+
+	ticket, err := proxy.RegisterConnectionContext(context.Background(), serverKey)
+	if err != nil {
+		t.Fatalf("[TestExchangeKeyX25519] register connection failed: %s", err.Error())
+	}
+	if ticket.HubAddress != testHubAddr || ticket.TicketID != testTicketID || len(ticket.ServerSecretKey) != utils.X25519KeySize {
+		t.Error("[TestExchangeKeyX25519] invalid ticket")
+	}
+	if version, _ := server.requests["register-connection"][0]["kex_version"].(float64); KeyExchange(version) != KeyExchangeX25519 {
+		t.Error("[TestExchangeKeyX25519] version is not sent on registration")
+	}
+}
+
+func TestExchangeKeyNegotiation(t *testing.T) {
+	cases := []struct {
+		name        string
+		version     int32
+		badSign     bool
+		allowLegacy bool
+		isValid     bool
+		result      KeyExchange
+	}{
+		{"downgrade allowed", 0, false, true, true, KeyExchangeDH},
+		{"downgrade rejected", 0, false, false, false, 0},
+		{"unknown version", 3, false, true, false, 0},
+		{"bad signature", int32(KeyExchangeX25519), true, true, false, 0},
+	}
+	for _, c := range cases {
+		server, httpServer := newTestServer(t)
+		server.version = c.version
+		server.badSign = c.badSign
+		proxy := NewProxy(newTestConfig(t, httpServer.URL), WithKeyExchange(KeyExchangeX25519, c.allowLegacy))
+
+		serverKey, err := proxy.ExchangeKeyContext(context.Background())
+		if (err == nil) != c.isValid {
+			t.Errorf("[TestExchangeKeyNegotiation] invalid result of %s", c.name)
+			continue
+		}
+		if c.isValid && serverKey.Version != c.result {
+			t.Errorf("[TestExchangeKeyNegotiation] invalid version of %s", c.name)
+		}
+	}
+
+	// A legacy client never accepts keys of a newer version
+	server, httpServer := newTestServer(t)
+	server.handlers["exchange-key"] = func(w http.ResponseWriter, r *http.Request) {
+		pubKey := base64.StdEncoding.EncodeToString(server.pubKey)
+		writeResponse(w, 1, map[string]interface{}{"kex_version": 2, "pub_key": pubKey, "sign": signRSA(t, []byte("cso-kex-v2"+pubKey))})
+	}
+	_, err := NewProxy(newTestConfig(t, httpServer.URL)).ExchangeKeyContext(context.Background())
+	if err == nil {
+		t.Error("[TestExchangeKeyNegotiation] unrequested version is accepted")
+	}
+}
+
+func TestRegisterConnectionNegotiation(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	proxy := NewProxy(newTestConfig(t, httpServer.URL), WithKeyExchange(KeyExchangeX25519, false))
+	serverKey, err := proxy.ExchangeKeyContext(context.Background())
+	if err != nil {
+		t.Fatal("[TestRegisterConnectionNegotiation] exchange key failed")
+	}
+
+	// Public hub-key of the legacy format
+	server.hubKey = "123456789"
+	_, err = proxy.RegisterConnectionContext(context.Background(), serverKey)
+	if err == nil {
+		t.Error("[TestRegisterConnectionNegotiation] legacy public hub-key is accepted")
+	}
+
+	// Public server-key which does not match the private key of the server
+	otherPrivKey, _ := utils.GenerateX25519PrivateKey()
+	otherPubKey, _ := utils.CalcX25519PublicKey(otherPrivKey)
+	server.hubKey = ""
+	_, err = proxy.RegisterConnectionContext(context.Background(), &ServerKey{Version: KeyExchangeX25519, X25519PubKey: otherPubKey})
+	if err == nil {
+		t.Error("[TestRegisterConnectionNegotiation] mismatched server key is accepted")
+	}
+}
@@ -13,5 +13,11 @@ type ItemQueue struct {
 	IsRequest   bool
 	IsGroup     bool
 	NumberRetry int32
-	Timestamp   uint64
+	NumberSent  int32
+	Timestamp   uint64 // unix milliseconds of the last sending
+	Deadline    uint64 // unix milliseconds after which the item is not sent, 0 means no deadline
+	Priority    Priority
+
+	// IsDeadlineExceeded is true if the item expired by Deadline instead of NumberRetry
+	IsDeadlineExceeded bool
 }
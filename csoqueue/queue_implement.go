@@ -5,66 +5,181 @@ import (
 	"time"
 )
 
+// DefaultResendInterval is interval of resending an unacknowledged message
+const DefaultResendInterval = 3 * time.Second
+
 type queueImpl struct {
-	cap   int32
-	len   int32
-	items []*ItemQueue
+	cap             int32
+	len             int32
+	caps            [NumberPriorities]int32
+	lens            [NumberPriorities]int32
+	resendInterval  uint64 // milliseconds
+	starvationLimit int
+	skipped         [NumberPriorities]int // times a due item of the class was not chosen
+	items           [NumberPriorities][]*ItemQueue
+	expired         []*ItemQueue
 }
 
 // NewQueue inits a new instance of Queue interface
 func NewQueue(cap int32) Queue {
-	return &queueImpl{
-		cap:   cap,
-		len:   0,
-		items: make([]*ItemQueue, cap, cap),
+	return NewQueueWithInterval(cap, DefaultResendInterval)
+}
+
+// NewQueueWithInterval inits a new instance of Queue interface which resends messages every resendInterval
+func NewQueueWithInterval(cap int32, resendInterval time.Duration) Queue {
+	return NewPriorityQueue(cap, [NumberPriorities]int32{}, resendInterval, DefaultStarvationLimit)
+}
+
+// NewPriorityQueue inits a new instance of PriorityQueue interface with a capacity per priority class
+// caps are indexed from the lowest class (PriorityLow) to the highest class (PriorityHigh), 0 means cap
+// A due item is sent regardless of its priority after it is skipped starvationLimit times
+func NewPriorityQueue(cap int32, caps [NumberPriorities]int32, resendInterval time.Duration, starvationLimit int) PriorityQueue {
+	if starvationLimit <= 0 {
+		starvationLimit = DefaultStarvationLimit
+	}
+	q := &queueImpl{
+		cap:             cap,
+		len:             0,
+		resendInterval:  uint64(resendInterval / time.Millisecond),
+		starvationLimit: starvationLimit,
+	}
+	for idx := range caps {
+		q.caps[idx] = caps[idx]
+		if q.caps[idx] <= 0 || q.caps[idx] > cap {
+			q.caps[idx] = cap
+		}
+		q.items[idx] = make([]*ItemQueue, q.caps[idx], q.caps[idx])
 	}
+	return q
 }
 
 // This method needs to be invoked before PushMessage method
 func (q *queueImpl) TakeIndex() bool {
+	return q.TakeIndexWithPriority(PriorityNormal)
+}
+
+// This method needs to be invoked before PushMessage method of an item with the same priority
+func (q *queueImpl) TakeIndexWithPriority(priority Priority) bool {
+	class := priority.index()
+	if atomic.AddInt32(&q.lens[class], 1) > q.caps[class] {
+		atomic.AddInt32(&q.lens[class], -1)
+		return false
+	}
 	if atomic.AddInt32(&q.len, 1) > q.cap {
 		atomic.AddInt32(&q.len, -1)
+		atomic.AddInt32(&q.lens[class], -1)
 		return false
 	}
 	return true
 }
 
+func (q *queueImpl) ReleaseIndex(priority Priority) {
+	atomic.AddInt32(&q.lens[priority.index()], -1)
+	atomic.AddInt32(&q.len, -1)
+}
+
+func (q *queueImpl) Len() int32 {
+	return atomic.LoadInt32(&q.len)
+}
+
 // TakeIndex method need to be invoked before this method
 func (q *queueImpl) PushMessage(item *ItemQueue) {
-	for idx, val := range q.items {
+	items := q.items[item.Priority.index()]
+	for idx, val := range items {
 		if val == nil {
-			q.items[idx] = item
+			items[idx] = item
 			break
 		}
 	}
 }
 
+// NextMessage returns the first due item of the highest class
+// An item of a lower class is returned instead when it was skipped too many times
 func (q *queueImpl) NextMessage() *ItemQueue {
-	var nextItem *ItemQueue
-	now := uint64(time.Now().Unix())
-	for idx, item := range q.items {
-		if item == nil {
+	now := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	// Find the first due item of each class and remove expired items
+	// An item out of retries is kept for a resend interval after its last sending, so its response can arrive
+	var due [NumberPriorities]int
+	for class, items := range q.items {
+		due[class] = -1
+		for idx, item := range items {
+			if item == nil {
+				continue
+			}
+			if item.Deadline != 0 && now >= item.Deadline {
+				item.IsDeadlineExceeded = true
+				q.remove(class, idx, true)
+				continue
+			}
+			if item.NumberRetry <= 0 {
+				if (now - item.Timestamp) >= q.resendInterval {
+					q.remove(class, idx, true)
+				}
+				continue
+			}
+			if due[class] == -1 && (now-item.Timestamp) >= q.resendInterval {
+				due[class] = idx
+			}
+		}
+	}
+
+	chosen := -1
+	for class := NumberPriorities - 1; class >= 0; class-- {
+		if due[class] == -1 {
 			continue
 		}
-		if nextItem == nil && (now-item.Timestamp) >= 3 { // resend every 3s
-			nextItem = item
-			item.Timestamp = now
-			item.NumberRetry--
+		if chosen == -1 {
+			chosen = class
 		}
-		if item.NumberRetry == 0 {
-			q.items[idx] = nil
-			atomic.AddInt32(&q.len, -1)
+		if q.skipped[class] >= q.starvationLimit {
+			// Starvation guard, the lowest starving class wins
+			chosen = class
 		}
 	}
-	return nextItem
+	if chosen == -1 {
+		return nil
+	}
+	for class := range due {
+		if class == chosen {
+			q.skipped[class] = 0
+		} else if due[class] != -1 {
+			q.skipped[class]++
+		}
+	}
+
+	item := q.items[chosen][due[chosen]]
+	item.Timestamp = now
+	item.NumberRetry--
+	item.NumberSent++
+	return item
 }
 
 func (q *queueImpl) ClearMessage(msgID uint64) {
-	for idx, item := range q.items {
-		if item != nil && item.MsgID == msgID {
-			q.items[idx] = nil
-			atomic.AddInt32(&q.len, -1)
-			break
+	for class, items := range q.items {
+		for idx, item := range items {
+			if item != nil && item.MsgID == msgID {
+				q.remove(class, idx, false)
+				return
+			}
 		}
 	}
 }
+
+func (q *queueImpl) ExpiredMessages() []*ItemQueue {
+	if len(q.expired) == 0 {
+		return nil
+	}
+	items := q.expired
+	q.expired = nil
+	return items
+}
+
+func (q *queueImpl) remove(class, idx int, isExpired bool) {
+	if isExpired {
+		q.expired = append(q.expired, q.items[class][idx])
+	}
+	q.items[class][idx] = nil
+	atomic.AddInt32(&q.lens[class], -1)
+	atomic.AddInt32(&q.len, -1)
+}
@@ -10,3 +10,31 @@ type Queue interface {
 	NextMessage() *ItemQueue
 	ClearMessage(msgID uint64)
 }
+
+// PriorityQueue is implemented by queues which limit and schedule items by priority class
+// The connector takes indices of other queues by TakeIndex regardless of the priority
+type PriorityQueue interface {
+	Queue
+
+	// Method can invoke on many threads
+	// This method needs to be invoked before PushMessage method of an item with the same priority
+	TakeIndexWithPriority(priority Priority) bool
+	// ReleaseIndex undoes TakeIndex or TakeIndexWithPriority when the item is not pushed
+	ReleaseIndex(priority Priority)
+}
+
+// LenQueue is implemented by queues which report number of their items, the connector exports it as queue depth
+type LenQueue interface {
+	// Method can invoke on many threads
+	Len() int32
+}
+
+// ExpiringQueue is implemented by queues which remove items without response
+// The connector reports removed items to the expired handler and the metrics
+type ExpiringQueue interface {
+	// ExpiredMessages returns items removed without response since the last call
+	// Items are removed when they pass their deadline, or when no response arrives
+	// within a resend interval after their last retry
+	// Method needs to be invoked on the same thread as NextMessage
+	ExpiredMessages() []*ItemQueue
+}
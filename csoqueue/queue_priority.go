@@ -0,0 +1,29 @@
+package csoqueue
+
+// Priority is class of an item, items of a higher class are sent and retried first
+type Priority int8
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// NumberPriorities is number of priority classes
+const NumberPriorities = 3
+
+// DefaultStarvationLimit is number of times a due item is skipped before it is sent regardless of its priority
+const DefaultStarvationLimit = 8
+
+// IsValid returns true if p is a known priority class
+func (p Priority) IsValid() bool {
+	return p >= PriorityLow && p <= PriorityHigh
+}
+
+// index returns position of the class in per-class arrays, the lowest class is at 0
+func (p Priority) index() int {
+	if !p.IsValid() {
+		return int(PriorityNormal - PriorityLow)
+	}
+	return int(p - PriorityLow)
+}
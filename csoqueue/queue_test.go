@@ -0,0 +1,141 @@
+package csoqueue
+
+import (
+	"testing"
+	"time"
+)
+
+const testInterval = 20 * time.Millisecond
+
+func pushItem(t *testing.T, q Queue, msgID uint64, numberRetry int32) {
+	if !q.TakeIndex() {
+		t.Fatal("[pushItem] take index failed")
+	}
+	q.PushMessage(&ItemQueue{MsgID: msgID, NumberRetry: numberRetry})
+}
+
+func TestSingleShot(t *testing.T) {
+	q := NewQueueWithInterval(4, testInterval).(*queueImpl)
+	pushItem(t, q, 1, 1)
+
+	item := q.NextMessage()
+	if item == nil || item.MsgID != 1 || item.NumberSent != 1 {
+		t.Fatal("[TestSingleShot] the item must be sent once")
+	}
+	if len(q.ExpiredMessages()) != 0 || q.Len() != 1 {
+		t.Error("[TestSingleShot] the item must wait for its response after the last sending")
+	}
+	if q.NextMessage() != nil {
+		t.Error("[TestSingleShot] the item must not be sent again")
+	}
+
+	time.Sleep(testInterval)
+	if q.NextMessage() != nil {
+		t.Error("[TestSingleShot] the expired item must not be sent")
+	}
+	expired := q.ExpiredMessages()
+	if len(expired) != 1 || expired[0].MsgID != 1 || expired[0].IsDeadlineExceeded {
+		t.Error("[TestSingleShot] the item must expire by retries")
+	}
+	if q.Len() != 0 {
+		t.Error("[TestSingleShot] the expired item must release its index")
+	}
+}
+
+func TestAckedOnLastAttempt(t *testing.T) {
+	q := NewQueueWithInterval(4, testInterval).(*queueImpl)
+	pushItem(t, q, 1, 2)
+
+	if q.NextMessage() == nil {
+		t.Fatal("[TestAckedOnLastAttempt] the first sending failed")
+	}
+	time.Sleep(testInterval)
+	item := q.NextMessage()
+	if item == nil || item.NumberSent != 2 {
+		t.Fatal("[TestAckedOnLastAttempt] the last sending failed")
+	}
+
+	q.ClearMessage(1)
+	time.Sleep(testInterval)
+	q.NextMessage()
+	if len(q.ExpiredMessages()) != 0 {
+		t.Error("[TestAckedOnLastAttempt] an acknowledged item must not expire")
+	}
+	if q.Len() != 0 {
+		t.Error("[TestAckedOnLastAttempt] the acknowledged item must release its index")
+	}
+}
+
+func TestUnacked(t *testing.T) {
+	q := NewQueueWithInterval(4, testInterval).(*queueImpl)
+	pushItem(t, q, 1, 3)
+
+	for idx := 0; idx < 3; idx++ {
+		item := q.NextMessage()
+		if item == nil || item.NumberSent != int32(idx+1) {
+			t.Fatalf("[TestUnacked] sending %d failed", idx+1)
+		}
+		if len(q.ExpiredMessages()) != 0 {
+			t.Fatalf("[TestUnacked] the item expired after sending %d", idx+1)
+		}
+		time.Sleep(testInterval)
+	}
+	if q.NextMessage() != nil {
+		t.Error("[TestUnacked] the item must not be sent more than its retries")
+	}
+	if len(q.ExpiredMessages()) != 1 || q.Len() != 0 {
+		t.Error("[TestUnacked] the item must expire after its last retry")
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	q := NewQueueWithInterval(4, testInterval).(*queueImpl)
+	if !q.TakeIndex() {
+		t.Fatal("[TestDeadline] take index failed")
+	}
+	deadline := uint64(time.Now().Add(-time.Millisecond).UnixNano() / int64(time.Millisecond))
+	q.PushMessage(&ItemQueue{MsgID: 1, NumberRetry: 3, Deadline: deadline})
+
+	if q.NextMessage() != nil {
+		t.Error("[TestDeadline] an item passing its deadline must not be sent")
+	}
+	expired := q.ExpiredMessages()
+	if len(expired) != 1 || !expired[0].IsDeadlineExceeded {
+		t.Error("[TestDeadline] the item must expire by deadline")
+	}
+}
+
+func TestPriority(t *testing.T) {
+	q := NewPriorityQueue(8, [NumberPriorities]int32{}, testInterval, 2)
+	for idx, priority := range []Priority{PriorityLow, PriorityHigh} {
+		if !q.TakeIndexWithPriority(priority) {
+			t.Fatal("[TestPriority] take index failed")
+		}
+		q.PushMessage(&ItemQueue{MsgID: uint64(idx + 1), NumberRetry: 10, Priority: priority})
+	}
+
+	item := q.NextMessage()
+	if item == nil || item.Priority != PriorityHigh {
+		t.Fatal("[TestPriority] the highest class must be sent first")
+	}
+	time.Sleep(testInterval)
+	q.NextMessage()
+	time.Sleep(testInterval)
+	item = q.NextMessage()
+	if item == nil || item.Priority != PriorityLow {
+		t.Error("[TestPriority] a starving class must be sent")
+	}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	var q Queue = NewQueue(4)
+	if _, isOk := q.(LenQueue); !isOk {
+		t.Error("[TestOptionalInterfaces] queue does not report its length")
+	}
+	if _, isOk := q.(ExpiringQueue); !isOk {
+		t.Error("[TestOptionalInterfaces] queue does not report expired items")
+	}
+	if _, isOk := q.(PriorityQueue); !isOk {
+		t.Error("[TestOptionalInterfaces] queue does not schedule items by priority")
+	}
+}
@@ -0,0 +1,279 @@
+package csosignature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+const signatureVersion = 2
+
+// domain separates signatures of this layer from other uses of the same keys
+var domain = []byte("cso-sig-v2")
+
+type signerImpl struct {
+	name       string
+	privateKey ed25519.PrivateKey
+}
+
+// NewSigner inits a new instance of Signer interface, name should be the connection name of the sender
+func NewSigner(name string, privateKey ed25519.PrivateKey) (Signer, error) {
+	if len(name) == 0 || len(name) > 0xFF {
+		return nil, errors.New("Invalid length of name")
+	}
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("Invalid key size")
+	}
+	return &signerImpl{
+		name:       name,
+		privateKey: privateKey,
+	}, nil
+}
+
+func (signer *signerImpl) Name() string {
+	return signer.name
+}
+
+func (signer *signerImpl) PublicKey() ed25519.PublicKey {
+	return signer.privateKey.Public().(ed25519.PublicKey)
+}
+
+// Sign builds the signature field
+// Version: 1 byte
+// Length of signer name (nName): 1 byte
+// Signer name: nName bytes
+// Flag is_group: 1 byte
+// Length of receiver name (nRecv): 1 byte
+// Receiver name: nRecv bytes, connection name or group name
+// Timestamp: 8 bytes, little endian, unix milliseconds
+// Nonce: 16 bytes
+// Signature: 64 bytes, over domain, the fields above and content
+func (signer *signerImpl) Sign(recvName string, isGroup bool, content []byte) ([]byte, error) {
+	if len(recvName) == 0 || len(recvName) > 0xFF {
+		return nil, errors.New("Invalid length of receiver name")
+	}
+	env, err := envelope.Unwrap(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Signature) > 0 {
+		return nil, errors.New("Content is already signed")
+	}
+
+	var nonce [NonceSize]byte
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, 4+len(signer.name)+len(recvName)+8+NonceSize+ed25519.SignatureSize)
+	header = append(header, signatureVersion, byte(len(signer.name)))
+	header = append(header, signer.name...)
+	if isGroup {
+		header = append(header, 1)
+	} else {
+		header = append(header, 0)
+	}
+	header = append(header, byte(len(recvName)))
+	header = append(header, recvName...)
+	header = binary.LittleEndian.AppendUint64(header, uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	header = append(header, nonce[:]...)
+
+	signature := ed25519.Sign(signer.privateKey, signedBytes(header, content))
+	env.Signature = append(header, signature...)
+	return env.IntoBytes()
+}
+
+func signedBytes(header, content []byte) []byte {
+	buffer := make([]byte, 0, len(domain)+len(header)+len(content))
+	buffer = append(buffer, domain...)
+	buffer = append(buffer, header...)
+	return append(buffer, content...)
+}
+
+// replayKey identifies a nonce of a signer
+type replayKey struct {
+	signer string
+	nonce  [NonceSize]byte
+}
+
+type verifierImpl struct {
+	trust    TrustStore
+	maxAge   time.Duration
+	capacity int
+
+	mutex   sync.Mutex
+	used    map[replayKey]time.Time // expiry of remembered nonces
+	order   []replayKey             // remembered nonces in order of insertion
+	idxHead int
+}
+
+// NewVerifier inits a new instance of Verifier interface
+// Signatures older than maxAge (or further than maxAge in the future) are stale
+// Nonces are remembered until their signatures are stale, at most capacity of them
+func NewVerifier(trust TrustStore, maxAge time.Duration, capacity int) Verifier {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	if capacity <= 0 {
+		capacity = DefaultReplayCapacity
+	}
+	return &verifierImpl{
+		trust:    trust,
+		maxAge:   maxAge,
+		capacity: capacity,
+		used:     make(map[replayKey]time.Time),
+	}
+}
+
+func (verifier *verifierImpl) Verify(content []byte, recvName string, isGroup bool) ([]byte, *Signature, Status) {
+	if !envelope.IsEnvelope(content) {
+		return content, nil, StatusUnsigned
+	}
+	env, err := envelope.ParseBytes(content)
+	if err != nil || len(env.Signature) == 0 {
+		return content, nil, StatusUnsigned
+	}
+
+	value := env.Signature
+	env.Signature = nil
+	unsigned, err := env.Wrap()
+	if err != nil {
+		return content, nil, StatusInvalid
+	}
+
+	sig, lenHeader := parseHeader(value)
+	if sig == nil {
+		return unsigned, nil, StatusInvalid
+	}
+
+	if verifier.trust == nil {
+		return unsigned, sig, StatusUntrusted
+	}
+	publicKey, isExisted := verifier.trust.GetKey(sig.Signer)
+	if !isExisted {
+		return unsigned, sig, StatusUntrusted
+	}
+
+	if !ed25519.Verify(publicKey, signedBytes(value[:lenHeader], unsigned), value[lenHeader:]) {
+		return unsigned, sig, StatusInvalid
+	}
+	// A single message must be signed for the receiver, a group message for a group
+	// Membership of the group is not known here, it is checked by the caller
+	if sig.IsGroup != isGroup || !isGroup && sig.Recipient != recvName {
+		return unsigned, sig, StatusInvalid
+	}
+
+	if !verifier.isFresh(sig) {
+		return unsigned, sig, StatusReplayed
+	}
+	return unsigned, sig, StatusValid
+}
+
+// parseHeader parses fields of a signature before the signature bytes and returns length of them
+func parseHeader(value []byte) (*Signature, int) {
+	if len(value) < 2 || value[0] != signatureVersion {
+		return nil, 0
+	}
+	idx := 2 + int(value[1])
+	if len(value) < idx+2 {
+		return nil, 0
+	}
+	sig := &Signature{
+		Signer:  string(value[2:idx]),
+		IsGroup: value[idx] == 1,
+	}
+	lenRecv := int(value[idx+1])
+	idx += 2
+	if len(value) != idx+lenRecv+8+NonceSize+ed25519.SignatureSize {
+		return nil, 0
+	}
+	sig.Recipient = string(value[idx : idx+lenRecv])
+	idx += lenRecv
+	sig.Timestamp = time.UnixMilli(int64(binary.LittleEndian.Uint64(value[idx:])))
+	idx += 8
+	copy(sig.Nonce[:], value[idx:idx+NonceSize])
+	return sig, idx + NonceSize
+}
+
+// isFresh checks the timestamp and the nonce of sig
+func (verifier *verifierImpl) isFresh(sig *Signature) bool {
+	age := time.Since(sig.Timestamp)
+	if age > verifier.maxAge || age < -verifier.maxAge {
+		return false
+	}
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	expiry, isExisted := verifier.used[replayKey{sig.Signer, sig.Nonce}]
+	return !isExisted || time.Now().After(expiry)
+}
+
+func (verifier *verifierImpl) MarkUsed(sig *Signature) {
+	if sig == nil {
+		return
+	}
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+
+	// Forget nonces whose signatures are stale, then the oldest ones over capacity
+	now := time.Now()
+	for verifier.idxHead < len(verifier.order) {
+		key := verifier.order[verifier.idxHead]
+		if len(verifier.used) < verifier.capacity && now.Before(verifier.used[key]) {
+			break
+		}
+		delete(verifier.used, key)
+		verifier.idxHead++
+	}
+	if verifier.idxHead > len(verifier.order)/2 {
+		verifier.order = append(verifier.order[:0], verifier.order[verifier.idxHead:]...)
+		verifier.idxHead = 0
+	}
+
+	key := replayKey{sig.Signer, sig.Nonce}
+	if _, isExisted := verifier.used[key]; !isExisted {
+		verifier.order = append(verifier.order, key)
+	}
+	verifier.used[key] = sig.Timestamp.Add(verifier.maxAge)
+}
+
+type trustStoreImpl struct {
+	mutex sync.RWMutex
+	keys  map[string]ed25519.PublicKey
+}
+
+// NewTrustStore inits a new instance of TrustStore interface
+func NewTrustStore() TrustStore {
+	return &trustStoreImpl{keys: make(map[string]ed25519.PublicKey)}
+}
+
+func (trust *trustStoreImpl) SetKey(name string, publicKey ed25519.PublicKey) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("Invalid key size")
+	}
+	key := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	copy(key, publicKey)
+
+	trust.mutex.Lock()
+	trust.keys[name] = key
+	trust.mutex.Unlock()
+	return nil
+}
+
+func (trust *trustStoreImpl) RemoveKey(name string) {
+	trust.mutex.Lock()
+	delete(trust.keys, name)
+	trust.mutex.Unlock()
+}
+
+func (trust *trustStoreImpl) GetKey(name string) (ed25519.PublicKey, bool) {
+	trust.mutex.RLock()
+	defer trust.mutex.RUnlock()
+	key, isExisted := trust.keys[name]
+	return key, isExisted
+}
@@ -0,0 +1,105 @@
+package csosignature
+
+import (
+	"crypto/ed25519"
+	"time"
+)
+
+// NonceSize is size of the random nonce in a signature
+const NonceSize = 16
+
+// DefaultMaxAge is the default age after which a signature is stale
+// Messages kept in the offline buffer or the retry queue longer than the max age are rejected as replays
+const DefaultMaxAge = 10 * time.Minute
+
+// DefaultReplayCapacity is the default number of nonces remembered by a Verifier
+const DefaultReplayCapacity = 65536
+
+// Status is result of verifying the signature of a received message
+type Status uint8
+
+const (
+	// StatusUnsigned means the message carries no signature
+	StatusUnsigned Status = iota
+	// StatusValid means the signature is made by the trusted key of the signer for this receiver
+	StatusValid
+	// StatusUntrusted means the signer has no key in the trust store
+	StatusUntrusted
+	// StatusInvalid means the signature does not match the content, the key of the signer, the sender or the receiver
+	StatusInvalid
+	// StatusReplayed means the signature is stale or its nonce was already used
+	StatusReplayed
+)
+
+func (status Status) String() string {
+	switch status {
+	case StatusUnsigned:
+		return "unsigned"
+	case StatusValid:
+		return "valid"
+	case StatusUntrusted:
+		return "untrusted"
+	case StatusInvalid:
+		return "invalid"
+	case StatusReplayed:
+		return "replayed"
+	}
+	return "unknown"
+}
+
+// Policy decides which received messages are delivered to handlers
+type Policy uint8
+
+const (
+	// PolicyFlag delivers all messages, the status is exposed in the message metadata
+	PolicyFlag Policy = iota
+	// PolicyRejectInvalid rejects messages with invalid, untrusted or replayed signatures, unsigned messages are delivered
+	PolicyRejectInvalid
+	// PolicyRejectUnverified rejects all messages without a valid signature
+	PolicyRejectUnverified
+)
+
+// IsAccepted returns true if a message with status is delivered under the policy
+func (policy Policy) IsAccepted(status Status) bool {
+	switch policy {
+	case PolicyRejectInvalid:
+		return status == StatusValid || status == StatusUnsigned
+	case PolicyRejectUnverified:
+		return status == StatusValid
+	}
+	return true
+}
+
+// Signature is information of the signature of a received message
+type Signature struct {
+	Signer    string
+	Recipient string // connection name or group name which the message was signed for
+	IsGroup   bool
+	Timestamp time.Time
+	Nonce     [NonceSize]byte
+}
+
+// Signer signs contents as a connection name
+type Signer interface {
+	Name() string
+	PublicKey() ed25519.PublicKey
+	// Sign adds a signature of content for the receiver to its envelope
+	Sign(recvName string, isGroup bool, content []byte) ([]byte, error)
+}
+
+// Verifier checks signatures of received messages and detects replays
+type Verifier interface {
+	// Verify removes the signature from content and checks it
+	// recvName is the connection name of the receiver, it is compared with the recipient of single messages
+	// sig is nil for unsigned contents or malformed signatures
+	Verify(content []byte, recvName string, isGroup bool) (unsigned []byte, sig *Signature, status Status)
+	// MarkUsed remembers the nonce of a handled message, later messages with the nonce are replays
+	MarkUsed(sig *Signature)
+}
+
+// TrustStore maps connection names to their public keys
+type TrustStore interface {
+	SetKey(name string, publicKey ed25519.PublicKey) error
+	RemoveKey(name string)
+	GetKey(name string) (ed25519.PublicKey, bool)
+}
@@ -0,0 +1,145 @@
+package csosignature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gecosys/cso-client-golang/message/envelope"
+)
+
+func newSigner(t *testing.T, name string) Signer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("[newSigner] generate key failed")
+	}
+	signer, err := NewSigner(name, privateKey)
+	if err != nil {
+		t.Fatal("[newSigner] init signer failed")
+	}
+	return signer
+}
+
+func newVerifier(signers ...Signer) Verifier {
+	trust := NewTrustStore()
+	for _, signer := range signers {
+		trust.SetKey(signer.Name(), signer.PublicKey())
+	}
+	return NewVerifier(trust, time.Minute, 0)
+}
+
+func TestVerify(t *testing.T) {
+	alice := newSigner(t, "alice")
+	verifier := newVerifier(alice)
+
+	sealed, _ := (&envelope.Envelope{Encryption: []byte{1, 2}, Data: []byte("ciphertext")}).IntoBytes()
+	contents := [][]byte{[]byte("open the valve"), sealed}
+	for _, content := range contents {
+		buffer, err := alice.Sign("bob", false, content)
+		if err != nil {
+			t.Fatal("[TestVerify] sign failed")
+		}
+		unsigned, sig, status := verifier.Verify(buffer, "bob", false)
+		if status != StatusValid || sig.Signer != "alice" || sig.Recipient != "bob" || !reflect.DeepEqual(unsigned, content) {
+			t.Errorf("[TestVerify] expected valid, got %s", status)
+		}
+	}
+
+	content := []byte("open the valve")
+	if _, sig, status := verifier.Verify(content, "bob", false); status != StatusUnsigned || sig != nil {
+		t.Errorf("[TestVerify] expected unsigned, got %s", status)
+	}
+
+	mallory := newSigner(t, "mallory")
+	buffer, _ := mallory.Sign("bob", false, content)
+	if _, sig, status := verifier.Verify(buffer, "bob", false); status != StatusUntrusted || sig.Signer != "mallory" {
+		t.Errorf("[TestVerify] expected untrusted, got %s", status)
+	}
+
+	buffer, _ = alice.Sign("bob", false, content)
+	env, _ := envelope.ParseBytes(buffer)
+	env.Data[0] ^= 0xFF
+	tampered, _ := env.IntoBytes()
+	if _, _, status := verifier.Verify(tampered, "bob", false); status != StatusInvalid {
+		t.Errorf("[TestVerify] expected invalid for tampered content, got %s", status)
+	}
+}
+
+func TestVerifyReceiver(t *testing.T) {
+	alice := newSigner(t, "alice")
+	verifier := newVerifier(alice)
+	content := []byte("open the valve")
+
+	// Redirected to another connection
+	buffer, _ := alice.Sign("bob", false, content)
+	if _, _, status := verifier.Verify(buffer, "carol", false); status != StatusInvalid {
+		t.Errorf("[TestVerifyReceiver] expected invalid for another receiver, got %s", status)
+	}
+	// Delivered as a group message
+	if _, _, status := verifier.Verify(buffer, "bob", true); status != StatusInvalid {
+		t.Errorf("[TestVerifyReceiver] expected invalid for a group message, got %s", status)
+	}
+
+	buffer, _ = alice.Sign("valves", true, content)
+	_, sig, status := verifier.Verify(buffer, "bob", true)
+	if status != StatusValid || sig.Recipient != "valves" || !sig.IsGroup {
+		t.Errorf("[TestVerifyReceiver] expected valid group message, got %s", status)
+	}
+	if _, _, status := verifier.Verify(buffer, "bob", false); status != StatusInvalid {
+		t.Errorf("[TestVerifyReceiver] expected invalid for a single message, got %s", status)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	alice := newSigner(t, "alice")
+	verifier := newVerifier(alice)
+	buffer, _ := alice.Sign("bob", false, []byte("open the valve"))
+
+	// A message is fresh until it is handled, so a failed handler can run again
+	_, sig, status := verifier.Verify(buffer, "bob", false)
+	if status != StatusValid {
+		t.Fatalf("[TestVerifyReplay] expected valid, got %s", status)
+	}
+	if _, _, status = verifier.Verify(buffer, "bob", false); status != StatusValid {
+		t.Errorf("[TestVerifyReplay] expected valid before handling, got %s", status)
+	}
+	verifier.MarkUsed(sig)
+	if _, _, status = verifier.Verify(buffer, "bob", false); status != StatusReplayed {
+		t.Errorf("[TestVerifyReplay] expected replayed, got %s", status)
+	}
+
+	// Stale signature, re-signed with an old timestamp
+	env, _ := envelope.ParseBytes(buffer)
+	env.Signature = nil
+	unsigned, _ := env.Wrap()
+	stale, _ := alice.Sign("bob", false, unsigned)
+	env, _ = envelope.ParseBytes(stale)
+	idxTimestamp := 2 + len("alice") + 2 + len("bob")
+	header := env.Signature[:idxTimestamp+8+NonceSize]
+	binary.LittleEndian.PutUint64(header[idxTimestamp:], uint64(time.Now().Add(-time.Hour).UnixMilli()))
+	privateKey := alice.(*signerImpl).privateKey
+	copy(env.Signature[len(header):], ed25519.Sign(privateKey, signedBytes(header, unsigned)))
+	stale, _ = env.IntoBytes()
+	if _, _, status = verifier.Verify(stale, "bob", false); status != StatusReplayed {
+		t.Errorf("[TestVerifyReplay] expected replayed for a stale signature, got %s", status)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	statuses := []Status{StatusUnsigned, StatusValid, StatusUntrusted, StatusInvalid, StatusReplayed}
+	expected := map[Policy][]bool{
+		PolicyFlag:             {true, true, true, true, true},
+		PolicyRejectInvalid:    {true, true, false, false, false},
+		PolicyRejectUnverified: {false, true, false, false, false},
+	}
+	for policy, accepted := range expected {
+		for idx, status := range statuses {
+			if policy.IsAccepted(status) != accepted[idx] {
+				t.Errorf("[TestPolicy] policy %d, status %s: expected %v", policy, status, accepted[idx])
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package csotracing
+
+import "context"
+
+const (
+	// KeyTraceParent is key of W3C "traceparent" header in carrier
+	KeyTraceParent = "traceparent"
+
+	// KeyTraceState is key of W3C "tracestate" header in carrier
+	KeyTraceState = "tracestate"
+)
+
+// Tracer creates spans and propagates trace context through carriers.
+// An OpenTelemetry tracer can be adapted by delegating Start to trace.Tracer
+// and Inject/Extract to propagation.TraceContext with propagation.MapCarrier.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+	Inject(ctx context.Context, carrier map[string]string)
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// Span is a single operation within a trace
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
@@ -1,5 +1,19 @@
 module github.com/gecosys/cso-client-golang
 
-go 1.13
+go 1.23.0
 
-require github.com/json-iterator/go v1.1.10
+require (
+	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.17.11
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/crypto v0.40.0
+	google.golang.org/protobuf v1.36.12
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+)
@@ -11,6 +11,9 @@ const MaxConnectionNameLength = 36
 type MessageType uint8
 
 const (
+	// TypeGroupNotice is type of group membership notice (a connection joined or left a group)
+	TypeGroupNotice = 0x01
+
 	// TypeActivation is type of activation message
 	TypeActivation = 0x02
 
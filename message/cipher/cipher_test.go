@@ -408,6 +408,7 @@ func runCases(runner func(msgID, msgTag uint64, msgType MessageType, iv, data, a
 
 	isEncrypted := true
 	msgTypes := []MessageType{
+		TypeGroupNotice,
 		TypeActivation,
 		TypeDone,
 		TypeGroup,
@@ -0,0 +1,212 @@
+package envelope
+
+import "errors"
+
+// Version is version of envelope format
+const Version = 1
+
+// MaxFieldLength is max length of value of a field
+const MaxFieldLength = 0xFFFF
+
+// FieldType is type of a field in Envelope
+type FieldType uint8
+
+const (
+	// FieldTraceParent is W3C "traceparent" header of trace context
+	FieldTraceParent = 0x01
+
+	// FieldTraceState is W3C "tracestate" header of trace context
+	FieldTraceState = 0x02
+
+	// FieldContentType is content type of data (e.g. "application/json")
+	FieldContentType = 0x03
+
+	// FieldSchema is schema name (kind) of data
+	FieldSchema = 0x04
+
+	// FieldCompression is algorithm which compressed data (e.g. "gzip")
+	FieldCompression = 0x05
+
+	// FieldEncryption is header of end-to-end encryption, data is the ciphertext
+	FieldEncryption = 0x06
+
+	// FieldSignature is signature of the envelope without this field and trace context
+	FieldSignature = 0x07
+)
+
+// magic marks the beginning of an envelope
+var magic = []byte{0x00, 'C', 'S', 'E'}
+
+// Envelope wraps payload of a message with metadata
+type Envelope struct {
+	TraceParent string
+	TraceState  string
+	ContentType string
+	Schema      string
+	Compression string
+	Encryption  []byte
+	Signature   []byte
+	Data        []byte
+}
+
+// IsEnvelope checks if buffer starts with header of an envelope
+func IsEnvelope(buffer []byte) bool {
+	if len(buffer) < len(magic)+2 {
+		return false
+	}
+	for idx, val := range magic {
+		if buffer[idx] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// Unwrap returns Envelope of buffer
+// If buffer is not an envelope, the result contains only the buffer as data
+func Unwrap(buffer []byte) (*Envelope, error) {
+	if !IsEnvelope(buffer) {
+		return &Envelope{Data: buffer}, nil
+	}
+	return ParseBytes(buffer)
+}
+
+// ParseBytes converts bytes to Envelope
+// Magic: 4 bytes (0x00, 'C', 'S', 'E')
+// Version: 1 byte
+// Number of fields (nFields): 1 byte
+// Fields: nFields times of [type: 1 byte, length of value (nValue): 2 bytes, value: nValue bytes]
+// Data: remaining bytes
+// Fields with unknown type are skipped
+func ParseBytes(buffer []byte) (*Envelope, error) {
+	if !IsEnvelope(buffer) {
+		return nil, errors.New("Invalid bytes")
+	}
+	lenMagic := len(magic)
+	if buffer[lenMagic] != Version {
+		return nil, errors.New("Unsupported version")
+	}
+
+	var (
+		env       = new(Envelope)
+		lenBuffer = len(buffer)
+		nFields   = int(buffer[lenMagic+1])
+		pos       = lenMagic + 2
+	)
+	for idx := 0; idx < nFields; idx++ {
+		if lenBuffer < pos+3 {
+			return nil, errors.New("Invalid bytes")
+		}
+		fieldType := FieldType(buffer[pos])
+		lenValue := int(buffer[pos+2])<<8 | int(buffer[pos+1])
+		pos += 3
+		if lenBuffer < pos+lenValue {
+			return nil, errors.New("Invalid bytes")
+		}
+		value := buffer[pos : pos+lenValue]
+		pos += lenValue
+
+		switch fieldType {
+		case FieldTraceParent:
+			env.TraceParent = string(value)
+		case FieldTraceState:
+			env.TraceState = string(value)
+		case FieldContentType:
+			env.ContentType = string(value)
+		case FieldSchema:
+			env.Schema = string(value)
+		case FieldCompression:
+			env.Compression = string(value)
+		case FieldEncryption:
+			env.Encryption = make([]byte, lenValue)
+			copy(env.Encryption, value)
+		case FieldSignature:
+			env.Signature = make([]byte, lenValue)
+			copy(env.Signature, value)
+		}
+	}
+
+	lenData := lenBuffer - pos
+	if lenData > 0 {
+		env.Data = make([]byte, lenData, lenData)
+		copy(env.Data, buffer[pos:])
+	}
+	return env, nil
+}
+
+// HasFields checks if the envelope carries any metadata
+func (env *Envelope) HasFields() bool {
+	return len(env.fields()) > 0
+}
+
+// IntoBytes converts Envelope to bytes
+func (env *Envelope) IntoBytes() ([]byte, error) {
+	fields := env.fields()
+	if len(fields) > 0xFF {
+		return nil, errors.New("Too many fields")
+	}
+
+	lenBuffer := len(magic) + 2 + len(env.Data)
+	for _, field := range fields {
+		if len(field.value) > MaxFieldLength {
+			return nil, errors.New("Invalid length of field")
+		}
+		lenBuffer += 3 + len(field.value)
+	}
+
+	buffer := make([]byte, lenBuffer, lenBuffer)
+	copy(buffer, magic)
+	pos := len(magic)
+	buffer[pos] = Version
+	buffer[pos+1] = byte(len(fields))
+	pos += 2
+	for _, field := range fields {
+		lenValue := len(field.value)
+		buffer[pos] = byte(field.fieldType)
+		buffer[pos+1] = byte(lenValue)
+		buffer[pos+2] = byte(lenValue >> 8)
+		copy(buffer[pos+3:], field.value)
+		pos += 3 + lenValue
+	}
+	copy(buffer[pos:], env.Data)
+	return buffer, nil
+}
+
+// Wrap returns bytes of the envelope if it carries any metadata, otherwise returns data only
+func (env *Envelope) Wrap() ([]byte, error) {
+	if !env.HasFields() {
+		return env.Data, nil
+	}
+	return env.IntoBytes()
+}
+
+type field struct {
+	fieldType FieldType
+	value     []byte
+}
+
+func (env *Envelope) fields() []field {
+	fields := make([]field, 0, 7)
+	if env.TraceParent != "" {
+		fields = append(fields, field{FieldTraceParent, []byte(env.TraceParent)})
+	}
+	if env.TraceState != "" {
+		fields = append(fields, field{FieldTraceState, []byte(env.TraceState)})
+	}
+	if env.ContentType != "" {
+		fields = append(fields, field{FieldContentType, []byte(env.ContentType)})
+	}
+	if env.Schema != "" {
+		fields = append(fields, field{FieldSchema, []byte(env.Schema)})
+	}
+	if env.Compression != "" {
+		fields = append(fields, field{FieldCompression, []byte(env.Compression)})
+	}
+	if len(env.Encryption) > 0 {
+		fields = append(fields, field{FieldEncryption, env.Encryption})
+	}
+	if len(env.Signature) > 0 {
+		fields = append(fields, field{FieldSignature, env.Signature})
+	}
+	return fields
+}
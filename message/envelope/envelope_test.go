@@ -0,0 +1,109 @@
+package envelope
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntoBytes(t *testing.T) {
+	env := &Envelope{
+		TraceParent: "00-01",
+		TraceState:  "a=b",
+		Data:        []byte("Goldeneye"),
+	}
+	expectedBytes := []uint8{0, 67, 83, 69, 1, 2, 1, 5, 0, 48, 48, 45, 48, 49, 2, 3, 0, 97, 61, 98, 71, 111, 108, 100, 101, 110, 101, 121, 101}
+	buffer, err := env.IntoBytes()
+	if err != nil {
+		t.Error("[TestIntoBytes] build bytes failed")
+	}
+	if reflect.DeepEqual(buffer, expectedBytes) == false {
+		t.Error("[TestIntoBytes] invalid bytes")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	input := []uint8{0, 67, 83, 69, 1, 3, 1, 5, 0, 48, 48, 45, 48, 49, 200, 1, 0, 7, 2, 3, 0, 97, 61, 98, 71, 111, 108, 100, 101, 110, 101, 121, 101}
+	env, err := ParseBytes(input)
+	if err != nil {
+		t.Error("[TestParseBytes] parse bytes failed")
+		return
+	}
+	if env.TraceParent != "00-01" {
+		t.Error("[TestParseBytes] invalid property TraceParent")
+	}
+	if env.TraceState != "a=b" {
+		t.Error("[TestParseBytes] invalid property TraceState")
+	}
+	if string(env.Data) != "Goldeneye" {
+		t.Error("[TestParseBytes] invalid property Data")
+	}
+
+	input = []uint8{0, 67, 83, 69, 1, 2, 3, 1, 0, 106, 4, 3, 0, 99, 109, 100, 123, 125}
+	env, err = ParseBytes(input)
+	if err != nil {
+		t.Error("[TestParseBytes] parse bytes failed")
+		return
+	}
+	if env.ContentType != "j" || env.Schema != "cmd" || string(env.Data) != "{}" {
+		t.Error("[TestParseBytes] invalid properties ContentType, Schema or Data")
+	}
+
+	input = []uint8{0, 67, 83, 69, 1, 1, 6, 2, 0, 1, 2, 255}
+	env, err = ParseBytes(input)
+	if err != nil {
+		t.Error("[TestParseBytes] parse bytes failed")
+		return
+	}
+	if reflect.DeepEqual(env.Encryption, []byte{1, 2}) == false || reflect.DeepEqual(env.Data, []byte{255}) == false {
+		t.Error("[TestParseBytes] invalid properties Encryption or Data")
+	}
+
+	input = []uint8{0, 67, 83, 69, 1, 1, 7, 3, 0, 1, 2, 3, 255}
+	env, err = ParseBytes(input)
+	if err != nil {
+		t.Error("[TestParseBytes] parse bytes failed")
+		return
+	}
+	if reflect.DeepEqual(env.Signature, []byte{1, 2, 3}) == false || reflect.DeepEqual(env.Data, []byte{255}) == false {
+		t.Error("[TestParseBytes] invalid properties Signature or Data")
+	}
+	input = []uint8{0, 67, 83, 69, 1, 3, 1, 5, 0, 48, 48, 45, 48, 49, 200, 1, 0, 7, 2, 3, 0, 97, 61, 98, 71, 111, 108, 100, 101, 110, 101, 121, 101}
+
+	// Truncated field
+	_, err = ParseBytes(input[:12])
+	if err == nil {
+		t.Error("[TestParseBytes] truncated bytes must be rejected")
+	}
+
+	// Unsupported version
+	input[4] = 2
+	_, err = ParseBytes(input)
+	if err == nil {
+		t.Error("[TestParseBytes] unsupported version must be rejected")
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	data := []byte("Goldeneye Technologies")
+	buffer, err := (&Envelope{Data: data}).Wrap()
+	if err != nil {
+		t.Error("[TestWrapUnwrap] wrap failed")
+	}
+	if reflect.DeepEqual(buffer, data) == false {
+		t.Error("[TestWrapUnwrap] envelope without fields must not change data")
+	}
+
+	env, err := Unwrap(data)
+	if err != nil || reflect.DeepEqual(env.Data, data) == false || env.HasFields() {
+		t.Error("[TestWrapUnwrap] invalid unwrapped raw data")
+	}
+
+	buffer, err = (&Envelope{TraceParent: "00-01", Data: data}).Wrap()
+	if err != nil {
+		t.Error("[TestWrapUnwrap] wrap failed")
+	}
+	env, err = Unwrap(buffer)
+	if err != nil || env.TraceParent != "00-01" || reflect.DeepEqual(env.Data, data) == false {
+		t.Error("[TestWrapUnwrap] invalid unwrapped envelope")
+	}
+}
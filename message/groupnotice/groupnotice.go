@@ -0,0 +1,65 @@
+package groupnotice
+
+import "errors"
+
+// Action is change of a group membership
+type Action uint8
+
+const (
+	// ActionJoin means the member joined the group
+	ActionJoin Action = 0x01
+
+	// ActionLeave means the member left the group
+	ActionLeave Action = 0x02
+)
+
+// GroupNotice is information of a group membership change
+type GroupNotice struct {
+	Action     Action
+	GroupName  string
+	MemberName string
+}
+
+// ParseBytes converts bytes to GroupNotice
+// Action: 1 byte
+// Length of group name (nGroup): 1 byte
+// Group name: nGroup bytes
+// Member name: remaining bytes
+func ParseBytes(buffer []byte) (*GroupNotice, error) {
+	if len(buffer) < 2 {
+		return nil, errors.New("Invalid bytes")
+	}
+	action := Action(buffer[0])
+	if action != ActionJoin && action != ActionLeave {
+		return nil, errors.New("Invalid action")
+	}
+	lenGroup := int(buffer[1])
+	if lenGroup == 0 || len(buffer) <= 2+lenGroup {
+		return nil, errors.New("Invalid bytes")
+	}
+	return &GroupNotice{
+		Action:     action,
+		GroupName:  string(buffer[2 : 2+lenGroup]),
+		MemberName: string(buffer[2+lenGroup:]),
+	}, nil
+}
+
+// BuildBytes returns bytes of GroupNotice
+func BuildBytes(action Action, groupName, memberName string) ([]byte, error) {
+	if action != ActionJoin && action != ActionLeave {
+		return nil, errors.New("Invalid action")
+	}
+	lenGroup := len(groupName)
+	if lenGroup == 0 || lenGroup > 0xFF {
+		return nil, errors.New("Invalid length of group name")
+	}
+	if len(memberName) == 0 {
+		return nil, errors.New("Invalid length of member name")
+	}
+	buffer := make([]byte, 2+lenGroup+len(memberName))
+	buffer[0] = byte(action)
+	buffer[1] = byte(lenGroup)
+	copy(buffer[2:], groupName)
+	copy(buffer[2+lenGroup:], memberName)
+	return buffer, nil
+}
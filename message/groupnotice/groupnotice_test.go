@@ -0,0 +1,54 @@
+package groupnotice
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBytes(t *testing.T) {
+	input := []uint8{1, 3, 103, 114, 49, 100, 101, 118}
+	notice, err := ParseBytes(input)
+	if err != nil {
+		t.Error("[TestParseBytes] parse bytes failed")
+		return
+	}
+	if notice.Action != ActionJoin {
+		t.Error("[TestParseBytes] invalid property Action")
+	}
+	if notice.GroupName != "gr1" {
+		t.Error("[TestParseBytes] invalid property GroupName")
+	}
+	if notice.MemberName != "dev" {
+		t.Error("[TestParseBytes] invalid property MemberName")
+	}
+
+	invalids := [][]uint8{
+		{1},
+		{3, 3, 103, 114, 49, 100},
+		{2, 3, 103, 114, 49},
+		{2, 0, 100},
+	}
+	for _, input := range invalids {
+		_, err = ParseBytes(input)
+		if err == nil {
+			t.Errorf("[TestParseBytes] bytes %v must be rejected", input)
+		}
+	}
+}
+
+func TestBuildBytes(t *testing.T) {
+	buffer, err := BuildBytes(ActionLeave, "gr1", "dev")
+	if err != nil {
+		t.Error("[TestBuildBytes] build bytes failed")
+		return
+	}
+	expected := []uint8{2, 3, 103, 114, 49, 100, 101, 118}
+	if reflect.DeepEqual(buffer, expected) == false {
+		t.Error("[TestBuildBytes] invalid bytes")
+	}
+
+	_, err = BuildBytes(ActionJoin, "", "dev")
+	if err == nil {
+		t.Error("[TestBuildBytes] empty group name must be rejected")
+	}
+}
@@ -1,5 +1,20 @@
 go test ./message/cipher
 go test ./message/readyticket
 go test ./message/ticket
+go test ./message/envelope
+go test ./message/groupnotice
+go test ./config
+go test ./csocodec
+go test -race ./csoconnector
+go test ./csocounter
+go test ./csoqueue
+go test ./csoe2e
+go test ./csoidempotency
+go test ./csolimiter
+go test ./csometrics
+go test ./csoparser
+go test ./csoproxy
+go test ./csosignature
+go test ./utils
 
 read -p "Done"
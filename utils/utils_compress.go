@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionNone disables compression
+	CompressionNone = ""
+
+	// CompressionGzip is gzip (RFC 1952)
+	CompressionGzip = "gzip"
+
+	// CompressionZstd is Zstandard (RFC 8878)
+	CompressionZstd = "zstd"
+
+	// CompressionSnappy is Snappy block format
+	CompressionSnappy = "snappy"
+)
+
+// MaxDecompressedSize is max size of decompressed data, larger data is rejected
+const MaxDecompressedSize = 1 << 20
+
+var (
+	onceZstd    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	errZstd     error
+)
+
+func initZstd() {
+	zstdEncoder, errZstd = zstd.NewWriter(nil)
+	if errZstd != nil {
+		return
+	}
+	zstdDecoder, errZstd = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+}
+
+// IsSupportedCompression checks if algorithm is supported
+func IsSupportedCompression(algorithm string) bool {
+	switch algorithm {
+	case CompressionNone, CompressionGzip, CompressionZstd, CompressionSnappy:
+		return true
+	}
+	return false
+}
+
+// Compress compresses data by algorithm
+func Compress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		buffer := new(bytes.Buffer)
+		writer := gzip.NewWriter(buffer)
+		_, err := writer.Write(data)
+		if err != nil {
+			return nil, err
+		}
+		err = writer.Close()
+		if err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case CompressionZstd:
+		onceZstd.Do(initZstd)
+		if errZstd != nil {
+			return nil, errZstd
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	}
+	return nil, errors.New("Unsupported compression")
+}
+
+// Decompress decompresses data by algorithm
+func Decompress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		result, err := io.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(result) > MaxDecompressedSize {
+			return nil, errors.New("Decompressed data is too large")
+		}
+		return result, nil
+	case CompressionZstd:
+		onceZstd.Do(initZstd)
+		if errZstd != nil {
+			return nil, errZstd
+		}
+		return zstdDecoder.DecodeAll(data, nil)
+	case CompressionSnappy:
+		lenResult, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if lenResult > MaxDecompressedSize {
+			return nil, errors.New("Decompressed data is too large")
+		}
+		return snappy.Decode(nil, data)
+	}
+	return nil, errors.New("Unsupported compression")
+}
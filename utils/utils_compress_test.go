@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+var compressions = []string{CompressionGzip, CompressionZstd, CompressionSnappy}
+
+func TestCompressRoundTrip(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.Read(random)
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"short", []byte("hello")},
+		{"repeated", bytes.Repeat([]byte("cloud socket "), 1000)},
+		{"random", random},
+		{"max size", bytes.Repeat([]byte{'a'}, MaxDecompressedSize)},
+	}
+	for _, algorithm := range append(compressions, CompressionNone) {
+		for _, c := range cases {
+			compressed, err := Compress(algorithm, c.data)
+			if err != nil {
+				t.Errorf("[TestCompressRoundTrip] compress %s data by %q failed", c.name, algorithm)
+				continue
+			}
+			data, err := Decompress(algorithm, compressed)
+			if err != nil || !bytes.Equal(data, c.data) {
+				t.Errorf("[TestCompressRoundTrip] invalid %s data decompressed by %q", c.name, algorithm)
+			}
+		}
+	}
+
+	if _, err := Compress("lz4", random); err == nil {
+		t.Error("[TestCompressRoundTrip] unsupported compression is accepted")
+	}
+	if _, err := Decompress("lz4", random); err == nil {
+		t.Error("[TestCompressRoundTrip] unsupported decompression is accepted")
+	}
+	if IsSupportedCompression("lz4") || !IsSupportedCompression(CompressionZstd) {
+		t.Error("[TestCompressRoundTrip] invalid supported compressions")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	cases := []struct {
+		name string
+		size int
+	}{
+		{"over max size", MaxDecompressedSize + 1},
+		// Decompression bomb, a few KB expand to 64 MB
+		{"bomb", 64 << 20},
+	}
+	for _, algorithm := range compressions {
+		for _, c := range cases {
+			compressed, err := Compress(algorithm, make([]byte, c.size))
+			if err != nil {
+				t.Fatalf("[TestDecompressLimit] compress by %q failed", algorithm)
+			}
+			data, err := Decompress(algorithm, compressed)
+			if err == nil || data != nil {
+				t.Errorf("[TestDecompressLimit] %s data is decompressed by %q", c.name, algorithm)
+			}
+		}
+	}
+
+	// Corrupted data
+	for _, algorithm := range compressions {
+		compressed, _ := Compress(algorithm, bytes.Repeat([]byte("data"), 100))
+		compressed[len(compressed)/2] ^= 0xFF
+		compressed = compressed[:len(compressed)-2]
+		if _, err := Decompress(algorithm, compressed); err == nil {
+			t.Errorf("[TestDecompressLimit] corrupted data is decompressed by %q", algorithm)
+		}
+	}
+}
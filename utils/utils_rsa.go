@@ -36,3 +36,9 @@ func VerifyRSASign(publicKey string, sign, data []byte) error {
 	hashed := sha256.Sum256(data)
 	return rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, hashed[:], sign)
 }
+
+// ValidateRSAPublicKey checks if publicKey is a PEM encoded RSA public key
+func ValidateRSAPublicKey(publicKey string) error {
+	_, err := parsePublicKey([]byte(publicKey))
+	return err
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// X25519KeySize is size of X25519 private keys, public keys and derived secret keys
+const X25519KeySize = 32
+
+// GenerateX25519PrivateKey generates private X25519 key
+func GenerateX25519PrivateKey() ([]byte, error) {
+	privKey := make([]byte, X25519KeySize)
+	_, err := io.ReadFull(rand.Reader, privKey)
+	if err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+// CalcX25519PublicKey calculates public X25519 key of privKey
+func CalcX25519PublicKey(privKey []byte) ([]byte, error) {
+	if len(privKey) != X25519KeySize {
+		return nil, errors.New("Invalid X25519 key size")
+	}
+	return curve25519.X25519(privKey, curve25519.Basepoint)
+}
+
+// CalcX25519SecretKey calculates secret key by ECDH on X25519 and HKDF-SHA256 with salt and info
+// Peer keys of low order (all-zero shared secret) are rejected
+func CalcX25519SecretKey(privKey, peerPubKey, salt, info []byte) ([]byte, error) {
+	if len(privKey) != X25519KeySize || len(peerPubKey) != X25519KeySize {
+		return nil, errors.New("Invalid X25519 key size")
+	}
+	shared, err := curve25519.X25519(privKey, peerPubKey)
+	if err != nil {
+		return nil, err
+	}
+	secretKey := make([]byte, X25519KeySize)
+	_, err = io.ReadFull(hkdf.New(sha256.New, shared, salt, info), secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return secretKey, nil
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	buffer, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal("[decodeHex] invalid hex")
+	}
+	return buffer
+}
+
+// Test vectors of RFC 7748, section 5.2
+func TestX25519Vectors(t *testing.T) {
+	vectors := []struct{ scalar, u, output string }{
+		{
+			"a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4",
+			"e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c",
+			"c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552",
+		},
+		// First iteration of the iterated test
+		{
+			"0900000000000000000000000000000000000000000000000000000000000000",
+			"0900000000000000000000000000000000000000000000000000000000000000",
+			"422c8e7a6227d7bca1350b3e2bb7279f7897b87bb6854b783c60e80311ae3079",
+		},
+	}
+	for _, vector := range vectors {
+		output, err := curve25519.X25519(decodeHex(t, vector.scalar), decodeHex(t, vector.u))
+		if err != nil || !bytes.Equal(output, decodeHex(t, vector.output)) {
+			t.Errorf("[TestX25519Vectors] invalid output of scalar %s", vector.scalar)
+		}
+	}
+}
+
+// Test vectors of RFC 7748, section 6.1
+func TestX25519KeyExchange(t *testing.T) {
+	alicePrivKey := decodeHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	bobPrivKey := decodeHex(t, "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb")
+
+	alicePubKey, err := CalcX25519PublicKey(alicePrivKey)
+	if err != nil || hex.EncodeToString(alicePubKey) != "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a" {
+		t.Error("[TestX25519KeyExchange] invalid public key of Alice")
+	}
+	bobPubKey, err := CalcX25519PublicKey(bobPrivKey)
+	if err != nil || hex.EncodeToString(bobPubKey) != "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f" {
+		t.Error("[TestX25519KeyExchange] invalid public key of Bob")
+	}
+
+	shared, err := curve25519.X25519(alicePrivKey, bobPubKey)
+	if err != nil || hex.EncodeToString(shared) != "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742" {
+		t.Error("[TestX25519KeyExchange] invalid shared secret")
+	}
+
+	info := []byte("cso-test")
+	aliceSecretKey, err := CalcX25519SecretKey(alicePrivKey, bobPubKey, nil, info)
+	if err != nil {
+		t.Fatal("[TestX25519KeyExchange] calc secret key failed")
+	}
+	bobSecretKey, err := CalcX25519SecretKey(bobPrivKey, alicePubKey, nil, info)
+	if err != nil || !bytes.Equal(aliceSecretKey, bobSecretKey) {
+		t.Error("[TestX25519KeyExchange] secret keys of both sides must be equal")
+	}
+	if bytes.Equal(aliceSecretKey, shared) {
+		t.Error("[TestX25519KeyExchange] secret key must be derived by HKDF")
+	}
+	otherSecretKey, _ := CalcX25519SecretKey(alicePrivKey, bobPubKey, nil, []byte("cso-other"))
+	if bytes.Equal(aliceSecretKey, otherSecretKey) {
+		t.Error("[TestX25519KeyExchange] secret keys with different info must differ")
+	}
+
+	// Low order point
+	_, err = CalcX25519SecretKey(alicePrivKey, make([]byte, X25519KeySize), nil, info)
+	if err == nil {
+		t.Error("[TestX25519KeyExchange] low order public key must be rejected")
+	}
+}
+
+// Secret keys of the RFC 7748 key pairs with HKDF-SHA256, computed independently
+func TestX25519SecretKeyVectors(t *testing.T) {
+	alicePrivKey := decodeHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	bobPubKey := decodeHex(t, "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")
+	vectors := []struct{ salt, info, output string }{
+		{"", "cso-register-v2", "414a87c224e0356b53990f26c5f0768eb8a39d1c22f0040f0781a8b667250d9c"},
+		{"salt", "cso-hub-v2", "0af47d3301ac2db61740a6508ae4db6ec662eb4ca972d9bbae382535701f5ef6"},
+	}
+	for _, vector := range vectors {
+		var salt []byte
+		if vector.salt != "" {
+			salt = []byte(vector.salt)
+		}
+		secretKey, err := CalcX25519SecretKey(alicePrivKey, bobPubKey, salt, []byte(vector.info))
+		if err != nil || hex.EncodeToString(secretKey) != vector.output {
+			t.Errorf("[TestX25519SecretKeyVectors] invalid secret key of info %s", vector.info)
+		}
+	}
+}